@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 
@@ -17,14 +20,17 @@ import (
 	mockdb "transfers/db/mock"
 	db "transfers/db/sqlc"
 	"transfers/testutil"
+	"transfers/util"
 )
 
 func TestGetAccountAPI(t *testing.T) {
 	account := testutil.GenerateAccount()
+	etag := fmt.Sprintf(`"%d"`, account.Version)
 
 	testCases := []struct {
 		name          string
 		accountID     int64
+		header        http.Header
 		buildStubs    func(store *mockdb.MockStore)
 		checkResponse func(t *testing.T, recoder *httptest.ResponseRecorder)
 	}{
@@ -42,7 +48,100 @@ func TestGetAccountAPI(t *testing.T) {
 				resp := models.GetAccountResponse{}
 				testutil.UnmarshalToResp(t, recorder.Body, &resp)
 				require.Equal(t, account.ID, resp.AccountID)
-				require.Equal(t, account.Balance, resp.Balance)
+				require.Equal(t, util.CurrencyAmount(account.Balance, account.Currency), resp.Balance)
+				require.Equal(t, resp.Balance, resp.AvailableBalance)
+				require.Equal(t, account.Currency, resp.Currency)
+				require.Equal(t, account.Version, resp.Version)
+				require.Equal(t, db.AccountActive, resp.Status)
+				require.Equal(t, util.AccountNumber(account.ID), resp.AccountNumber)
+				require.Equal(t, etag, recorder.Header().Get("ETag"))
+			},
+		},
+		{
+			name:      "WithHolds",
+			accountID: account.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				held := *account
+				held.Balance, held.Held = util.MustParseMoney("100.00000"), util.MustParseMoney("30.50000")
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(&held, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "100.00", resp.Balance.String())
+				require.Equal(t, "69.50", resp.AvailableBalance.String())
+			},
+		},
+		{
+			name:      "CreditAccount",
+			accountID: account.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				credit := *account
+				floor := util.MustParseMoney("-500.00000")
+				credit.Balance, credit.Held = util.MustParseMoney("-100.00000"), util.MustParseMoney("30.50000")
+				credit.Type, credit.BalanceFloor = db.AccountCredit, &floor
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(&credit, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "-100.00", resp.Balance.String())
+				require.Equal(t, "369.50", resp.AvailableBalance.String())
+				require.Equal(t, db.AccountCredit, resp.Type)
+				require.Equal(t, "-500.00", resp.BalanceFloor.String())
+			},
+		},
+		{
+			name:      "NotModified",
+			accountID: account.ID,
+			header:    http.Header{"If-None-Match": {`"x", W/` + etag}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotModified, recorder.Code)
+				require.Equal(t, etag, recorder.Header().Get("ETag"))
+				require.Empty(t, recorder.Body.Bytes())
+			},
+		},
+		{
+			name:      "IfMatch",
+			accountID: account.ID,
+			header:    http.Header{"If-Match": {etag}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:      "PreconditionFailed",
+			accountID: account.ID,
+			header:    http.Header{"If-Match": {fmt.Sprintf(`"%d"`, account.Version+1)}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+				require.Equal(t, etag, recorder.Header().Get("ETag"))
 			},
 		},
 		{
@@ -95,12 +194,15 @@ func TestGetAccountAPI(t *testing.T) {
 			store := mockdb.NewMockStore(ctrl)
 			tc.buildStubs(store)
 
-			server := NewServer(store)
+			server := newTestServer(t, store)
 			recorder := httptest.NewRecorder()
 
 			url := fmt.Sprintf("/accounts/%d", tc.accountID)
 			request, err := http.NewRequest(http.MethodGet, url, nil)
 			require.NoError(t, err)
+			for key, values := range tc.header {
+				request.Header[key] = values
+			}
 
 			server.engine.ServeHTTP(recorder, request)
 			tc.checkResponse(t, recorder)
@@ -124,13 +226,12 @@ func TestCreateAccountAPI(t *testing.T) {
 				"initial_balance": account.Balance,
 			},
 			buildStubs: func(store *mockdb.MockStore) {
-				store.EXPECT().
-					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
-					Times(1).
-					Return(nil, pgx.ErrNoRows)
 				arg := &db.CreateAccountParams{
-					ID:      account.ID,
-					Balance: account.Balance,
+					ID:           account.ID,
+					Balance:      account.Balance,
+					Currency:     util.DefaultCurrency,
+					Type:         db.AccountCash,
+					BalanceFloor: &util.Money{},
 				}
 				store.EXPECT().
 					CreateAccount(gomock.Any(), gomock.Eq(arg)).
@@ -142,20 +243,208 @@ func TestCreateAccountAPI(t *testing.T) {
 				resp := models.CreateAccountResponse{}
 				testutil.UnmarshalToResp(t, recorder.Body, &resp)
 				require.Equal(t, account.ID, resp.AccountID)
-				require.Equal(t, account.Balance, resp.InitialBalance)
+				require.Equal(t, util.CurrencyAmount(account.Balance, account.Currency), resp.InitialBalance)
+				require.Equal(t, account.Currency, resp.Currency)
+				require.Equal(t, db.AccountCash, resp.Type)
+				require.Equal(t, "0.00", resp.BalanceFloor.String())
 			},
 		},
 		{
-			name: "InternalError",
+			name: "AllocatedID",
+			body: gin.H{
+				"initial_balance": account.Balance,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Times(0)
+				arg := &db.CreateAccountWithNextIDParams{
+					Balance:      account.Balance,
+					Currency:     util.DefaultCurrency,
+					Type:         db.AccountCash,
+					BalanceFloor: &util.Money{},
+				}
+				store.EXPECT().
+					AllocateAccount(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, account.ID, resp.AccountID)
+				require.Equal(t, util.AccountNumber(account.ID), resp.AccountNumber)
+			},
+		},
+		{
+			name: "WithMetadata",
 			body: gin.H{
 				"account_id":      account.ID,
 				"initial_balance": account.Balance,
+				"display_name":    "Payroll",
+				"owner_reference": "cust-42",
+				"labels":          gin.H{"team": "payments"},
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
-					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					CreateAccount(gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(nil, pgx.ErrNoRows)
+					DoAndReturn(func(_ any, arg *db.CreateAccountParams) (*db.Account, error) {
+						require.Equal(t, "Payroll", arg.DisplayName)
+						require.Equal(t, "cust-42", arg.OwnerReference)
+						require.Equal(t, util.Labels{"team": "payments"}, arg.Labels)
+						created := *account
+						created.DisplayName, created.OwnerReference, created.Labels = arg.DisplayName, arg.OwnerReference, arg.Labels
+						return &created, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "Payroll", resp.DisplayName)
+				require.Equal(t, "cust-42", resp.OwnerReference)
+				require.Equal(t, util.Labels{"team": "payments"}, resp.Labels)
+			},
+		},
+		{
+			name: "InvalidLabel",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": account.Balance,
+				"labels":          gin.H{"": "payments"},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "TooManyLabels",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": account.Balance,
+				"labels":          manyLabels(util.MaxLabels + 1),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "CreditAccount",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "-50",
+				"type":            db.AccountCredit,
+				"credit_limit":    "500",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				floor := util.MustParseMoney("-500.00000")
+				arg := &db.CreateAccountParams{
+					ID:           account.ID,
+					Balance:      util.MustParseMoney("-50.00000"),
+					Currency:     util.DefaultCurrency,
+					Type:         db.AccountCredit,
+					BalanceFloor: &floor,
+				}
+				credit := *account
+				credit.Balance, credit.Type, credit.BalanceFloor = arg.Balance, arg.Type, arg.BalanceFloor
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(&credit, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "-50.00", resp.InitialBalance.String())
+				require.Equal(t, db.AccountCredit, resp.Type)
+				require.Equal(t, "-500.00", resp.BalanceFloor.String())
+			},
+		},
+		{
+			name: "SystemAccount",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "-1000000",
+				"type":            db.AccountSystem,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateAccountParams) (*db.Account, error) {
+						require.Equal(t, db.AccountSystem, arg.Type)
+						require.Nil(t, arg.BalanceFloor)
+						system := *account
+						system.Balance, system.Type, system.BalanceFloor = arg.Balance, arg.Type, nil
+						return &system, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, db.AccountSystem, resp.Type)
+				require.Nil(t, resp.BalanceFloor)
+			},
+		},
+		{
+			name: "BelowCreditLimit",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "-500.01",
+				"type":            db.AccountCredit,
+				"credit_limit":    "500",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "CreditWithoutLimit",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "0",
+				"type":            db.AccountCredit,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "CashWithLimit",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "0",
+				"credit_limit":    "500",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InternalError",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": account.Balance,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
 					CreateAccount(gomock.Any(), gomock.Any()).
 					Times(1).
@@ -191,9 +480,41 @@ func TestCreateAccountAPI(t *testing.T) {
 			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
-					GetAccount(gomock.Any(), gomock.Any()).
+					CreateAccount(gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(account, nil)
+					Return(nil, util.NewAccountAlreadyExistsError(account.ID))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidPrecision",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "100.5",
+				"currency":        "JPY",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "UnknownCurrency",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": account.Balance,
+				"currency":        "XYZ",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().
 					CreateAccount(gomock.Any(), gomock.Any()).
 					Times(0)
@@ -220,6 +541,42 @@ func TestCreateAccountAPI(t *testing.T) {
 				require.Equal(t, http.StatusBadRequest, recorder.Code)
 			},
 		},
+		{
+			name: "ExponentBalance",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "1e3",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "OverflowBalance",
+			body: gin.H{
+				"account_id":      account.ID,
+				"initial_balance": "1000000000000000",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -232,7 +589,7 @@ func TestCreateAccountAPI(t *testing.T) {
 			store := mockdb.NewMockStore(ctrl)
 			tc.buildStubs(store)
 
-			server := NewServer(store)
+			server := newTestServer(t, store)
 			recorder := httptest.NewRecorder()
 
 			// Marshal body data to JSON
@@ -248,3 +605,743 @@ func TestCreateAccountAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAccountByNumberAPI(t *testing.T) {
+	account := testutil.GenerateAccount()
+	number := util.AccountNumber(account.ID)
+	// Only one check digit is right for the rest of the number
+	mistyped := number[:len(number)-1] + string('0'+(number[len(number)-1]-'0'+1)%10)
+
+	testCases := []struct {
+		name          string
+		number        string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			number: number,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, account.ID, resp.AccountID)
+				require.Equal(t, number, resp.AccountNumber)
+				require.Equal(t, fmt.Sprintf(`"%d"`, account.Version), recorder.Header().Get("ETag"))
+			},
+		},
+		{
+			name:   "InvalidCheckDigit",
+			number: mistyped,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "NotANumber",
+			number: "abc",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "NotFound",
+			number: number,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(nil, pgx.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts/by-number/"+tc.number, nil)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUpdateAccountStatusAPI(t *testing.T) {
+	account := testutil.GenerateAccount()
+
+	testCases := []struct {
+		name          string
+		action        string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Freeze",
+			action: "freeze",
+			buildStubs: func(store *mockdb.MockStore) {
+				frozen := *account
+				frozen.Status = db.AccountFrozen
+				store.EXPECT().
+					SetAccountStatus(gomock.Any(), gomock.Eq(account.ID), gomock.Eq(db.AccountFrozen)).
+					Times(1).
+					Return(&frozen, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.GetAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, account.ID, resp.AccountID)
+				require.Equal(t, db.AccountFrozen, resp.Status)
+			},
+		},
+		{
+			name:   "Unfreeze",
+			action: "unfreeze",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					SetAccountStatus(gomock.Any(), gomock.Eq(account.ID), gomock.Eq(db.AccountActive)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.GetAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, db.AccountActive, resp.Status)
+			},
+		},
+		{
+			name:   "CloseWithBalance",
+			action: "close",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					SetAccountStatus(gomock.Any(), gomock.Eq(account.ID), gomock.Eq(db.AccountClosed)).
+					Times(1).
+					Return(nil, util.NewAccountNotEmptyError(account.ID, account.Balance.String(), "0"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:   "NotFound",
+			action: "close",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					SetAccountStatus(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewAccountNotFoundError(account.ID))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/admin/accounts/%d/%s", account.ID, tc.action)
+			request, err := http.NewRequest(http.MethodPost, url, http.NoBody)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUpdateAccountAPI(t *testing.T) {
+	account := testutil.GenerateAccount()
+
+	testCases := []struct {
+		name          string
+		body          string
+		ifMatch       string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: `{"display_name": "Payroll", "labels": {"team": "payments", "legacy": null}}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				updated := *account
+				updated.DisplayName, updated.Labels, updated.Version = "Payroll", util.Labels{"team": "payments"}, account.Version+1
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.UpdateAccountMetadataParams) (*db.Account, error) {
+						require.Equal(t, account.ID, arg.ID)
+						require.Equal(t, pgtype.Text{String: "Payroll", Valid: true}, arg.DisplayName)
+						require.False(t, arg.OwnerReference.Valid)
+						require.JSONEq(t, `{"team": "payments", "legacy": null}`, string(arg.Labels))
+						require.Nil(t, arg.Versions)
+						require.EqualValues(t, util.MaxLabels, arg.MaxLabels)
+						return &updated, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "Payroll", resp.DisplayName)
+				require.Equal(t, util.Labels{"team": "payments"}, resp.Labels)
+				require.Equal(t, resp.ETag(), recorder.Header().Get("ETag"))
+			},
+		},
+		{
+			name: "NoLabels",
+			body: `{"owner_reference": "cust-42"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.UpdateAccountMetadataParams) (*db.Account, error) {
+						require.Equal(t, pgtype.Text{String: "cust-42", Valid: true}, arg.OwnerReference)
+						require.JSONEq(t, `{}`, string(arg.Labels))
+						return account, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidLabel",
+			body: `{"labels": {"team:name": "payments"}}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().UpdateAccountMetadata(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:    "IfMatch",
+			body:    `{"display_name": "Payroll"}`,
+			ifMatch: fmt.Sprintf(`W/"%d", "%d"`, account.Version+1, account.Version),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.UpdateAccountMetadataParams) (*db.Account, error) {
+						require.Equal(t, []int64{account.Version}, arg.Versions)
+						return account, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "IfMatchAny",
+			body:    `{"display_name": "Payroll"}`,
+			ifMatch: "*",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.UpdateAccountMetadataParams) (*db.Account, error) {
+						require.Nil(t, arg.Versions)
+						return account, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:    "PreconditionFailed",
+			body:    `{"display_name": "Payroll"}`,
+			ifMatch: fmt.Sprintf(`"%d"`, account.Version-1),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, pgx.ErrNoRows)
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+				require.Contains(t, recorder.Body.String(), strconv.FormatInt(account.Version, 10))
+			},
+		},
+		{
+			name:    "MalformedIfMatch",
+			body:    `{"display_name": "Payroll"}`,
+			ifMatch: "version-1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.UpdateAccountMetadataParams) (*db.Account, error) {
+						require.NotNil(t, arg.Versions)
+						require.Empty(t, arg.Versions)
+						return nil, pgx.ErrNoRows
+					})
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+			},
+		},
+		{
+			name: "TooManyLabels",
+			body: `{"labels": {"team": "payments"}}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, pgx.ErrNoRows)
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "TooManyLabelsInRequest",
+			body: func() string {
+				body, err := json.Marshal(gin.H{"labels": manyLabels(util.MaxLabels + 1)})
+				require.NoError(t, err)
+				return string(body)
+			}(),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().UpdateAccountMetadata(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "NotFound",
+			body: `{"display_name": "Payroll"}`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					UpdateAccountMetadata(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, pgx.ErrNoRows)
+				store.EXPECT().
+					GetAccount(gomock.Any(), gomock.Eq(account.ID)).
+					Times(1).
+					Return(nil, pgx.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d", account.ID)
+			request, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader([]byte(tc.body)))
+			require.NoError(t, err)
+			if tc.ifMatch != "" {
+				request.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func manyLabels(n int) map[string]string {
+	labels := map[string]string{}
+	for i := 0; i < n; i++ {
+		labels[fmt.Sprintf("label-%d", i)] = "value"
+	}
+	return labels
+}
+
+func TestListAccountsAPI(t *testing.T) {
+	accounts := []*db.Account{testutil.GenerateAccount(), testutil.GenerateAccount(), testutil.GenerateAccount()}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?limit=2",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ListAccounts(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.ListAccountsParams) ([]*db.Account, error) {
+						require.Equal(t, "", arg.OwnerReference)
+						require.Equal(t, util.Labels{}, arg.Labels)
+						require.Equal(t, int32(3), arg.PageSize)
+						return accounts, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.ListAccountsResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Len(t, resp.Accounts, 2)
+				require.Equal(t, accounts[0].ID, resp.Accounts[0].AccountID)
+				require.Equal(t, util.EncodeCursor(accounts[1].ID), resp.NextCursor)
+			},
+		},
+		{
+			name:  "Filtered",
+			query: "?owner=cust-42&label=team:payments&label=url:https://example.com&cursor=Mjg",
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := &db.ListAccountsParams{
+					OwnerReference: "cust-42",
+					Labels:         util.Labels{"team": "payments", "url": "https://example.com"},
+					BeforeID:       28,
+					PageSize:       21,
+				}
+				store.EXPECT().
+					ListAccounts(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(accounts[:1], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.ListAccountsResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Len(t, resp.Accounts, 1)
+				require.Empty(t, resp.NextCursor)
+			},
+		},
+		{
+			name:  "InvalidSelector",
+			query: "?label=team",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "ConflictingSelectors",
+			query: "?label=team:payments&label=team:risk",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InvalidCursor",
+			query: "?cursor=abc",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts"+tc.query, http.NoBody)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetAccountBalanceAPI(t *testing.T) {
+	account := &db.Account{
+		ID:             1,
+		Balance:        util.MustParseMoney("7.00000"),
+		Currency:       "USD",
+		InitialBalance: util.MustParseMoney("10.00000"),
+	}
+	at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		accountID     int64
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "OK",
+			accountID: account.ID,
+			query:     "?at=2024-03-01T00:00:00Z",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				arg := &db.SumAccountEntriesParams{AccountID: account.ID, Before: at}
+				store.EXPECT().
+					SumAccountEntries(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(util.MustParseMoney("-1.50000"), nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountBalanceResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "8.50", resp.Balance.String())
+				require.Equal(t, "USD", resp.Currency)
+				require.True(t, at.Equal(resp.At))
+			},
+		},
+		{
+			name:      "DefaultsToNow",
+			accountID: account.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().
+					SumAccountEntries(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(util.MustParseMoney("-3.00000"), nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountBalanceResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "7.00", resp.Balance.String())
+				require.False(t, resp.At.IsZero())
+			},
+		},
+		{
+			name:      "NotFound",
+			accountID: 2,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(int64(2))).Times(1).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().SumAccountEntries(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:      "InvalidTime",
+			accountID: account.ID,
+			query:     "?at=yesterday",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d/balance%s", tc.accountID, tc.query)
+			request, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetAccountStatementAPI(t *testing.T) {
+	createdAt := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	account := &db.Account{ID: 1, Currency: "USD", CreatedAt: createdAt}
+	statement := &db.AccountStatement{
+		Account:        account,
+		OpeningBalance: util.MustParseMoney("10.00000"),
+		Entries: []*db.ListAccountStatementEntriesRow{
+			{
+				TransactionID:        7,
+				Amount:               util.MustParseMoney("-2.50000"),
+				SourceAccountID:      1,
+				DestinationAccountID: pgtype.Int8{Int64: 2, Valid: true},
+				Description:          "Rent",
+			},
+			{
+				TransactionID:        8,
+				Amount:               util.MustParseMoney("1.00000"),
+				SourceAccountID:      3,
+				DestinationAccountID: pgtype.Int8{Int64: 1, Valid: true},
+				ExternalReference:    "inv-8",
+			},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?from=2024-02-01T00:00:00Z&to=2024-03-01T00:00:00Z",
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := &db.AccountStatementParams{AccountID: 1, From: from, To: to}
+				store.EXPECT().
+					GetAccountStatement(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(statement, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountStatementResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "10.00", resp.OpeningBalance.String())
+				require.Equal(t, "8.50", resp.ClosingBalance.String())
+				require.Len(t, resp.Movements, 2)
+				require.Equal(t, int64(2), resp.Movements[0].CounterpartyAccountID)
+				require.Equal(t, "-2.50", resp.Movements[0].Amount.String())
+				require.Equal(t, "7.50", resp.Movements[0].Balance.String())
+				require.Equal(t, "Rent", resp.Movements[0].Description)
+				require.Equal(t, int64(3), resp.Movements[1].CounterpartyAccountID)
+				require.Equal(t, "8.50", resp.Movements[1].Balance.String())
+				require.Equal(t, "inv-8", resp.Movements[1].ExternalReference)
+			},
+		},
+		{
+			name: "DefaultPeriod",
+			buildStubs: func(store *mockdb.MockStore) {
+				empty := &db.AccountStatement{Account: account, OpeningBalance: util.MustParseMoney("10.00000")}
+				store.EXPECT().
+					GetAccountStatement(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(empty, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountStatementResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.True(t, createdAt.Equal(resp.From))
+				require.False(t, resp.To.IsZero())
+				require.Empty(t, resp.Movements)
+				require.Equal(t, "10.00", resp.ClosingBalance.String())
+			},
+		},
+		{
+			name:  "InvalidRange",
+			query: "?from=2024-03-01T00:00:00Z&to=2024-02-01T00:00:00Z",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccountStatement(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "NotFound",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetAccountStatement(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewAccountNotFoundError(1))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts/1/statement"+tc.query, http.NoBody)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+)
+
+/*
+RunAdmin serves the operational endpoints, such as the expvar metrics at /debug/vars, on address. They are kept off
+the router of the public API, as they expose the command line and memory stats of the process, so address is meant
+to be reachable only from within the deployment.
+*/
+func RunAdmin(address string) error {
+	return http.ListenAndServe(address, adminHandler())
+}
+
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
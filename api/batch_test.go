@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"transfers/api/models"
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/testutil"
+	"transfers/util"
+)
+
+func TestCreateTransferBatchAPI(t *testing.T) {
+	accountA := testutil.GenerateAccount()
+	accountB := testutil.GenerateAccount()
+	accountB.ID = accountA.ID + 1
+	missingID := accountA.ID + 2
+
+	transfer := func(source, destination int64, amount string) gin.H {
+		return gin.H{
+			"source_account_id":      source,
+			"destination_account_id": destination,
+			"amount":                 amount,
+		}
+	}
+	param := func(source, destination int64, amount string) *db.CreateTransactionParams {
+		return &db.CreateTransactionParams{
+			SourceAccountID:      source,
+			DestinationAccountID: destination,
+			Amount:               util.MustParseMoney(amount),
+			Currency:             "USD",
+			DestinationAmount:    util.MustParseMoney(amount),
+			DestinationCurrency:  "USD",
+			FxRate:               "1",
+		}
+	}
+	transaction := func(id int64, p *db.CreateTransactionParams) *db.Transaction {
+		return &db.Transaction{
+			ID:                   id,
+			SourceAccountID:      p.SourceAccountID,
+			DestinationAccountID: pgtype.Int8{Int64: p.DestinationAccountID, Valid: true},
+			Amount:               p.Amount,
+			Currency:             p.Currency,
+			DestinationAmount:    p.DestinationAmount,
+			DestinationCurrency:  p.DestinationCurrency,
+			FxRate:               p.FxRate,
+			CreatedAt:            time.Now().UTC(),
+		}
+	}
+	stubAccounts := func(store *mockdb.MockStore) {
+		store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(accountA.ID)).AnyTimes().Return(accountA, nil)
+		store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(accountB.ID)).AnyTimes().Return(accountB, nil)
+		store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(missingID)).AnyTimes().Return(nil, pgx.ErrNoRows)
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"transfers": []gin.H{
+				transfer(accountA.ID, accountB.ID, "1.5"),
+				transfer(accountB.ID, accountA.ID, "2"),
+			}},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				arg := &db.CreateTransactionBatchParams{Transfers: []*db.CreateTransactionParams{
+					param(accountA.ID, accountB.ID, "1.50000"),
+					param(accountB.ID, accountA.ID, "2.00000"),
+				}}
+				store.EXPECT().
+					CreateTransactionBatch(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return([]*db.TransferBatchResult{
+						{Transaction: transaction(1, arg.Transfers[0])},
+						{Transaction: transaction(2, arg.Transfers[1])},
+					}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateTransferBatchResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, 2, resp.Succeeded)
+				require.Zero(t, resp.Failed)
+				require.Len(t, resp.Results, 2)
+				require.Equal(t, int64(1), resp.Results[0].Transaction.TransactionID)
+				require.Equal(t, 1, resp.Results[1].Index)
+				require.Equal(t, "2.00", resp.Results[1].Transaction.Amount.String())
+			},
+		},
+		{
+			name: "InvalidTransferRejectsBatch",
+			body: gin.H{"transfers": []gin.H{
+				transfer(accountA.ID, accountB.ID, "1.5"),
+				transfer(accountA.ID, missingID, "1"),
+			}},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "transfer 1 of batch")
+			},
+		},
+		{
+			name: "InsufficientBalanceRejectsBatch",
+			body: gin.H{"transfers": []gin.H{
+				transfer(accountA.ID, accountB.ID, "1.5"),
+			}},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				store.EXPECT().
+					CreateTransactionBatch(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewBatchTransferError(0, util.NewInsufficientBalanceError()))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPaymentRequired, recorder.Code)
+			},
+		},
+		{
+			name: "BestEffort",
+			body: gin.H{
+				"best_effort": true,
+				"transfers": []gin.H{
+					transfer(accountA.ID, missingID, "1"),
+					transfer(accountA.ID, accountB.ID, "1.5"),
+					transfer(accountB.ID, accountA.ID, "2"),
+				},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				arg := &db.CreateTransactionBatchParams{
+					Transfers: []*db.CreateTransactionParams{
+						param(accountA.ID, accountB.ID, "1.50000"),
+						param(accountB.ID, accountA.ID, "2.00000"),
+					},
+					BestEffort: true,
+				}
+				store.EXPECT().
+					CreateTransactionBatch(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return([]*db.TransferBatchResult{
+						{Transaction: transaction(1, arg.Transfers[0])},
+						{Err: util.NewInsufficientBalanceError()},
+					}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateTransferBatchResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, 1, resp.Succeeded)
+				require.Equal(t, 2, resp.Failed)
+				require.Contains(t, resp.Results[0].Error, "account not found")
+				require.Nil(t, resp.Results[0].Transaction)
+				require.Equal(t, int64(1), resp.Results[1].Transaction.TransactionID)
+				require.Contains(t, resp.Results[2].Error, "insufficient balance")
+			},
+		},
+		{
+			name: "BestEffortAllInvalid",
+			body: gin.H{
+				"best_effort": true,
+				"transfers":   []gin.H{transfer(accountA.ID, accountA.ID, "1")},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateTransferBatchResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, 1, resp.Failed)
+			},
+		},
+		{
+			name: "BestEffortMalformedTransfer",
+			body: gin.H{
+				"best_effort": true,
+				"transfers": []gin.H{
+					{"source_account_id": accountA.ID, "destination_account_id": accountB.ID},
+					transfer(accountA.ID, accountB.ID, "1.5"),
+					{"source_account_id": accountA.ID, "destination_account_id": accountB.ID, "amount": "1", "currency": "USDX"},
+				},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				arg := &db.CreateTransactionBatchParams{
+					Transfers:  []*db.CreateTransactionParams{param(accountA.ID, accountB.ID, "1.50000")},
+					BestEffort: true,
+				}
+				store.EXPECT().
+					CreateTransactionBatch(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return([]*db.TransferBatchResult{{Transaction: transaction(1, arg.Transfers[0])}}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateTransferBatchResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, 1, resp.Succeeded)
+				require.Equal(t, 2, resp.Failed)
+				require.Contains(t, resp.Results[0].Error, "Amount")
+				require.Equal(t, int64(1), resp.Results[1].Transaction.TransactionID)
+				require.Contains(t, resp.Results[2].Error, "Currency")
+			},
+		},
+		{
+			name: "EmptyBatch",
+			body: gin.H{"transfers": []gin.H{}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidTransferBinding",
+			body: gin.H{"transfers": []gin.H{{"source_account_id": accountA.ID, "amount": "1"}}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "transfer 0 of batch")
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/transfer-batches", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"transfers/util"
+)
+
+// etagger is implemented by responses that carry a version, so that clients can make conditional requests
+type etagger interface {
+	ETag() string
+}
+
+/*
+checkPreconditions sets the ETag header and evaluates the If-Match and If-None-Match headers against etag.
+It responds with 412 Precondition Failed or 304 Not Modified and returns false when the handler should stop.
+*/
+func checkPreconditions(ctx *gin.Context, etag string) bool {
+	ctx.Header("ETag", etag)
+	if ifMatch := ctx.GetHeader("If-Match"); ifMatch != "" && !etagMatches(ifMatch, etag, false) {
+		err := util.NewPreconditionFailedError(etag)
+		ctx.JSON(status(err, http.StatusPreconditionFailed), errorResponse(err))
+		return false
+	}
+	if ifNoneMatch := ctx.GetHeader("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		ctx.Status(http.StatusNotModified)
+		return false
+	}
+	return true
+}
+
+// etagMatches reports whether etag is in the comma separated header list, or the list is "*".
+// Weak comparison ignores the W/ prefix, as If-None-Match requires, while If-Match uses strong comparison.
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
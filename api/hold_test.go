@@ -0,0 +1,482 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"transfers/api/models"
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/testutil"
+	"transfers/util"
+)
+
+func TestCreateHoldAPI(t *testing.T) {
+	source := testutil.GenerateAccount()
+	destination := testutil.GenerateAccount()
+	destination.ID = source.ID + 1
+	hold := testutil.GenerateHold()
+	hold.AccountID, hold.DestinationAccountID = source.ID, destination.ID
+	hold.Amount = util.MustParseMoney("1.50000")
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"account_id":             source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				store.EXPECT().
+					PlaceHold(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateHoldParams) (*db.Hold, error) {
+						require.Equal(t, source.ID, arg.AccountID)
+						require.Equal(t, destination.ID, arg.DestinationAccountID)
+						require.Equal(t, util.MustParseMoney("1.50000"), arg.Amount)
+						require.Equal(t, "USD", arg.Currency)
+						require.WithinDuration(t, time.Now().Add(testConfig.HoldTTL), arg.ExpiresAt, time.Minute)
+						return hold, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.GetHoldResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, hold.ID, resp.HoldID)
+				require.Equal(t, "1.50", resp.Amount.String())
+				require.Equal(t, db.HoldActive, resp.Status)
+				require.Nil(t, resp.CapturedAmount)
+			},
+		},
+		{
+			name: "AccountNumbers",
+			body: gin.H{
+				"account_number":             util.AccountNumber(source.ID),
+				"destination_account_number": util.AccountNumber(destination.ID),
+				"amount":                     "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				store.EXPECT().
+					PlaceHold(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateHoldParams) (*db.Hold, error) {
+						require.Equal(t, source.ID, arg.AccountID)
+						require.Equal(t, destination.ID, arg.DestinationAccountID)
+						return hold, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "InsufficientBalance",
+			body: gin.H{
+				"account_id":             source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(2).Return(source, nil)
+				store.EXPECT().
+					PlaceHold(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewInsufficientBalanceError())
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPaymentRequired, recorder.Code)
+			},
+		},
+		{
+			name: "CrossCurrencyWithoutRate",
+			body: gin.H{
+				"account_id":             source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				yen := *destination
+				yen.Currency = "JPY"
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(&yen, nil)
+				store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(2).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().PlaceHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "ExpiryInPast",
+			body: gin.H{
+				"account_id":             source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"expires_at":             time.Now().Add(-time.Minute),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().PlaceHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidPrecision",
+			body: gin.H{
+				"account_id":             source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.505",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(2).Return(source, nil)
+				store.EXPECT().PlaceHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "SameAccount",
+			body: gin.H{
+				"account_id":             source.ID,
+				"destination_account_id": source.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().PlaceHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/holds", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetHoldAPI(t *testing.T) {
+	hold := testutil.GenerateHold()
+	hold.Status = db.HoldCaptured
+	hold.CapturedAmount = hold.Amount
+	hold.TransactionID = pgtype.Int8{Int64: 7, Valid: true}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(hold, nil)
+	store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID+1)).Times(1).Return(nil, pgx.ErrNoRows)
+	server := newTestServer(t, store)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/holds/%d", hold.ID), nil)
+	require.NoError(t, err)
+	server.engine.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	resp := models.GetHoldResponse{}
+	testutil.UnmarshalToResp(t, recorder.Body, &resp)
+	require.Equal(t, db.HoldCaptured, resp.Status)
+	require.Equal(t, util.CurrencyAmount(hold.Amount, hold.Currency), *resp.CapturedAmount)
+	require.Equal(t, int64(7), resp.TransactionID)
+
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, fmt.Sprintf("/holds/%d", hold.ID+1), nil)
+	require.NoError(t, err)
+	server.engine.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCaptureHoldAPI(t *testing.T) {
+	hold := testutil.GenerateHold()
+	hold.Amount = util.MustParseMoney("10.00000")
+	destination := testutil.GenerateAccount()
+	destination.ID = hold.DestinationAccountID
+	captured := *hold
+	captured.Status = db.HoldCaptured
+	captured.TransactionID = pgtype.Int8{Int64: 7, Valid: true}
+
+	transfer := func(amount string) *db.CreateTransactionParams {
+		return &db.CreateTransactionParams{
+			SourceAccountID:      hold.AccountID,
+			DestinationAccountID: hold.DestinationAccountID,
+			Amount:               util.MustParseMoney(amount),
+			Currency:             "USD",
+			DestinationAmount:    util.MustParseMoney(amount),
+			DestinationCurrency:  "USD",
+			FxRate:               "1",
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "FullCapture",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(hold, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				arg := &db.CaptureHoldParams{HoldID: hold.ID, Transfer: transfer("10.00000")}
+				store.EXPECT().
+					CaptureHold(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(&captured, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.GetHoldResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, db.HoldCaptured, resp.Status)
+				require.Equal(t, int64(7), resp.TransactionID)
+			},
+		},
+		{
+			name: "PartialCapture",
+			body: gin.H{"amount": "2.5"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(hold, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				arg := &db.CaptureHoldParams{HoldID: hold.ID, Transfer: transfer("2.50000")}
+				store.EXPECT().
+					CaptureHold(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(&captured, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "CrossCurrency",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				yen := *destination
+				yen.Currency = "JPY"
+				store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(hold, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(&yen, nil)
+				store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(1).Return(&db.FxRate{ID: 3, Rate: "150.1234000000"}, nil)
+				store.EXPECT().
+					CaptureHold(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CaptureHoldParams) (*db.Hold, error) {
+						require.Equal(t, "JPY", arg.Transfer.DestinationCurrency)
+						require.Equal(t, "1501.00000", arg.Transfer.DestinationAmount.String())
+						require.Equal(t, int64(3), arg.Transfer.FxRateID.Int64)
+						return &captured, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "NotActive",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(hold, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(1).Return(destination, nil)
+				store.EXPECT().
+					CaptureHold(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewHoldNotActiveError(hold.ID, db.HoldVoided))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "HoldNotFound",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().CaptureHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "DestinationNotFound",
+			body: gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(hold, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().CaptureHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidAmount",
+			body: gin.H{"amount": "-1"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetHold(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CaptureHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/holds/%d/capture", hold.ID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestVoidHoldAPI(t *testing.T) {
+	hold := testutil.GenerateHold()
+	voided := *hold
+	voided.Status = db.HoldVoided
+
+	testCases := []struct {
+		name          string
+		holdID        int64
+		body          io.Reader
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			holdID: hold.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VoidHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(&voided, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.GetHoldResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, db.HoldVoided, resp.Status)
+			},
+		},
+		{
+			name:   "EmptyJSONBody",
+			holdID: hold.ID,
+			body:   bytes.NewReader([]byte("{}")),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VoidHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(&voided, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:   "NotFound",
+			holdID: hold.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VoidHold(gomock.Any(), gomock.Eq(hold.ID)).Times(1).Return(nil, util.NewHoldNotFoundError(hold.ID))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "InvalidID",
+			holdID: -1,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().VoidHold(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			body := tc.body
+			if body == nil {
+				body = http.NoBody
+			}
+			url := fmt.Sprintf("/holds/%d/void", tc.holdID)
+			request, err := http.NewRequest(http.MethodPost, url, body)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotencyKeyField      = "idempotency_key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	contentTypeHeader        = "Content-Type"
+	maxIdempotencyKeyLength  = 255
+)
+
+// replayedHeaders are the response headers that are saved with the response to a request made with an idempotency key
+var replayedHeaders = []string{contentTypeHeader, "ETag", "Location"}
+
+/*
+idempotent makes a POST handler safe to retry. The key is taken from the Idempotency-Key header, or the
+idempotency_key field of the JSON body. The handler runs in the DB transaction that claims the key, and its response
+is saved in that transaction too, so a replay of the same request gets the original status, body and headers back
+without running the handler again, even after a commit whose outcome the client never learnt. The response is only
+sent once it is saved. Reusing a key for a different request is rejected, and server errors release the key so the
+client can retry.
+*/
+func (s *Server) idempotent(ctx *gin.Context) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	key := idempotencyKey(ctx, body)
+	if key == "" {
+		ctx.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		err := util.NewInvalidIdempotencyKeyError(key)
+		ctx.AbortWithStatusJSON(status(err, http.StatusBadRequest), errorResponse(err))
+		return
+	}
+
+	requestHash := hashRequest(ctx.Request, body)
+	request, writer := ctx.Request, ctx.Writer
+	recorder := newResponseRecorder(writer)
+	record, err := s.store.DoIdempotent(request.Context(), &db.CreateIdempotencyKeyParams{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(s.config.IdempotencyKeyTTL),
+	}, func(scoped context.Context) (*db.IdempotentResponse, error) {
+		// The handler reaches the transaction of the key through the request context
+		ctx.Request, ctx.Writer = request.WithContext(scoped), recorder
+		defer func() {
+			ctx.Request, ctx.Writer = request, writer
+		}()
+		ctx.Next()
+		if recorder.Status() >= http.StatusInternalServerError {
+			return nil, nil
+		}
+		return recorder.response(), nil
+	})
+	switch {
+	case err != nil:
+		ctx.AbortWithStatusJSON(status(err, http.StatusInternalServerError), errorResponse(err))
+	case record != nil:
+		replay(ctx, record, requestHash)
+	default:
+		recorder.send()
+	}
+}
+
+// replay responds with the saved response of an earlier request that claimed the key of record
+func replay(ctx *gin.Context, record *db.IdempotencyKey, requestHash string) {
+	if record.RequestHash != requestHash {
+		err := util.NewIdempotencyKeyMismatchError(record.Key)
+		ctx.AbortWithStatusJSON(status(err, http.StatusInternalServerError), errorResponse(err))
+		return
+	}
+	var headers map[string]string
+	if len(record.ResponseHeaders) > 0 {
+		if err := json.Unmarshal(record.ResponseHeaders, &headers); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+	contentType := gin.MIMEJSON + "; charset=utf-8"
+	for name, value := range headers {
+		if name == contentTypeHeader {
+			contentType = value
+			continue
+		}
+		ctx.Header(name, value)
+	}
+	ctx.Header(idempotentReplayedHeader, "true")
+	ctx.Data(int(record.ResponseStatus), contentType, record.ResponseBody)
+	ctx.Abort()
+}
+
+func idempotencyKey(ctx *gin.Context, body []byte) string {
+	if key := ctx.GetHeader(idempotencyKeyHeader); key != "" {
+		return key
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	var key string
+	if err := json.Unmarshal(fields[idempotencyKeyField], &key); err != nil {
+		return ""
+	}
+	return key
+}
+
+// hashRequest identifies a request by its method, path and body, ignoring JSON formatting and field order
+func hashRequest(request *http.Request, body []byte) string {
+	var parsed any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&parsed); err == nil {
+		if canonical, err := json.Marshal(parsed); err == nil {
+			body = canonical
+		}
+	}
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+/*
+responseRecorder holds the response of a request made with an idempotency key until it is saved, so that the client
+never gets a response whose changes are then rolled back.
+*/
+type responseRecorder struct {
+	gin.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func newResponseRecorder(writer gin.ResponseWriter) *responseRecorder {
+	return &responseRecorder{
+		ResponseWriter: writer,
+		status:         http.StatusOK,
+		header:         http.Header{},
+	}
+}
+
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *responseRecorder) WriteHeaderNow() {}
+
+func (w *responseRecorder) Flush() {}
+
+func (w *responseRecorder) Status() int {
+	return w.status
+}
+
+func (w *responseRecorder) Size() int {
+	return w.body.Len()
+}
+
+func (w *responseRecorder) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// response is the response to save, with the headers that a replay sends again
+func (w *responseRecorder) response() *db.IdempotentResponse {
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if value := w.header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	return &db.IdempotentResponse{
+		Status:  int32(w.status),
+		Body:    w.body.Bytes(),
+		Headers: headers,
+	}
+}
+
+// send writes the response held by w to the client
+func (w *responseRecorder) send() {
+	header := w.ResponseWriter.Header()
+	for name, values := range w.header {
+		header[name] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		log.Println("error sending idempotent response:", err)
+	}
+}
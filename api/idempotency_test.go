@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"transfers/api/models"
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/testutil"
+	"transfers/util"
+)
+
+func TestIdempotentCreateAccountAPI(t *testing.T) {
+	account := testutil.GenerateAccount()
+	key := "3f1c9a52-6f0e-4d7e-9a51-0c2a3c1d1e7b"
+	body := gin.H{
+		"account_id":      account.ID,
+		"initial_balance": account.Balance,
+	}
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	requestHash := hashRequest(httptest.NewRequest(http.MethodPost, "/accounts", nil), data)
+	storedBody := []byte(`{"account_id":1,"initial_balance":"1.00000"}`)
+
+	testCases := []struct {
+		name          string
+		key           string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "FirstRequest",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg *db.CreateIdempotencyKeyParams, fn db.IdempotentFunc) (*db.IdempotencyKey, error) {
+						require.Equal(t, key, arg.Key)
+						require.Equal(t, requestHash, arg.RequestHash)
+						response, err := fn(ctx)
+						require.NoError(t, err)
+						require.Equal(t, int32(http.StatusCreated), response.Status)
+						require.Equal(t, "application/json; charset=utf-8", response.Headers["Content-Type"])
+						resp := models.CreateAccountResponse{}
+						require.NoError(t, json.Unmarshal(response.Body, &resp))
+						require.Equal(t, account.ID, resp.AccountID)
+						return nil, nil
+					})
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Empty(t, recorder.Header().Get(idempotentReplayedHeader))
+				resp := models.CreateAccountResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, account.ID, resp.AccountID)
+			},
+		},
+		{
+			name: "Replay",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&db.IdempotencyKey{
+						Key:             key,
+						RequestHash:     requestHash,
+						ResponseStatus:  http.StatusCreated,
+						ResponseBody:    storedBody,
+						ResponseHeaders: []byte(`{"Content-Type":"application/json; charset=utf-8","ETag":"\"3\""}`),
+					}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				require.Equal(t, "true", recorder.Header().Get(idempotentReplayedHeader))
+				require.Equal(t, `"3"`, recorder.Header().Get("ETag"))
+				require.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.Equal(t, storedBody, recorder.Body.Bytes())
+			},
+		},
+		{
+			name: "DifferentRequest",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&db.IdempotencyKey{
+						Key:            key,
+						RequestHash:    "another request",
+						ResponseStatus: http.StatusCreated,
+						ResponseBody:   storedBody,
+					}, nil)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "InternalErrorReleasesKey",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg *db.CreateIdempotencyKeyParams, fn db.IdempotentFunc) (*db.IdempotencyKey, error) {
+						response, err := fn(ctx)
+						require.NoError(t, err)
+						require.Nil(t, response)
+						return nil, nil
+					})
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, pgx.ErrTxClosed)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "CommitFailed",
+			key:  key,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, arg *db.CreateIdempotencyKeyParams, fn db.IdempotentFunc) (*db.IdempotencyKey, error) {
+						_, err := fn(ctx)
+						require.NoError(t, err)
+						return nil, util.NewDBError(pgx.ErrTxCommitRollback)
+					})
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				// The response of the handler is never sent, as its changes were not committed
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "account_id")
+			},
+		},
+		{
+			name: "NoKey",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+				store.EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(account, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := "/accounts"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+			if tc.key != "" {
+				request.Header.Set(idempotencyKeyHeader, tc.key)
+			}
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestIdempotentAccountStatusAPI(t *testing.T) {
+	account := testutil.GenerateAccount()
+	account.Status = db.AccountFrozen
+	account.Version = 3
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, arg *db.CreateIdempotencyKeyParams, fn db.IdempotentFunc) (*db.IdempotencyKey, error) {
+			response, err := fn(ctx)
+			require.NoError(t, err)
+			// The ETag is saved with the response, for a replay to send it again
+			require.Equal(t, `"3"`, response.Headers["ETag"])
+			return nil, nil
+		})
+	store.EXPECT().
+		SetAccountStatus(gomock.Any(), gomock.Eq(account.ID), gomock.Eq(db.AccountFrozen)).
+		Times(1).
+		Return(account, nil)
+
+	server := newTestServer(t, store)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/admin/accounts/%d/freeze", account.ID), http.NoBody)
+	require.NoError(t, err)
+	request.Header.Set(idempotencyKeyHeader, "freeze-1")
+
+	server.engine.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, `"3"`, recorder.Header().Get("ETag"))
+}
+
+func TestHashRequest(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/transactions", nil)
+	hash := hashRequest(request, []byte(`{"source_account_id":1,"destination_account_id":2,"amount":"1"}`))
+
+	reordered := hashRequest(request, []byte(`{ "amount": "1", "destination_account_id": 2, "source_account_id": 1 }`))
+	require.Equal(t, hash, reordered)
+
+	changed := hashRequest(request, []byte(`{"source_account_id":1,"destination_account_id":2,"amount":"2"}`))
+	require.NotEqual(t, hash, changed)
+
+	otherPath := hashRequest(httptest.NewRequest(http.MethodPost, "/accounts", nil), []byte(`{"source_account_id":1,"destination_account_id":2,"amount":"1"}`))
+	require.NotEqual(t, hash, otherPath)
+}
@@ -3,10 +3,28 @@ package api
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	db "transfers/db/sqlc"
+	"transfers/util"
 )
 
+var testConfig = util.Config{
+	IdempotencyKeyTTL: time.Hour,
+	TransferStrategy:  db.StrategySSI,
+	FxRounding:        string(util.RoundHalfEven),
+	HoldTTL:           time.Hour,
+}
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	server, err := NewServer(testConfig, store)
+	require.NoError(t, err)
+	return server
+}
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 	os.Exit(m.Run())
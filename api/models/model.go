@@ -1,29 +1,404 @@
 package models
 
+import (
+	"strconv"
+	"time"
+
+	"transfers/util"
+)
+
 type CreateAccountRequest struct {
-	AccountID      int64  `json:"account_id" binding:"required,min=1"`
-	InitialBalance string `json:"initial_balance" binding:"required"`
+	// Allocated by the server when omitted
+	AccountID      int64       `json:"account_id,omitempty" binding:"omitempty,min=1"`
+	InitialBalance *util.Money `json:"initial_balance" binding:"required"`
+	Currency       string      `json:"currency,omitempty" binding:"omitempty,len=3"`
+	// cash (the default), credit or system
+	Type string `json:"type,omitempty" binding:"omitempty,oneof=cash credit system"`
+	// How far below zero a credit account may go, required for credit accounts only
+	CreditLimit    *util.Money `json:"credit_limit,omitempty"`
+	DisplayName    string      `json:"display_name,omitempty" binding:"omitempty,max=255"`
+	OwnerReference string      `json:"owner_reference,omitempty" binding:"omitempty,max=255"`
+	Labels         util.Labels `json:"labels,omitempty" binding:"max=64"`
 }
 type CreateAccountResponse struct {
-	AccountID      int64  `json:"account_id,omitempty"`
-	InitialBalance string `json:"initial_balance,omitempty"`
+	AccountID      int64      `json:"account_id,omitempty"`
+	AccountNumber  string     `json:"account_number,omitempty"`
+	InitialBalance util.Money `json:"initial_balance"`
+	Currency       string     `json:"currency,omitempty"`
+	Type           string     `json:"type,omitempty"`
+	// Lowest the available balance may go, omitted for system accounts which have no floor
+	BalanceFloor   *util.Money `json:"balance_floor,omitempty"`
+	DisplayName    string      `json:"display_name,omitempty"`
+	OwnerReference string      `json:"owner_reference,omitempty"`
+	Labels         util.Labels `json:"labels,omitempty"`
 }
 
 type GetAccountRequest struct {
 	AccountID int64 `uri:"account_id" binding:"required,min=1"`
 }
+type GetAccountByNumberRequest struct {
+	AccountNumber string `uri:"account_number" binding:"required"`
+}
 type GetAccountResponse struct {
-	AccountID int64  `json:"account_id,omitempty"`
-	Balance   string `json:"balance,omitempty"`
+	AccountID     int64  `json:"account_id,omitempty"`
+	AccountNumber string `json:"account_number,omitempty"`
+	// Ledger balance, including the amounts reserved by active holds
+	Balance util.Money `json:"balance"`
+	// Balance that can be transferred or held, down to the floor of the account
+	AvailableBalance util.Money `json:"available_balance"`
+	Currency         string     `json:"currency,omitempty"`
+	// active, frozen or closed
+	Status string `json:"status,omitempty"`
+	// cash, credit or system
+	Type string `json:"type,omitempty"`
+	// Lowest the available balance may go, omitted for system accounts which have no floor
+	BalanceFloor   *util.Money `json:"balance_floor,omitempty"`
+	DisplayName    string      `json:"display_name,omitempty"`
+	OwnerReference string      `json:"owner_reference,omitempty"`
+	Labels         util.Labels `json:"labels,omitempty"`
+	Version        int64       `json:"version"`
+}
+
+// ETag identifies the version of the account, which changes whenever the account does
+func (r *GetAccountResponse) ETag() string {
+	return strconv.Quote(strconv.FormatInt(r.Version, 10))
+}
+
+// UpdateAccountRequest changes the fields that are given, and leaves the others as they are
+type UpdateAccountRequest struct {
+	AccountID      int64   `uri:"account_id" binding:"required,min=1"`
+	DisplayName    *string `json:"display_name" binding:"omitempty,max=255"`
+	OwnerReference *string `json:"owner_reference" binding:"omitempty,max=255"`
+	// Labels to add or change, or to remove when null
+	Labels map[string]*string `json:"labels" binding:"max=64"`
+	// ETag of the version of the account that the change is based on, if it must not overwrite a later change
+	IfMatch string `header:"If-Match" json:"-"`
+}
+
+type ListAccountsRequest struct {
+	Owner string `form:"owner" binding:"omitempty,max=255"`
+	// key:value selectors, all of which the accounts must have
+	Labels []string `form:"label"`
+	Cursor string   `form:"cursor"`
+	Limit  int32    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+type ListAccountsResponse struct {
+	Accounts   []*GetAccountResponse `json:"accounts"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+type GetAccountBalanceRequest struct {
+	AccountID int64 `uri:"account_id" binding:"required,min=1"`
+	// Defaults to now
+	At time.Time `form:"at"`
+}
+type GetAccountBalanceResponse struct {
+	AccountID int64 `json:"account_id"`
+	// Ledger balance after the movements made before At
+	Balance  util.Money `json:"balance"`
+	Currency string     `json:"currency"`
+	At       time.Time  `json:"at"`
+}
+
+type GetAccountStatementRequest struct {
+	AccountID int64 `uri:"account_id" binding:"required,min=1"`
+	// Defaults to when the account was created
+	From time.Time `form:"from"`
+	// Defaults to now
+	To time.Time `form:"to"`
+}
+type GetAccountStatementResponse struct {
+	AccountID int64     `json:"account_id"`
+	Currency  string    `json:"currency"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	// Balances before From and before To
+	OpeningBalance util.Money `json:"opening_balance"`
+	ClosingBalance util.Money `json:"closing_balance"`
+	// Oldest first
+	Movements []*StatementMovementResponse `json:"movements"`
+}
+type StatementMovementResponse struct {
+	TransactionID int64 `json:"transaction_id"`
+	// Account that the money came from or went to, omitted for the debit of a multi-leg transaction
+	CounterpartyAccountID int64 `json:"counterparty_account_id,omitempty"`
+	// Negative for debits, positive for credits
+	Amount util.Money `json:"amount"`
+	// Running balance after the movement
+	Balance           util.Money `json:"balance"`
+	Description       string     `json:"description,omitempty"`
+	ExternalReference string     `json:"external_reference,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+/*
+StatementRecord is a row of an exported statement: the opening balance, each movement, then the closing balance, or
+an error record in place of the closing balance when the statement is cut short
+*/
+type StatementRecord struct {
+	// opening, movement, closing or error
+	Type      string `json:"type"`
+	AccountID int64  `json:"account_id"`
+	Currency  string `json:"currency"`
+	// When the movement was made, or the start or end of the period for the opening and closing balances
+	Time                  time.Time `json:"time"`
+	TransactionID         int64     `json:"transaction_id,omitempty"`
+	CounterpartyAccountID int64     `json:"counterparty_account_id,omitempty"`
+	// Movements only
+	Amount *util.Money `json:"amount,omitempty"`
+	// Balance after the movement, or the opening or closing balance
+	Balance           util.Money `json:"balance"`
+	Description       string     `json:"description,omitempty"`
+	ExternalReference string     `json:"external_reference,omitempty"`
+	// Error records only: why the statement was cut short
+	Error string `json:"error,omitempty"`
+}
+
+type UpdateAccountStatusRequest struct {
+	AccountID int64 `uri:"account_id" binding:"required,min=1"`
 }
 
 type CreateTransactionRequest struct {
-	SourceAccountID      int64  `json:"source_account_id" binding:"required,min=1"`
-	DestinationAccountID int64  `json:"destination_account_id" binding:"required,min=1"`
-	Amount               string `json:"amount" binding:"required"`
+	// Accounts are given by ID or by account number, or both when they agree
+	SourceAccountID          int64       `json:"source_account_id" binding:"omitempty,min=1"`
+	SourceAccountNumber      string      `json:"source_account_number,omitempty" binding:"omitempty,max=20"`
+	DestinationAccountID     int64       `json:"destination_account_id" binding:"omitempty,min=1"`
+	DestinationAccountNumber string      `json:"destination_account_number,omitempty" binding:"omitempty,max=20"`
+	Amount                   *util.Money `json:"amount" binding:"required"`
+	// Currencies of the source and destination accounts, checked against the accounts when given
+	Currency            string `json:"currency,omitempty" binding:"omitempty,len=3"`
+	DestinationCurrency string `json:"destination_currency,omitempty" binding:"omitempty,len=3"`
+	// Destination currency units per source currency unit, required between accounts of different currencies
+	FxRate string `json:"fx_rate,omitempty"`
+	// Why the money moved, for operators
+	Description string `json:"description,omitempty" binding:"max=255"`
+	// Reference of the transfer in the client's system, which transactions can be searched by
+	ExternalReference string `json:"external_reference,omitempty" binding:"max=255"`
+	// JSON object of up to 4 KiB, stored and returned as it is
+	Metadata       util.Metadata `json:"metadata,omitempty"`
+	IdempotencyKey string        `json:"idempotency_key,omitempty" binding:"max=255"`
 }
 type CreateTransactionResponse struct {
-	SourceAccountID      int64  `json:"source_account_id,omitempty"`
-	DestinationAccountID int64  `json:"destination_account_id,omitempty"`
-	Amount               string `json:"amount,omitempty"`
+	TransactionID        int64         `json:"transaction_id,omitempty"`
+	SourceAccountID      int64         `json:"source_account_id,omitempty"`
+	DestinationAccountID int64         `json:"destination_account_id,omitempty"`
+	Amount               util.Money    `json:"amount"`
+	Currency             string        `json:"currency,omitempty"`
+	DestinationAmount    *util.Money   `json:"destination_amount,omitempty"`
+	DestinationCurrency  string        `json:"destination_currency,omitempty"`
+	FxRate               string        `json:"fx_rate,omitempty"`
+	Description          string        `json:"description,omitempty"`
+	ExternalReference    string        `json:"external_reference,omitempty"`
+	Metadata             util.Metadata `json:"metadata,omitempty"`
+	CreatedAt            time.Time     `json:"created_at"`
+}
+
+type CreateTransferBatchRequest struct {
+	// Each transfer is bound on its own, so that a best effort batch reports the malformed ones with their results
+	Transfers []*CreateTransactionRequest `json:"transfers" binding:"required,min=1,max=1000"`
+	// Make the transfers that can be made and report the ones that fail, instead of making none of them
+	BestEffort     bool   `json:"best_effort"`
+	IdempotencyKey string `json:"idempotency_key,omitempty" binding:"max=255"`
+}
+type CreateTransferBatchResponse struct {
+	Succeeded int                    `json:"succeeded"`
+	Failed    int                    `json:"failed"`
+	Results   []*TransferBatchResult `json:"results"`
+}
+type TransferBatchResult struct {
+	// Position of the transfer in the request
+	Index       int                        `json:"index"`
+	Transaction *CreateTransactionResponse `json:"transaction,omitempty"`
+	Error       string                     `json:"error,omitempty"`
+}
+
+// IngestPaymentFileRequest carries a pain.001 file, which is answered with a pain.002 status report
+type IngestPaymentFileRequest struct {
+	Document []byte
+}
+
+type CreateMultiLegTransactionRequest struct {
+	// Accounts are given by ID or by account number, or both when they agree
+	SourceAccountID     int64  `json:"source_account_id" binding:"omitempty,min=1"`
+	SourceAccountNumber string `json:"source_account_number,omitempty" binding:"omitempty,max=20"`
+	// Debited from the source account, which the legs must add up to
+	Amount *util.Money `json:"amount" binding:"required"`
+	// Currency of the source account, checked against the account when given. Every leg is in this currency.
+	Currency       string                         `json:"currency,omitempty" binding:"omitempty,len=3"`
+	Legs           []*CreateTransactionLegRequest `json:"legs" binding:"required,min=1,max=100,dive"`
+	IdempotencyKey string                         `json:"idempotency_key,omitempty" binding:"max=255"`
+}
+type CreateTransactionLegRequest struct {
+	AccountID     int64       `json:"account_id" binding:"omitempty,min=1"`
+	AccountNumber string      `json:"account_number,omitempty" binding:"omitempty,max=20"`
+	Amount        *util.Money `json:"amount" binding:"required"`
+}
+
+type GetTransactionRequest struct {
+	TransactionID int64 `uri:"transaction_id" binding:"required,min=1"`
+}
+
+type GetTransactionNotificationRequest struct {
+	AccountID     int64 `uri:"account_id" binding:"required,min=1"`
+	TransactionID int64 `uri:"transaction_id" binding:"required,min=1"`
+}
+type GetTransactionResponse struct {
+	TransactionID        int64                     `json:"transaction_id,omitempty"`
+	SourceAccountID      int64                     `json:"source_account_id,omitempty"`
+	DestinationAccountID int64                     `json:"destination_account_id,omitempty"`
+	Amount               util.Money                `json:"amount"`
+	Currency             string                    `json:"currency,omitempty"`
+	DestinationAmount    *util.Money               `json:"destination_amount,omitempty"`
+	DestinationCurrency  string                    `json:"destination_currency,omitempty"`
+	FxRate               string                    `json:"fx_rate,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	ExternalReference    string                    `json:"external_reference,omitempty"`
+	Metadata             util.Metadata             `json:"metadata,omitempty"`
+	CreatedAt            time.Time                 `json:"created_at"`
+	ReversalOf           int64                     `json:"reversal_of,omitempty"`
+	ReversedAmount       *util.Money               `json:"reversed_amount,omitempty"`
+	Reversals            []*GetTransactionResponse `json:"reversals,omitempty"`
+	// Every leg of a multi-leg transaction, which has no destination account
+	Legs []*TransactionLegResponse `json:"legs,omitempty"`
+}
+type TransactionLegResponse struct {
+	AccountID int64 `json:"account_id"`
+	// Negative for the debit, positive for credits
+	Amount   util.Money `json:"amount"`
+	Currency string     `json:"currency"`
+}
+
+type CreateReversalRequest struct {
+	TransactionID int64 `uri:"transaction_id" binding:"required,min=1"`
+	// In the currency of the original source account
+	Amount *util.Money `json:"amount,omitempty"`
+}
+type CreateReversalResponse struct {
+	TransactionID        int64       `json:"transaction_id,omitempty"`
+	ReversalOf           int64       `json:"reversal_of,omitempty"`
+	SourceAccountID      int64       `json:"source_account_id,omitempty"`
+	DestinationAccountID int64       `json:"destination_account_id,omitempty"`
+	Amount               util.Money  `json:"amount"`
+	Currency             string      `json:"currency,omitempty"`
+	DestinationAmount    *util.Money `json:"destination_amount,omitempty"`
+	DestinationCurrency  string      `json:"destination_currency,omitempty"`
+	FxRate               string      `json:"fx_rate,omitempty"`
+	CreatedAt            time.Time   `json:"created_at"`
+}
+
+type ListTransactionsRequest struct {
+	ExternalReference string `form:"external_reference" binding:"required,max=255"`
+	Cursor            string `form:"cursor"`
+	Limit             int32  `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+type ListTransactionsResponse struct {
+	Transactions []*GetTransactionResponse `json:"transactions"`
+	NextCursor   string                    `json:"next_cursor,omitempty"`
+}
+
+type ListAccountTransactionsRequest struct {
+	AccountID int64       `uri:"account_id" binding:"required,min=1"`
+	Direction string      `form:"direction" binding:"omitempty,oneof=incoming outgoing"`
+	From      time.Time   `form:"from"`
+	To        time.Time   `form:"to"`
+	MinAmount *util.Money `form:"min_amount"`
+	MaxAmount *util.Money `form:"max_amount"`
+	Cursor    string      `form:"cursor"`
+	Limit     int32       `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+type ListAccountTransactionsResponse struct {
+	Transactions []*GetTransactionResponse `json:"transactions"`
+	NextCursor   string                    `json:"next_cursor,omitempty"`
+}
+
+type CreateHoldRequest struct {
+	// Accounts are given by ID or by account number, or both when they agree
+	AccountID                int64       `json:"account_id" binding:"omitempty,min=1"`
+	AccountNumber            string      `json:"account_number,omitempty" binding:"omitempty,max=20"`
+	DestinationAccountID     int64       `json:"destination_account_id" binding:"omitempty,min=1"`
+	DestinationAccountNumber string      `json:"destination_account_number,omitempty" binding:"omitempty,max=20"`
+	Amount                   *util.Money `json:"amount" binding:"required"`
+	// Currency of the held account, checked against the account when given
+	Currency string `json:"currency,omitempty" binding:"omitempty,len=3"`
+	// Defaults to the configured hold TTL from now
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+type GetHoldRequest struct {
+	HoldID int64 `uri:"hold_id" binding:"required,min=1"`
+}
+type GetHoldResponse struct {
+	HoldID               int64       `json:"hold_id,omitempty"`
+	AccountID            int64       `json:"account_id,omitempty"`
+	DestinationAccountID int64       `json:"destination_account_id,omitempty"`
+	Amount               util.Money  `json:"amount"`
+	Currency             string      `json:"currency,omitempty"`
+	Status               string      `json:"status,omitempty"`
+	CapturedAmount       *util.Money `json:"captured_amount,omitempty"`
+	TransactionID        int64       `json:"transaction_id,omitempty"`
+	ExpiresAt            time.Time   `json:"expires_at"`
+	CreatedAt            time.Time   `json:"created_at"`
+}
+
+type CaptureHoldRequest struct {
+	HoldID int64 `uri:"hold_id" binding:"required,min=1"`
+	// In the currency of the held account, or the whole hold when omitted
+	Amount *util.Money `json:"amount,omitempty"`
+}
+
+type VoidHoldRequest struct {
+	HoldID int64 `uri:"hold_id" binding:"required,min=1"`
+}
+
+type CreateScheduledTransferRequest struct {
+	// Accounts are given by ID or by account number, or both when they agree
+	SourceAccountID          int64       `json:"source_account_id" binding:"omitempty,min=1"`
+	SourceAccountNumber      string      `json:"source_account_number,omitempty" binding:"omitempty,max=20"`
+	DestinationAccountID     int64       `json:"destination_account_id" binding:"omitempty,min=1"`
+	DestinationAccountNumber string      `json:"destination_account_number,omitempty" binding:"omitempty,max=20"`
+	Amount                   *util.Money `json:"amount" binding:"required"`
+	// Currency of the source account, checked against the account when given
+	Currency string `json:"currency,omitempty" binding:"omitempty,len=3"`
+	// Time of the first occurrence, later ones recur from it
+	ExecuteAt  time.Time `json:"execute_at" binding:"required"`
+	Recurrence string    `json:"recurrence,omitempty" binding:"omitempty,oneof=once daily weekly monthly"`
+	// No occurrences after EndAt, or after MaxOccurrences of them, when given
+	EndAt          time.Time `json:"end_at,omitempty"`
+	MaxOccurrences int32     `json:"max_occurrences,omitempty" binding:"omitempty,min=1"`
+	IdempotencyKey string    `json:"idempotency_key,omitempty"`
+}
+
+type GetScheduledTransferRequest struct {
+	ScheduledTransferID int64 `uri:"scheduled_transfer_id" binding:"required,min=1"`
+}
+type GetScheduledTransferResponse struct {
+	ScheduledTransferID  int64      `json:"scheduled_transfer_id,omitempty"`
+	SourceAccountID      int64      `json:"source_account_id,omitempty"`
+	DestinationAccountID int64      `json:"destination_account_id,omitempty"`
+	Amount               util.Money `json:"amount"`
+	Currency             string     `json:"currency,omitempty"`
+	Recurrence           string     `json:"recurrence,omitempty"`
+	ExecuteAt            time.Time  `json:"execute_at"`
+	EndAt                *time.Time `json:"end_at,omitempty"`
+	MaxOccurrences       int32      `json:"max_occurrences,omitempty"`
+	Occurrences          int32      `json:"occurrences"`
+	Status               string     `json:"status,omitempty"`
+	NextRunAt            *time.Time `json:"next_run_at,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+}
+
+type ListScheduledTransferRunsRequest struct {
+	ScheduledTransferID int64 `uri:"scheduled_transfer_id" binding:"required,min=1"`
+}
+type ListScheduledTransferRunsResponse struct {
+	Runs []*ScheduledTransferRunResponse `json:"runs"`
+}
+type ScheduledTransferRunResponse struct {
+	RunID         int64     `json:"run_id,omitempty"`
+	Occurrence    int32     `json:"occurrence"`
+	Attempt       int32     `json:"attempt"`
+	Status        string    `json:"status,omitempty"`
+	TransactionID int64     `json:"transaction_id,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
 }
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"transfers/api/models"
+	"transfers/service"
+)
+
+// Payment files of 1000 credit transfers take well under this
+const maxPaymentFileSize = 8 << 20
+
+// postPaymentFile makes the payments of the pain.001 file in the body, and responds with its pain.002 status report
+func postPaymentFile(svc *service.IngestPaymentFileService) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		document, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxPaymentFileSize))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		req := &models.IngestPaymentFileRequest{Document: document}
+		if err = svc.Validate(ctx, req); err != nil {
+			ctx.JSON(status(err, http.StatusBadRequest), errorResponse(err))
+			return
+		}
+		report, err := svc.Do(ctx, req)
+		if err != nil {
+			ctx.JSON(status(err, http.StatusInternalServerError), errorResponse(err))
+			return
+		}
+		ctx.Data(http.StatusOK, gin.MIMEXML+"; charset=utf-8", report)
+	}
+}
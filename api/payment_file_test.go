@@ -0,0 +1,278 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+// paymentFile is a pain.001 file of two transfers from account 1 to accounts 2 and 3, to be made on executionDate
+func paymentFile(controlSum string, executionDate string) string {
+	transfer := `
+      <CdtTrfTxInf>
+        <PmtId><InstrId>%d</InstrId><EndToEndId>e2e-%d</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="USD">%s</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>%s</Id></Othr></Id></CdtrAcct>
+        <RmtInf><Ustrd>Invoice %d</Ustrd></RmtInf>
+      </CdtTrfTxInf>`
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.09">
+  <CstmrCdtTrfInitn>
+    <GrpHdr><MsgId>MSG-1</MsgId><CreDtTm>2024-03-01T08:00:00</CreDtTm><NbOfTxs>2</NbOfTxs><CtrlSum>%s</CtrlSum></GrpHdr>
+    <PmtInf>
+      <PmtInfId>PMT-1</PmtInfId>
+      <PmtMtd>TRF</PmtMtd>
+      <ReqdExctnDt><Dt>%s</Dt></ReqdExctnDt>
+      <DbtrAcct><Id><Othr><Id>00000000018</Id></Othr></Id></DbtrAcct>%s%s
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`, controlSum, executionDate,
+		fmt.Sprintf(transfer, 1, 1, "10.00", util.AccountNumber(2), 1),
+		fmt.Sprintf(transfer, 2, 2, "5.50", util.AccountNumber(3), 2))
+}
+
+func TestIngestPaymentFileAPI(t *testing.T) {
+	file := paymentFile("15.50", "2024-03-01")
+	hash := sha256.Sum256([]byte(file))
+	requestHash := hex.EncodeToString(hash[:])
+	key := "pain.001:MSG-1"
+	futureFile := paymentFile("15.50", time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02"))
+	invalidDateFile := paymentFile("15.50", "2024-02-30")
+
+	stubAccounts := func(store *mockdb.MockStore) {
+		for _, id := range []int64{1, 2, 3} {
+			account := &db.Account{ID: id, Currency: "USD", Status: db.AccountActive}
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(id)).AnyTimes().Return(account, nil)
+		}
+	}
+
+	// recordPayments stubs recording the message ID of body with the payments that the file makes, then committing them
+	recordPayments := func(store *mockdb.MockStore, body string, commitErr error) {
+		hash := sha256.Sum256([]byte(body))
+		store.EXPECT().
+			DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(ctx context.Context, arg *db.CreateIdempotencyKeyParams, fn db.IdempotentFunc) (*db.IdempotencyKey, error) {
+				require.Equal(t, key, arg.Key)
+				require.Equal(t, hex.EncodeToString(hash[:]), arg.RequestHash)
+				response, err := fn(ctx)
+				if err != nil {
+					return nil, err
+				}
+				require.Equal(t, int32(http.StatusOK), response.Status)
+				return nil, commitErr
+			})
+	}
+
+	testCases := []struct {
+		name          string
+		body          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: file,
+			buildStubs: func(store *mockdb.MockStore) {
+				recordPayments(store, file, nil)
+				stubAccounts(store)
+				store.EXPECT().
+					CreateTransactionBatch(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateTransactionBatchParams) ([]*db.TransferBatchResult, error) {
+						require.True(t, arg.BestEffort)
+						require.Len(t, arg.Transfers, 2)
+						require.Equal(t, "e2e-1", arg.Transfers[0].ExternalReference)
+						require.Equal(t, "Invoice 1", arg.Transfers[0].Description)
+						require.JSONEq(t, `{"pain001": {"message_id": "MSG-1", "payment_information_id": "PMT-1", "instruction_id": "1"}}`, string(arg.Transfers[0].Metadata))
+						return []*db.TransferBatchResult{
+							{Transaction: &db.Transaction{ID: 41}},
+							{Err: util.NewInsufficientBalanceError()},
+						}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				body := recorder.Body.String()
+				require.Contains(t, body, "<GrpSts>PART</GrpSts>")
+				require.Contains(t, body, "<AcctSvcrRef>41</AcctSvcrRef>")
+				require.Contains(t, body, "<Cd>AM04</Cd>")
+			},
+		},
+		{
+			name: "SameFileAgain",
+			body: file,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&db.IdempotencyKey{Key: key, RequestHash: requestHash, ResponseStatus: 200, ResponseBody: []byte("<Document/>")}, nil)
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "<Document/>", recorder.Body.String())
+			},
+		},
+		{
+			name: "DuplicateMessageID",
+			body: file,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&db.IdempotencyKey{Key: key, RequestHash: "other", ResponseStatus: 200}, nil)
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				body := recorder.Body.String()
+				require.Contains(t, body, "<GrpSts>RJCT</GrpSts>")
+				require.Contains(t, body, "<Cd>DU01</Cd>")
+			},
+		},
+		{
+			name: "InProgress",
+			body: file,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewIdempotencyKeyInProgressError(key))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "ControlSumMismatch",
+			body: paymentFile("16.00", "2024-03-01"),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				body := recorder.Body.String()
+				require.Contains(t, body, "<GrpSts>RJCT</GrpSts>")
+				require.Contains(t, body, "<Cd>AM10</Cd>")
+			},
+		},
+		{
+			name: "FutureExecutionDate",
+			body: futureFile,
+			buildStubs: func(store *mockdb.MockStore) {
+				recordPayments(store, futureFile, nil)
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				body := recorder.Body.String()
+				require.Contains(t, body, "<GrpSts>RJCT</GrpSts>")
+				require.Equal(t, 2, strings.Count(body, "<Cd>CH03</Cd>"))
+			},
+		},
+		{
+			name: "InvalidExecutionDate",
+			body: invalidDateFile,
+			buildStubs: func(store *mockdb.MockStore) {
+				recordPayments(store, invalidDateFile, nil)
+				store.EXPECT().CreateTransactionBatch(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "<Cd>DT01</Cd>")
+			},
+		},
+		{
+			name: "BatchFails",
+			body: file,
+			buildStubs: func(store *mockdb.MockStore) {
+				recordPayments(store, file, nil)
+				stubAccounts(store)
+				store.EXPECT().
+					CreateTransactionBatch(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewDBError(errors.New("connection lost")))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			// The message ID is rolled back with the payments, so the file can be sent again
+			name: "CommitFails",
+			body: file,
+			buildStubs: func(store *mockdb.MockStore) {
+				recordPayments(store, file, util.NewDBError(errors.New("connection lost")))
+				stubAccounts(store)
+				store.EXPECT().
+					CreateTransactionBatch(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return([]*db.TransferBatchResult{{Transaction: &db.Transaction{ID: 41}}, {Transaction: &db.Transaction{ID: 42}}}, nil)
+				store.EXPECT().DeleteIdempotencyKey(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "NotPain001",
+			body: `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"/>`,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Empty",
+			body: "",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().DoIdempotent(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, "/payment-files", bytes.NewReader([]byte(tc.body)))
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", "application/xml")
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"transfers/api/models"
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/testutil"
+	"transfers/util"
+)
+
+func TestCreateScheduledTransferAPI(t *testing.T) {
+	source := testutil.GenerateAccount()
+	destination := testutil.GenerateAccount()
+	destination.ID = source.ID + 1
+	executeAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	endAt := executeAt.AddDate(0, 6, 0)
+	scheduled := testutil.GenerateScheduledTransfer()
+	scheduled.SourceAccountID, scheduled.DestinationAccountID = source.ID, destination.ID
+	scheduled.Amount = util.MustParseMoney("1.50000")
+	scheduled.Recurrence = db.RecurrenceMonthly
+	scheduled.StartAt = executeAt
+	scheduled.EndAt = pgtype.Timestamptz{Time: endAt, Valid: true}
+	scheduled.NextRunAt = pgtype.Timestamptz{Time: executeAt, Valid: true}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             executeAt,
+				"recurrence":             db.RecurrenceMonthly,
+				"end_at":                 endAt,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				arg := &db.CreateScheduledTransferParams{
+					SourceAccountID:      source.ID,
+					DestinationAccountID: destination.ID,
+					Amount:               util.MustParseMoney("1.50000"),
+					Currency:             "USD",
+					Recurrence:           db.RecurrenceMonthly,
+					StartAt:              executeAt,
+					EndAt:                pgtype.Timestamptz{Time: endAt, Valid: true},
+				}
+				store.EXPECT().
+					CreateScheduledTransfer(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(scheduled, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.GetScheduledTransferResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, scheduled.ID, resp.ScheduledTransferID)
+				require.Equal(t, "1.50", resp.Amount.String())
+				require.Equal(t, db.RecurrenceMonthly, resp.Recurrence)
+				require.Equal(t, db.ScheduleActive, resp.Status)
+				require.True(t, executeAt.Equal(*resp.NextRunAt))
+				require.True(t, endAt.Equal(*resp.EndAt))
+			},
+		},
+		{
+			name: "DefaultsToOnce",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             executeAt,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(2).Return(source, nil)
+				store.EXPECT().
+					CreateScheduledTransfer(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateScheduledTransferParams) (*db.ScheduledTransfer, error) {
+						require.Equal(t, db.RecurrenceOnce, arg.Recurrence)
+						require.False(t, arg.EndAt.Valid)
+						require.False(t, arg.MaxOccurrences.Valid)
+						return scheduled, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "ExecuteAtInPast",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             time.Now().Add(-time.Minute),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "EndBeforeStart",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             executeAt,
+				"recurrence":             db.RecurrenceDaily,
+				"end_at":                 executeAt.Add(-time.Minute),
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "MaxOccurrencesOnce",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             executeAt,
+				"max_occurrences":        3,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidRecurrence",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             executeAt,
+				"recurrence":             "hourly",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "SourceNotFound",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             executeAt,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "CrossCurrencyWithoutRate",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"execute_at":             executeAt,
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				yen := *destination
+				yen.Currency = "JPY"
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(&yen, nil)
+				store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(2).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/scheduled-transfers", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetScheduledTransferAPI(t *testing.T) {
+	scheduled := testutil.GenerateScheduledTransfer()
+	scheduled.Occurrences = 1
+	scheduled.NextRunAt = pgtype.Timestamptz{}
+	scheduled.Status = db.ScheduleCompleted
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+	store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID+1)).Times(1).Return(nil, pgx.ErrNoRows)
+	server := newTestServer(t, store)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID), nil)
+	require.NoError(t, err)
+	server.engine.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	resp := models.GetScheduledTransferResponse{}
+	testutil.UnmarshalToResp(t, recorder.Body, &resp)
+	require.Equal(t, db.ScheduleCompleted, resp.Status)
+	require.Equal(t, int32(1), resp.Occurrences)
+	require.Nil(t, resp.NextRunAt)
+
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID+1), nil)
+	require.NoError(t, err)
+	server.engine.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestListScheduledTransferRunsAPI(t *testing.T) {
+	scheduled := testutil.GenerateScheduledTransfer()
+	runs := []*db.ScheduledTransferRun{
+		{
+			ID:                  1,
+			ScheduledTransferID: scheduled.ID,
+			Occurrence:          1,
+			Attempt:             1,
+			Status:              db.RunFailed,
+			Error:               util.NewInsufficientBalanceError().Error(),
+			CreatedAt:           time.Now(),
+		},
+		{
+			ID:                  2,
+			ScheduledTransferID: scheduled.ID,
+			Occurrence:          1,
+			Attempt:             2,
+			Status:              db.RunSucceeded,
+			TransactionID:       pgtype.Int8{Int64: 7, Valid: true},
+			CreatedAt:           time.Now(),
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+	store.EXPECT().ListScheduledTransferRuns(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(runs, nil)
+	store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID+1)).Times(1).Return(nil, pgx.ErrNoRows)
+	store.EXPECT().ListScheduledTransferRuns(gomock.Any(), gomock.Eq(scheduled.ID+1)).Times(0)
+	server := newTestServer(t, store)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/scheduled-transfers/%d/runs", scheduled.ID), nil)
+	require.NoError(t, err)
+	server.engine.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	resp := models.ListScheduledTransferRunsResponse{}
+	testutil.UnmarshalToResp(t, recorder.Body, &resp)
+	require.Len(t, resp.Runs, 2)
+	require.Equal(t, db.RunFailed, resp.Runs[0].Status)
+	require.Contains(t, resp.Runs[0].Error, "insufficient balance")
+	require.Zero(t, resp.Runs[0].TransactionID)
+	require.Equal(t, db.RunSucceeded, resp.Runs[1].Status)
+	require.Equal(t, int32(2), resp.Runs[1].Attempt)
+	require.Equal(t, int64(7), resp.Runs[1].TransactionID)
+
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, fmt.Sprintf("/scheduled-transfers/%d/runs", scheduled.ID+1), nil)
+	require.NoError(t, err)
+	server.engine.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
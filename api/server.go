@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/joomcode/errorx"
 
 	"transfers/api/models"
@@ -14,20 +15,56 @@ import (
 )
 
 type Server struct {
+	config util.Config
 	store  db.Store
 	engine *gin.Engine
 }
 
-func NewServer(store db.Store) *Server {
-	server := &Server{store: store}
+func NewServer(config util.Config, store db.Store) (*Server, error) {
+	strategy, err := db.NewTransferStrategy(store, config.TransferStrategy, config.TransferRetryPolicies[config.TransferStrategy])
+	if err != nil {
+		return nil, err
+	}
+	rounding, err := util.ParseRoundingMode(config.FxRounding)
+	if err != nil {
+		return nil, err
+	}
+	server := &Server{config: config, store: store}
 	router := gin.Default()
+	// Services get the request context through gin's, as idempotent requests carry their DB transaction in it
+	router.ContextWithFallback = true
 
-	router.POST("/accounts", post[models.CreateAccountRequest, models.CreateAccountResponse](&service.CreateAccountService{Store: store}))
+	router.POST("/accounts", server.idempotent, post[models.CreateAccountRequest, models.CreateAccountResponse](&service.CreateAccountService{Store: store}))
+	router.GET("/accounts", get[models.ListAccountsRequest, models.ListAccountsResponse](&service.ListAccountsService{Store: store}))
+	router.GET("/accounts/by-number/:account_number", get[models.GetAccountByNumberRequest, models.GetAccountResponse](&service.GetAccountByNumberService{Store: store}))
 	router.GET("/accounts/:account_id", get[models.GetAccountRequest, models.GetAccountResponse](&service.GetAccountService{Store: store}))
-	router.POST("/transactions", post[models.CreateTransactionRequest, models.CreateTransactionResponse](&service.CreateTransactionService{Store: store}))
+	router.PATCH("/accounts/:account_id", patch[models.UpdateAccountRequest, models.GetAccountResponse](&service.UpdateAccountService{Store: store}))
+	router.POST("/admin/accounts/:account_id/freeze", server.idempotent, post[models.UpdateAccountStatusRequest, models.GetAccountResponse](&service.UpdateAccountStatusService{Store: store, Status: db.AccountFrozen}))
+	router.POST("/admin/accounts/:account_id/unfreeze", server.idempotent, post[models.UpdateAccountStatusRequest, models.GetAccountResponse](&service.UpdateAccountStatusService{Store: store, Status: db.AccountActive}))
+	router.POST("/admin/accounts/:account_id/close", server.idempotent, post[models.UpdateAccountStatusRequest, models.GetAccountResponse](&service.UpdateAccountStatusService{Store: store, Status: db.AccountClosed}))
+	router.GET("/accounts/:account_id/balance", get[models.GetAccountBalanceRequest, models.GetAccountBalanceResponse](&service.GetAccountBalanceService{Store: store}))
+	router.GET("/accounts/:account_id/statement", getAccountStatement(store))
+	router.GET("/accounts/:account_id/transactions/:transaction_id/notification", getDocument[models.GetTransactionNotificationRequest](&service.ExportCamt054Service{Store: store}, gin.MIMEXML))
+	router.GET("/accounts/:account_id/transactions", get[models.ListAccountTransactionsRequest, models.ListAccountTransactionsResponse](&service.ListAccountTransactionsService{Store: store}))
+	router.POST("/transactions", server.idempotent, post[models.CreateTransactionRequest, models.CreateTransactionResponse](&service.CreateTransactionService{Store: store, Strategy: strategy, Rounding: rounding}))
+	router.POST("/transactions/multi-leg", server.idempotent, post[models.CreateMultiLegTransactionRequest, models.GetTransactionResponse](&service.CreateMultiLegTransactionService{Store: store}))
+	router.POST("/transfer-batches", server.idempotent, post[models.CreateTransferBatchRequest, models.CreateTransferBatchResponse](&service.CreateTransferBatchService{Store: store, Rounding: rounding}))
+	router.POST("/payment-files", postPaymentFile(&service.IngestPaymentFileService{Store: store, Rounding: rounding, TTL: config.IdempotencyKeyTTL}))
+	router.GET("/transactions", get[models.ListTransactionsRequest, models.ListTransactionsResponse](&service.ListTransactionsService{Store: store}))
+	router.GET("/transactions/:transaction_id", get[models.GetTransactionRequest, models.GetTransactionResponse](&service.GetTransactionService{Store: store}))
+	router.POST("/transactions/:transaction_id/reversals", server.idempotent, post[models.CreateReversalRequest, models.CreateReversalResponse](&service.CreateReversalService{Store: store, Rounding: rounding}))
+
+	router.POST("/holds", server.idempotent, post[models.CreateHoldRequest, models.GetHoldResponse](&service.CreateHoldService{Store: store, TTL: config.HoldTTL}))
+	router.GET("/holds/:hold_id", get[models.GetHoldRequest, models.GetHoldResponse](&service.GetHoldService{Store: store}))
+	router.POST("/holds/:hold_id/capture", server.idempotent, post[models.CaptureHoldRequest, models.GetHoldResponse](&service.CaptureHoldService{Store: store, Rounding: rounding}))
+	router.POST("/holds/:hold_id/void", server.idempotent, post[models.VoidHoldRequest, models.GetHoldResponse](&service.VoidHoldService{Store: store}))
+
+	router.POST("/scheduled-transfers", server.idempotent, post[models.CreateScheduledTransferRequest, models.GetScheduledTransferResponse](&service.CreateScheduledTransferService{Store: store}))
+	router.GET("/scheduled-transfers/:scheduled_transfer_id", get[models.GetScheduledTransferRequest, models.GetScheduledTransferResponse](&service.GetScheduledTransferService{Store: store}))
+	router.GET("/scheduled-transfers/:scheduled_transfer_id/runs", get[models.ListScheduledTransferRunsRequest, models.ListScheduledTransferRunsResponse](&service.ListScheduledTransferRunsService{Store: store}))
 
 	server.engine = router
-	return server
+	return server, nil
 }
 
 func (s *Server) Run(address string) error {
@@ -42,7 +79,7 @@ type Service[Request, Response any] interface {
 func get[Req, Resp any](svc Service[Req, Resp]) func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
 		var req Req
-		if err := ctx.ShouldBindUri(&req); err != nil {
+		if err := bindQuery(ctx, &req); err != nil {
 			ctx.JSON(http.StatusBadRequest, errorResponse(err))
 			return
 		}
@@ -55,14 +92,49 @@ func get[Req, Resp any](svc Service[Req, Resp]) func(ctx *gin.Context) {
 			ctx.JSON(status(err, http.StatusInternalServerError), errorResponse(err))
 			return
 		}
+		if tagged, ok := any(resp).(etagger); ok && !checkPreconditions(ctx, tagged.ETag()) {
+			return
+		}
 		ctx.JSON(http.StatusOK, resp)
 	}
 }
 
+// DocumentService renders a request as a document in some format, such as an ISO 20022 message
+type DocumentService[Request any] interface {
+	Validate(context.Context, *Request) error
+	Do(context.Context, *Request) ([]byte, error)
+}
+
+// getDocument is like get, for services that respond with a document of contentType instead of JSON
+func getDocument[Req any](svc DocumentService[Req], contentType string) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		var req Req
+		if err := bindQuery(ctx, &req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if err := svc.Validate(ctx, &req); err != nil {
+			ctx.JSON(status(err, http.StatusBadRequest), errorResponse(err))
+			return
+		}
+		document, err := svc.Do(ctx, &req)
+		if err != nil {
+			ctx.JSON(status(err, http.StatusInternalServerError), errorResponse(err))
+			return
+		}
+		ctx.Data(http.StatusOK, contentType+"; charset=utf-8", document)
+	}
+}
+
 func post[Req, Resp any](svc Service[Req, Resp]) func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
 		var req Req
-		if err := ctx.ShouldBindJSON(&req); err != nil {
+		// URI params are mapped first and validated together with the JSON body
+		if err := bindUri(ctx, &req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if err := bindJSON(ctx, &req); err != nil {
 			ctx.JSON(http.StatusBadRequest, errorResponse(err))
 			return
 		}
@@ -75,10 +147,70 @@ func post[Req, Resp any](svc Service[Req, Resp]) func(ctx *gin.Context) {
 			ctx.JSON(status(err, http.StatusInternalServerError), errorResponse(err))
 			return
 		}
+		if tagged, ok := any(resp).(etagger); ok {
+			ctx.Header("ETag", tagged.ETag())
+		}
 		ctx.JSON(http.StatusCreated, resp)
 	}
 }
 
+// patch is like post, for changes to an existing resource, which respond with the changed resource and its ETag
+func patch[Req, Resp any](svc Service[Req, Resp]) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		var req Req
+		if err := bindUri(ctx, &req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if err := bindJSON(ctx, &req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		// Conditional headers such as If-Match are left to the service, which checks them as it makes the change
+		if err := ctx.ShouldBindHeader(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if err := svc.Validate(ctx, &req); err != nil {
+			ctx.JSON(status(err, http.StatusBadRequest), errorResponse(err))
+			return
+		}
+		resp, err := svc.Do(ctx, &req)
+		if err != nil {
+			ctx.JSON(status(err, http.StatusInternalServerError), errorResponse(err))
+			return
+		}
+		if tagged, ok := any(resp).(etagger); ok {
+			ctx.Header("ETag", tagged.ETag())
+		}
+		ctx.JSON(http.StatusOK, resp)
+	}
+}
+
+// bindQuery binds the query params and URI params of a GET, which are mapped first so that they cannot override URI params
+func bindQuery(ctx *gin.Context, req any) error {
+	if err := binding.MapFormWithTag(req, ctx.Request.URL.Query(), "form"); err != nil {
+		return err
+	}
+	return ctx.ShouldBindUri(req)
+}
+
+func bindUri(ctx *gin.Context, req any) error {
+	params := make(map[string][]string, len(ctx.Params))
+	for _, param := range ctx.Params {
+		params[param.Key] = []string{param.Value}
+	}
+	return binding.MapFormWithTag(req, params, "uri")
+}
+
+// bindJSON binds and validates the JSON body, which actions such as voiding a hold may leave out
+func bindJSON(ctx *gin.Context, req any) error {
+	if ctx.Request.ContentLength == 0 {
+		return binding.Validator.ValidateStruct(req)
+	}
+	return ctx.ShouldBindJSON(req)
+}
+
 func status(err error, fallback int) int {
 	if err == nil {
 		return http.StatusOK
@@ -88,6 +220,12 @@ func status(err error, fallback int) int {
 		return http.StatusBadRequest
 	case errorx.HasTrait(err, errorx.NotFound()):
 		return http.StatusNotFound
+	case errorx.HasTrait(err, util.Conflict):
+		return http.StatusConflict
+	case errorx.HasTrait(err, util.Unprocessable):
+		return http.StatusUnprocessableEntity
+	case errorx.HasTrait(err, util.Precondition):
+		return http.StatusPreconditionFailed
 	case errorx.HasTrait(err, util.PaymentRequired):
 		return http.StatusPaymentRequired
 	case errorx.IsOfType(err, errorx.ExternalError):
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/service"
+	"transfers/util"
+)
+
+// Media types that statements are exported in
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+	mimeMT940  = "application/x-mt940"
+	mimeOFX    = "application/x-ofx"
+)
+
+var statementCSVHeader = []string{
+	"type", "account_id", "currency", "time", "transaction_id", "counterparty_account_id",
+	"amount", "balance", "description", "external_reference",
+}
+
+/*
+getAccountStatement responds with the statement of an account as JSON, as an ISO 20022 camt.053 statement or as an
+MT940 or OFX statement, or streams it as CSV or JSON Lines, as the Accept header asks. Streamed statements are written
+as their rows are read, so that the statement of a busy account is never held in memory. Errors found before the first
+row get an error response; after it the response has already started, so the statement ends with an error record in
+place of its closing record, which CSV statements give the message of in the description column.
+*/
+func getAccountStatement(store db.Store) gin.HandlerFunc {
+	asJSON := get[models.GetAccountStatementRequest, models.GetAccountStatementResponse](&service.GetAccountStatementService{Store: store})
+	asCamt053 := getDocument[models.GetAccountStatementRequest](&service.ExportCamt053Service{Store: store}, gin.MIMEXML)
+	asMT940 := getDocument[models.GetAccountStatementRequest](&service.ExportMT940Service{Store: store}, mimeMT940)
+	asOFX := getDocument[models.GetAccountStatementRequest](&service.ExportOFXService{Store: store}, mimeOFX)
+	svc := &service.ExportAccountStatementService{Store: store}
+	return func(ctx *gin.Context) {
+		format := ctx.NegotiateFormat(gin.MIMEJSON, mimeCSV, mimeNDJSON, gin.MIMEXML, gin.MIMEXML2, mimeMT940, mimeOFX)
+		switch format {
+		case gin.MIMEJSON:
+			asJSON(ctx)
+			return
+		case gin.MIMEXML, gin.MIMEXML2:
+			asCamt053(ctx)
+			return
+		case mimeMT940:
+			asMT940(ctx)
+			return
+		case mimeOFX:
+			asOFX(ctx)
+			return
+		case "":
+			ctx.JSON(http.StatusNotAcceptable, errorResponse(util.NewNotAcceptableError(ctx.GetHeader("Accept"))))
+			return
+		}
+
+		var req models.GetAccountStatementRequest
+		if err := bindQuery(ctx, &req); err != nil {
+			ctx.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		if err := svc.Validate(ctx, &req); err != nil {
+			ctx.JSON(status(err, http.StatusBadRequest), errorResponse(err))
+			return
+		}
+		w := newStatementStream(ctx, format, req.AccountID)
+		err := svc.Do(ctx, &req, w)
+		if err != nil && !w.started {
+			ctx.JSON(status(err, http.StatusInternalServerError), errorResponse(err))
+			return
+		}
+		if err != nil {
+			_ = ctx.Error(err)
+		}
+		w.flush()
+	}
+}
+
+// statementStream writes statement records to the response in CSV or JSON Lines, starting the response with the first record
+type statementStream struct {
+	ctx      *gin.Context
+	format   string
+	filename string
+	csv      *csv.Writer
+	json     *json.Encoder
+	started  bool
+}
+
+func newStatementStream(ctx *gin.Context, format string, accountID int64) *statementStream {
+	w := &statementStream{ctx: ctx, format: format}
+	if format == mimeCSV {
+		w.csv = csv.NewWriter(ctx.Writer)
+		w.filename = fmt.Sprintf("statement-%d.csv", accountID)
+	} else {
+		w.json = json.NewEncoder(ctx.Writer)
+		w.json.SetEscapeHTML(false)
+		w.filename = fmt.Sprintf("statement-%d.jsonl", accountID)
+	}
+	return w
+}
+
+func (w *statementStream) Write(record *models.StatementRecord) error {
+	if !w.started {
+		w.start()
+	}
+	if w.csv != nil {
+		return w.csv.Write(toStatementCSVRow(record))
+	}
+	return w.json.Encode(record)
+}
+
+func (w *statementStream) start() {
+	w.started = true
+	w.ctx.Header("Content-Type", w.format+"; charset=utf-8")
+	w.ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.filename))
+	w.ctx.Status(http.StatusOK)
+	if w.csv != nil {
+		_ = w.csv.Write(statementCSVHeader)
+	}
+}
+
+func (w *statementStream) flush() {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+	w.ctx.Writer.Flush()
+}
+
+func toStatementCSVRow(record *models.StatementRecord) []string {
+	row := []string{
+		record.Type,
+		strconv.FormatInt(record.AccountID, 10),
+		record.Currency,
+		record.Time.UTC().Format(time.RFC3339Nano),
+		"",
+		"",
+		"",
+		record.Balance.String(),
+		csvText(record.Description),
+		csvText(record.ExternalReference),
+	}
+	if record.TransactionID != 0 {
+		row[4] = strconv.FormatInt(record.TransactionID, 10)
+	}
+	if record.CounterpartyAccountID != 0 {
+		row[5] = strconv.FormatInt(record.CounterpartyAccountID, 10)
+	}
+	if record.Amount != nil {
+		row[6] = record.Amount.String()
+	}
+	if record.Type == service.StatementError {
+		// CSV has no error column, as only error records have errors
+		row[8] = csvText(record.Error)
+	}
+	return row
+}
+
+// csvText keeps spreadsheets from running client supplied text as a formula, by quoting it with a leading apostrophe
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
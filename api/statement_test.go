@@ -0,0 +1,423 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"transfers/api/models"
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+func TestExportAccountStatementAPI(t *testing.T) {
+	from := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	account := &db.Account{ID: 1, Currency: "USD"}
+	entries := []*db.ListAccountStatementEntriesRow{
+		{
+			TransactionID:        7,
+			Amount:               util.MustParseMoney("-2.50000"),
+			CreatedAt:            from.Add(time.Hour),
+			SourceAccountID:      1,
+			DestinationAccountID: pgtype.Int8{Int64: 2, Valid: true},
+			Description:          "=HYPERLINK(\"x\")",
+		},
+		{
+			TransactionID:        8,
+			Amount:               util.MustParseMoney("1.00000"),
+			CreatedAt:            from.Add(2 * time.Hour),
+			SourceAccountID:      3,
+			DestinationAccountID: pgtype.Int8{Int64: 1, Valid: true},
+			ExternalReference:    "inv-8",
+		},
+	}
+	// streamEntries passes the opening balance and the first n entries to the visitor, then fails with err if it is
+	// not nil
+	streamEntries := func(n int, err error) func(context.Context, *db.AccountStatementParams, db.StatementVisitor) error {
+		return func(ctx context.Context, param *db.AccountStatementParams, visitor db.StatementVisitor) error {
+			require.NoError(t, visitor.Open(account, util.MustParseMoney("10.00000")))
+			for _, entry := range entries[:n] {
+				require.NoError(t, visitor.Entry(entry))
+			}
+			return err
+		}
+	}
+	// stream passes the statement to the visitor, then fails with err if it is not nil
+	stream := func(err error) func(context.Context, *db.AccountStatementParams, db.StatementVisitor) error {
+		return streamEntries(len(entries), err)
+	}
+	query := "?from=2024-02-01T00:00:00Z&to=2024-03-01T00:00:00Z"
+
+	testCases := []struct {
+		name          string
+		query         string
+		accept        string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "CSV",
+			query:  query,
+			accept: "text/csv",
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := &db.AccountStatementParams{AccountID: 1, From: from, To: to}
+				store.EXPECT().
+					StreamAccountStatement(gomock.Any(), gomock.Eq(arg), gomock.Any()).
+					Times(1).
+					DoAndReturn(stream(nil))
+				store.EXPECT().GetAccountStatement(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+				require.Contains(t, recorder.Header().Get("Content-Disposition"), "statement-1.csv")
+				rows, err := csv.NewReader(recorder.Body).ReadAll()
+				require.NoError(t, err)
+				require.Equal(t, [][]string{
+					statementCSVHeader,
+					{"opening", "1", "USD", "2024-02-01T00:00:00Z", "", "", "", "10.00", "", ""},
+					{"movement", "1", "USD", "2024-02-01T01:00:00Z", "7", "2", "-2.50", "7.50", "'=HYPERLINK(\"x\")", ""},
+					{"movement", "1", "USD", "2024-02-01T02:00:00Z", "8", "3", "1.00", "8.50", "", "inv-8"},
+					{"closing", "1", "USD", "2024-03-01T00:00:00Z", "", "", "", "8.50", "", ""},
+				}, rows)
+			},
+		},
+		{
+			name:   "NDJSON",
+			query:  query,
+			accept: "application/x-ndjson",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(stream(nil))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/x-ndjson; charset=utf-8", recorder.Header().Get("Content-Type"))
+				records := readStatementRecords(t, recorder)
+				require.Len(t, records, 4)
+				require.Equal(t, "opening", records[0].Type)
+				require.Nil(t, records[0].Amount)
+				require.Equal(t, "movement", records[1].Type)
+				require.Equal(t, "-2.50", records[1].Amount.String())
+				require.Equal(t, `=HYPERLINK("x")`, records[1].Description)
+				require.Equal(t, "closing", records[3].Type)
+				require.Equal(t, "8.50", records[3].Balance.String())
+			},
+		},
+		{
+			name:   "JSONByDefault",
+			query:  query,
+			accept: "*/*",
+			buildStubs: func(store *mockdb.MockStore) {
+				statement := &db.AccountStatement{Account: account, OpeningBalance: util.MustParseMoney("10.00000"), Entries: entries}
+				store.EXPECT().GetAccountStatement(gomock.Any(), gomock.Any()).Times(1).Return(statement, nil)
+				store.EXPECT().StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetAccountStatementResponse{}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+				require.Len(t, resp.Movements, 2)
+			},
+		},
+		{
+			name:   "Camt053",
+			query:  query,
+			accept: "application/xml",
+			buildStubs: func(store *mockdb.MockStore) {
+				statement := &db.AccountStatement{Account: account, OpeningBalance: util.MustParseMoney("10.00000"), Entries: entries}
+				arg := &db.AccountStatementParams{AccountID: 1, From: from, To: to}
+				store.EXPECT().GetAccountStatement(gomock.Any(), gomock.Eq(arg)).Times(1).Return(statement, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				body := recorder.Body.String()
+				require.Contains(t, body, "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08")
+				require.Contains(t, body, "<MsgId>STMT1-1709251200</MsgId>")
+				require.Contains(t, body, `<Amt Ccy="USD">8.50</Amt>`)
+				require.Equal(t, 2, strings.Count(body, "<Ntry>"))
+			},
+		},
+		{
+			name:   "MT940",
+			query:  query,
+			accept: "application/x-mt940",
+			buildStubs: func(store *mockdb.MockStore) {
+				statement := &db.AccountStatement{Account: account, OpeningBalance: util.MustParseMoney("10.00400"), Entries: entries}
+				arg := &db.AccountStatementParams{AccountID: 1, From: from, To: to}
+				store.EXPECT().GetAccountStatement(gomock.Any(), gomock.Eq(arg)).Times(1).Return(statement, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/x-mt940; charset=utf-8", recorder.Header().Get("Content-Type"))
+				body := recorder.Body.String()
+				require.Contains(t, body, ":20:STMT240301000000\r\n:25:00000000018\r\n")
+				require.Contains(t, body, ":61:2402010201D2,50NTRFNONREF//7\r\n")
+				require.Contains(t, body, ":61:2402010201C1,00NTRFinv-8//8\r\n")
+				require.Contains(t, body, ":62F:C240229USD8,50\r\n:86:ROUNDING RESIDUAL USD 0,00400\r\n-\r\n")
+			},
+		},
+		{
+			name:   "OFX",
+			query:  query,
+			accept: "application/x-ofx",
+			buildStubs: func(store *mockdb.MockStore) {
+				statement := &db.AccountStatement{Account: account, OpeningBalance: util.MustParseMoney("10.00000"), Entries: entries}
+				arg := &db.AccountStatementParams{AccountID: 1, From: from, To: to}
+				store.EXPECT().GetAccountStatement(gomock.Any(), gomock.Eq(arg)).Times(1).Return(statement, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/x-ofx; charset=utf-8", recorder.Header().Get("Content-Type"))
+				body := recorder.Body.String()
+				require.Contains(t, body, "<TRNUID>STMT1-1709251200</TRNUID>")
+				require.Contains(t, body, "<TRNAMT>-2.50</TRNAMT>")
+				require.Contains(t, body, "<BALAMT>8.50</BALAMT>")
+				require.NotContains(t, body, "<BALLIST>")
+				require.Equal(t, 2, strings.Count(body, "<STMTTRN>"))
+			},
+		},
+		{
+			name:   "NotAcceptable",
+			query:  query,
+			accept: "application/pdf",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotAcceptable, recorder.Code)
+			},
+		},
+		{
+			name:   "InvalidRange",
+			query:  "?from=2024-03-01T00:00:00Z&to=2024-02-01T00:00:00Z",
+			accept: "text/csv",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:   "NotFound",
+			accept: "text/csv",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(util.NewAccountNotFoundError(1))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				require.Contains(t, recorder.Header().Get("Content-Type"), "application/json")
+			},
+		},
+		{
+			name:   "FailsMidway",
+			query:  query,
+			accept: "application/x-ndjson",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(stream(util.NewDBError(context.Canceled)))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				records := readStatementRecords(t, recorder)
+				require.Len(t, records, 4)
+				require.Equal(t, "error", records[3].Type)
+				require.Contains(t, records[3].Error, "context canceled")
+			},
+		},
+		{
+			name:   "FailsMidStream",
+			query:  query,
+			accept: "application/x-ndjson",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(streamEntries(1, util.NewDBError(context.DeadlineExceeded)))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				records := readStatementRecords(t, recorder)
+				require.Len(t, records, 3)
+				require.Equal(t, "movement", records[1].Type)
+				require.Equal(t, "error", records[2].Type)
+				require.Equal(t, "7.50", records[2].Balance.String())
+				require.Contains(t, records[2].Error, "deadline exceeded")
+			},
+		},
+		{
+			name:   "CSVFailsMidStream",
+			query:  query,
+			accept: "text/csv",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					StreamAccountStatement(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(streamEntries(1, util.NewDBError(context.DeadlineExceeded)))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				rows, err := csv.NewReader(recorder.Body).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, rows, 4)
+				last := rows[3]
+				require.Equal(t, "error", last[0])
+				require.Equal(t, "7.50", last[7])
+				require.Contains(t, last[8], "deadline exceeded")
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts/1/statement"+tc.query, http.NoBody)
+			require.NoError(t, err)
+			request.Header.Set("Accept", tc.accept)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func readStatementRecords(t *testing.T, recorder *httptest.ResponseRecorder) []*models.StatementRecord {
+	var records []*models.StatementRecord
+	scanner := bufio.NewScanner(strings.NewReader(recorder.Body.String()))
+	for scanner.Scan() {
+		record := &models.StatementRecord{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
+
+func TestGetTransactionNotificationAPI(t *testing.T) {
+	account := &db.Account{ID: 2, Currency: "USD", DisplayName: "Savings"}
+	transaction := &db.Transaction{
+		ID:                   7,
+		SourceAccountID:      1,
+		DestinationAccountID: pgtype.Int8{Int64: 2, Valid: true},
+		Description:          "Rent",
+	}
+	entries := []*db.Entry{
+		{ID: 1, TransactionID: 7, AccountID: pgtype.Int8{Int64: 1, Valid: true}, Amount: util.MustParseMoney("-2.50000"), Currency: "USD"},
+		{ID: 2, TransactionID: 7, AccountID: pgtype.Int8{Int64: 2, Valid: true}, Amount: util.MustParseMoney("2.50000"), Currency: "USD"},
+	}
+
+	testCases := []struct {
+		name          string
+		url           string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			url:  "/accounts/2/transactions/7/notification",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(int64(2))).Times(1).Return(account, nil)
+				store.EXPECT().GetTransaction(gomock.Any(), gomock.Eq(int64(7))).Times(1).Return(transaction, nil)
+				store.EXPECT().ListEntriesByTransaction(gomock.Any(), gomock.Eq(int64(7))).Times(1).Return(entries, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "application/xml; charset=utf-8", recorder.Header().Get("Content-Type"))
+				body := recorder.Body.String()
+				require.Contains(t, body, "urn:iso:std:iso:20022:tech:xsd:camt.054.001.08")
+				require.Contains(t, body, "<MsgId>NTFN2-7</MsgId>")
+				require.Contains(t, body, "<Nm>Savings</Nm>")
+				require.Contains(t, body, "<CdtDbtInd>CRDT</CdtDbtInd>")
+				require.Contains(t, body, "<DbtrAcct>")
+				require.Contains(t, body, "<Ustrd>Rent</Ustrd>")
+			},
+		},
+		{
+			name: "NotOfAccount",
+			url:  "/accounts/3/transactions/7/notification",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(int64(3))).Times(1).Return(&db.Account{ID: 3, Currency: "USD"}, nil)
+				store.EXPECT().GetTransaction(gomock.Any(), gomock.Eq(int64(7))).Times(1).Return(transaction, nil)
+				store.EXPECT().ListEntriesByTransaction(gomock.Any(), gomock.Eq(int64(7))).Times(1).Return(entries, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "TransactionNotFound",
+			url:  "/accounts/2/transactions/8/notification",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(int64(2))).Times(1).Return(account, nil)
+				store.EXPECT().GetTransaction(gomock.Any(), gomock.Eq(int64(8))).Times(1).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().ListEntriesByTransaction(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidID",
+			url:  "/accounts/2/transactions/0/notification",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, tc.url, http.NoBody)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
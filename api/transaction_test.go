@@ -0,0 +1,1192 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"transfers/api/models"
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/testutil"
+	"transfers/util"
+)
+
+func TestGetTransactionAPI(t *testing.T) {
+	transaction := testutil.GenerateTransaction()
+	transaction.Amount = util.MustParseMoney("10.00000")
+	reversal := &db.Transaction{
+		ID:                   transaction.ID + 1,
+		SourceAccountID:      transaction.DestinationAccountID.Int64,
+		DestinationAccountID: pgtype.Int8{Int64: transaction.SourceAccountID, Valid: true},
+		Amount:               util.MustParseMoney("4.00000"),
+		Currency:             "USD",
+		DestinationAmount:    util.MustParseMoney("4.00000"),
+		DestinationCurrency:  "USD",
+		FxRate:               "1",
+		CreatedAt:            time.Now(),
+		ReversalOf:           pgtype.Int8{Int64: transaction.ID, Valid: true},
+	}
+	multiLeg := &db.Transaction{
+		ID:                  transaction.ID + 2,
+		SourceAccountID:     transaction.SourceAccountID,
+		Amount:              util.MustParseMoney("10.00000"),
+		Currency:            "USD",
+		DestinationAmount:   util.MustParseMoney("10.00000"),
+		DestinationCurrency: "USD",
+		FxRate:              "1",
+		CreatedAt:           time.Now(),
+	}
+	legs := []*db.Entry{
+		{TransactionID: multiLeg.ID, AccountID: pgtype.Int8{Int64: multiLeg.SourceAccountID, Valid: true}, Amount: util.MustParseMoney("-10.00000"), Currency: "USD"},
+		{TransactionID: multiLeg.ID, AccountID: pgtype.Int8{Int64: 2001, Valid: true}, Amount: util.MustParseMoney("9.50000"), Currency: "USD"},
+		{TransactionID: multiLeg.ID, AccountID: pgtype.Int8{Int64: 2002, Valid: true}, Amount: util.MustParseMoney("0.50000"), Currency: "USD"},
+	}
+
+	testCases := []struct {
+		name          string
+		transactionID int64
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:          "OK",
+			transactionID: transaction.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetTransaction(gomock.Any(), gomock.Eq(transaction.ID)).
+					Times(1).
+					Return(transaction, nil)
+				store.EXPECT().
+					ListReversals(gomock.Any(), gomock.Eq(pgtype.Int8{Int64: transaction.ID, Valid: true})).
+					Times(1).
+					Return([]*db.Transaction{reversal}, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetTransactionResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, transaction.ID, resp.TransactionID)
+				require.Equal(t, "10.00", resp.Amount.String())
+				require.Equal(t, "USD", resp.Currency)
+				require.Empty(t, resp.FxRate)
+				require.Equal(t, "4.00", resp.ReversedAmount.String())
+				require.Len(t, resp.Reversals, 1)
+				require.Equal(t, reversal.ID, resp.Reversals[0].TransactionID)
+				require.Equal(t, transaction.ID, resp.Reversals[0].ReversalOf)
+			},
+		},
+		{
+			name:          "Reversal",
+			transactionID: reversal.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetTransaction(gomock.Any(), gomock.Eq(reversal.ID)).
+					Times(1).
+					Return(reversal, nil)
+				store.EXPECT().
+					ListReversals(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetTransactionResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, transaction.ID, resp.ReversalOf)
+				require.Empty(t, resp.Reversals)
+			},
+		},
+		{
+			name:          "MultiLeg",
+			transactionID: multiLeg.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetTransaction(gomock.Any(), gomock.Eq(multiLeg.ID)).
+					Times(1).
+					Return(multiLeg, nil)
+				store.EXPECT().
+					ListEntriesByTransaction(gomock.Any(), gomock.Eq(multiLeg.ID)).
+					Times(1).
+					Return(legs, nil)
+				store.EXPECT().
+					ListReversals(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.GetTransactionResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Zero(t, resp.DestinationAccountID)
+				require.Len(t, resp.Legs, 3)
+				require.Equal(t, multiLeg.SourceAccountID, resp.Legs[0].AccountID)
+				require.Equal(t, "-10.00", resp.Legs[0].Amount.String())
+				require.Equal(t, int64(2002), resp.Legs[2].AccountID)
+				require.Equal(t, "0.50", resp.Legs[2].Amount.String())
+			},
+		},
+		{
+			name:          "NotFound",
+			transactionID: transaction.ID,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetTransaction(gomock.Any(), gomock.Eq(transaction.ID)).
+					Times(1).
+					Return(nil, pgx.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:          "InvalidID",
+			transactionID: -1,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					GetTransaction(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/transactions/%d", tc.transactionID)
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestCreateReversalAPI(t *testing.T) {
+	transaction := testutil.GenerateTransaction()
+	reversal := &db.Transaction{
+		ID:                   transaction.ID + 1,
+		SourceAccountID:      transaction.DestinationAccountID.Int64,
+		DestinationAccountID: pgtype.Int8{Int64: transaction.SourceAccountID, Valid: true},
+		Amount:               transaction.Amount,
+		CreatedAt:            time.Now(),
+		ReversalOf:           pgtype.Int8{Int64: transaction.ID, Valid: true},
+	}
+
+	testCases := []struct {
+		name          string
+		transactionID int64
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:          "FullReversal",
+			transactionID: transaction.ID,
+			body:          gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := &db.ReverseTransactionParams{TransactionID: transaction.ID, Rounding: util.RoundHalfEven}
+				store.EXPECT().
+					ReverseTransaction(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(reversal, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateReversalResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, reversal.ID, resp.TransactionID)
+				require.Equal(t, transaction.ID, resp.ReversalOf)
+				require.Equal(t, transaction.SourceAccountID, resp.DestinationAccountID)
+			},
+		},
+		{
+			name:          "PartialReversal",
+			transactionID: transaction.ID,
+			body:          gin.H{"amount": "0.5"},
+			buildStubs: func(store *mockdb.MockStore) {
+				amount := util.MustParseMoney("0.50000")
+				arg := &db.ReverseTransactionParams{TransactionID: transaction.ID, Amount: &amount, Rounding: util.RoundHalfEven}
+				store.EXPECT().
+					ReverseTransaction(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(reversal, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name:          "ExceedsRemaining",
+			transactionID: transaction.ID,
+			body:          gin.H{"amount": "1000000"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ReverseTransaction(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewReversalExceedsRemainingError("1000000.00000", transaction.Amount.String()))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name:          "InsufficientBalance",
+			transactionID: transaction.ID,
+			body:          gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ReverseTransaction(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewInsufficientBalanceError())
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPaymentRequired, recorder.Code)
+			},
+		},
+		{
+			name:          "NotFound",
+			transactionID: transaction.ID,
+			body:          gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ReverseTransaction(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewTransactionNotFoundError(transaction.ID))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:          "InvalidAmount",
+			transactionID: transaction.ID,
+			body:          gin.H{"amount": "-1"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ReverseTransaction(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:          "InvalidID",
+			transactionID: -1,
+			body:          gin.H{},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					ReverseTransaction(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/transactions/%d/reversals", tc.transactionID)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestCreateTransactionAPI(t *testing.T) {
+	source := testutil.GenerateAccount()
+	destination := testutil.GenerateAccount()
+	destination.ID = source.ID + 1
+	transaction := &db.Transaction{
+		ID:                   1,
+		SourceAccountID:      source.ID,
+		DestinationAccountID: pgtype.Int8{Int64: destination.ID, Valid: true},
+		Amount:               util.MustParseMoney("1.50000"),
+		Currency:             "USD",
+		DestinationAmount:    util.MustParseMoney("1.50000"),
+		DestinationCurrency:  "USD",
+		FxRate:               "1",
+		CreatedAt:            time.Now().UTC(),
+	}
+	foreign := testutil.GenerateAccount()
+	foreign.ID = source.ID + 2
+	foreign.Currency = "JPY"
+	conversion := &db.Transaction{
+		ID:                   2,
+		SourceAccountID:      source.ID,
+		DestinationAccountID: pgtype.Int8{Int64: foreign.ID, Valid: true},
+		Amount:               util.MustParseMoney("1.50000"),
+		Currency:             "USD",
+		DestinationAmount:    util.MustParseMoney("225.00000"),
+		DestinationCurrency:  "JPY",
+		FxRate:               "150.1234000000",
+		CreatedAt:            time.Now().UTC(),
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				arg := &db.CreateTransactionParams{
+					SourceAccountID:      source.ID,
+					DestinationAccountID: destination.ID,
+					Amount:               util.MustParseMoney("1.50000"),
+					Currency:             "USD",
+					DestinationAmount:    util.MustParseMoney("1.50000"),
+					DestinationCurrency:  "USD",
+					FxRate:               "1",
+				}
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(transaction, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateTransactionResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, transaction.ID, resp.TransactionID)
+				require.Equal(t, "1.50", resp.Amount.String())
+				require.Equal(t, "USD", resp.Currency)
+				require.Empty(t, resp.DestinationAmount)
+				require.True(t, transaction.CreatedAt.Equal(resp.CreatedAt))
+			},
+		},
+		{
+			name: "AccountNumbers",
+			body: gin.H{
+				"source_account_number":      util.AccountNumber(source.ID),
+				"destination_account_id":     destination.ID,
+				"destination_account_number": util.AccountNumber(destination.ID),
+				"amount":                     "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateTransactionParams) (*db.Transaction, error) {
+						require.Equal(t, source.ID, arg.SourceAccountID)
+						require.Equal(t, destination.ID, arg.DestinationAccountID)
+						return transaction, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "AccountNumberMismatch",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"source_account_number":  util.AccountNumber(destination.ID),
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidAccountNumber",
+			body: gin.H{
+				"source_account_number":  "00000000017",
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "NoSourceAccount",
+			body: gin.H{
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "WithMemo",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"description":            "March rent",
+				"external_reference":     "inv-2024-03",
+				"metadata":               gin.H{"invoice": gin.H{"id": 123456789012345678}},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(destination, nil)
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateTransactionParams) (*db.Transaction, error) {
+						require.Equal(t, "March rent", arg.Description)
+						require.Equal(t, "inv-2024-03", arg.ExternalReference)
+						require.JSONEq(t, `{"invoice": {"id": 123456789012345678}}`, string(arg.Metadata))
+						created := *transaction
+						created.Description, created.ExternalReference, created.Metadata = arg.Description, arg.ExternalReference, arg.Metadata
+						return &created, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateTransactionResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "March rent", resp.Description)
+				require.Equal(t, "inv-2024-03", resp.ExternalReference)
+				require.JSONEq(t, `{"invoice": {"id": 123456789012345678}}`, string(resp.Metadata))
+			},
+		},
+		{
+			name: "MetadataNotObject",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"metadata":               []string{"invoice"},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "MetadataTooLarge",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"metadata":               gin.H{"note": strings.Repeat("x", util.MaxMetadataSize)},
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "CrossCurrency",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": foreign.ID,
+				"amount":                 "1.5",
+				"fx_rate":                "150.1234",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(foreign.ID)).Times(1).Return(foreign, nil)
+				store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(2).Return(nil, pgx.ErrNoRows)
+				arg := &db.CreateTransactionParams{
+					SourceAccountID:      source.ID,
+					DestinationAccountID: foreign.ID,
+					Amount:               util.MustParseMoney("1.50000"),
+					Currency:             "USD",
+					DestinationAmount:    util.MustParseMoney("225.00000"), // 225.1851 rounded to whole yen
+					DestinationCurrency:  "JPY",
+					FxRate:               "150.1234000000",
+				}
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(conversion, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.CreateTransactionResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, "1.50", resp.Amount.String())
+				require.Equal(t, "USD", resp.Currency)
+				require.Equal(t, "225", resp.DestinationAmount.String())
+				require.Equal(t, "JPY", resp.DestinationCurrency)
+				require.Equal(t, conversion.FxRate, resp.FxRate)
+			},
+		},
+		{
+			name: "PublishedRate",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": foreign.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(foreign.ID)).Times(1).Return(foreign, nil)
+				store.EXPECT().
+					GetFxRate(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.GetFxRateParams) (*db.FxRate, error) {
+						require.Equal(t, "USD", arg.BaseCurrency)
+						require.Equal(t, "JPY", arg.QuoteCurrency)
+						return &db.FxRate{ID: 7, BaseCurrency: "USD", QuoteCurrency: "JPY", Rate: "150.1234000000"}, nil
+					})
+				arg := &db.CreateTransactionParams{
+					SourceAccountID:      source.ID,
+					DestinationAccountID: foreign.ID,
+					Amount:               util.MustParseMoney("1.50000"),
+					Currency:             "USD",
+					DestinationAmount:    util.MustParseMoney("225.00000"),
+					DestinationCurrency:  "JPY",
+					FxRate:               "150.1234000000",
+					FxRateID:             pgtype.Int8{Int64: 7, Valid: true},
+				}
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(conversion, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "InversePublishedRate",
+			body: gin.H{
+				"source_account_id":      foreign.ID,
+				"destination_account_id": source.ID,
+				"amount":                 "1000",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(foreign.ID)).Times(1).Return(foreign, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				gomock.InOrder(
+					store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(1).Return(nil, pgx.ErrNoRows),
+					store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(1).Return(&db.FxRate{ID: 8, Rate: "160.0000000000"}, nil),
+				)
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.CreateTransactionParams) (*db.Transaction, error) {
+						require.Equal(t, "0.0062500000", arg.FxRate)
+						require.Equal(t, "6.25000", arg.DestinationAmount.String())
+						require.Equal(t, int64(8), arg.FxRateID.Int64)
+						return conversion, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+			},
+		},
+		{
+			name: "RateChanged",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": foreign.ID,
+				"amount":                 "1.5",
+				"fx_rate":                "149",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(foreign.ID)).Times(1).Return(foreign, nil)
+				store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(1).Return(&db.FxRate{ID: 7, Rate: "150.1234000000"}, nil)
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "CrossCurrencyWithoutRate",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": foreign.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(foreign.ID)).Times(1).Return(foreign, nil)
+				store.EXPECT().GetFxRate(gomock.Any(), gomock.Any()).Times(2).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "CurrencyDoesNotMatchAccount",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+				"currency":               "EUR",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(2).Return(source, nil)
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidPrecision",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.505",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(2).Return(source, nil)
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "InsufficientBalance",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(2).Return(source, nil)
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewInsufficientBalanceError())
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPaymentRequired, recorder.Code)
+			},
+		},
+		{
+			name: "FrozenDestination",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				frozen := *destination
+				frozen.Status = db.AccountFrozen
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID)).Times(1).Return(source, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(destination.ID)).Times(1).Return(&frozen, nil)
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "ClosedSourceInStore",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": destination.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(2).Return(source, nil)
+				store.EXPECT().
+					CreateTransactionWithSSI(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewAccountNotActiveError(source.ID, db.AccountClosed))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "SameAccount",
+			body: gin.H{
+				"source_account_id":      source.ID,
+				"destination_account_id": source.ID,
+				"amount":                 "1.5",
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateTransactionWithSSI(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/transactions", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestCreateMultiLegTransactionAPI(t *testing.T) {
+	source := testutil.GenerateAccount()
+	merchant := testutil.GenerateAccount()
+	merchant.ID = source.ID + 1
+	fee := testutil.GenerateAccount()
+	fee.ID = source.ID + 2
+	foreign := testutil.GenerateAccount()
+	foreign.ID = source.ID + 3
+	foreign.Currency = "JPY"
+	transaction := &db.Transaction{
+		ID:                  1,
+		SourceAccountID:     source.ID,
+		Amount:              util.MustParseMoney("10.00000"),
+		Currency:            "USD",
+		DestinationAmount:   util.MustParseMoney("10.00000"),
+		DestinationCurrency: "USD",
+		FxRate:              "1",
+		CreatedAt:           time.Now().UTC(),
+	}
+	stubAccounts := func(store *mockdb.MockStore) {
+		for _, account := range []*db.Account{source, merchant, fee, foreign} {
+			store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).AnyTimes().Return(account, nil)
+		}
+	}
+	legs := func(merchantAmount, feeAmount string) []gin.H {
+		return []gin.H{
+			{"account_id": merchant.ID, "amount": merchantAmount},
+			{"account_id": fee.ID, "amount": feeAmount},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{"source_account_id": source.ID, "amount": "10", "legs": legs("9.5", "0.5")},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				arg := &db.MultiLegTransferParams{
+					SourceAccountID: source.ID,
+					Amount:          util.MustParseMoney("10.00000"),
+					Currency:        "USD",
+					Legs: []*db.TransactionLeg{
+						{AccountID: merchant.ID, Amount: util.MustParseMoney("9.50000")},
+						{AccountID: fee.ID, Amount: util.MustParseMoney("0.50000")},
+					},
+				}
+				store.EXPECT().
+					CreateMultiLegTransfer(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(transaction, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+				resp := models.GetTransactionResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Equal(t, transaction.ID, resp.TransactionID)
+				require.Zero(t, resp.DestinationAccountID)
+				require.Len(t, resp.Legs, 3)
+				require.Equal(t, "-10.00", resp.Legs[0].Amount.String())
+				require.Equal(t, merchant.ID, resp.Legs[1].AccountID)
+				require.Equal(t, "9.50", resp.Legs[1].Amount.String())
+			},
+		},
+		{
+			name: "LegsDoNotNetToZero",
+			body: gin.H{"source_account_id": source.ID, "amount": "10", "legs": legs("9.5", "0.49")},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				store.EXPECT().CreateMultiLegTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "LegToSourceAccount",
+			body: gin.H{"source_account_id": source.ID, "amount": "10", "legs": []gin.H{{"account_id": source.ID, "amount": "10"}}},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				store.EXPECT().CreateMultiLegTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "LegInOtherCurrency",
+			body: gin.H{"source_account_id": source.ID, "amount": "10", "legs": []gin.H{{"account_id": foreign.ID, "amount": "10"}}},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				store.EXPECT().CreateMultiLegTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "LegAccountNotFound",
+			body: gin.H{"source_account_id": source.ID, "amount": "10", "legs": []gin.H{{"account_id": source.ID + 10, "amount": "10"}}},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(source.ID+10)).Times(1).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().CreateMultiLegTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "InsufficientBalance",
+			body: gin.H{"source_account_id": source.ID, "amount": "10", "legs": legs("9.5", "0.5")},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubAccounts(store)
+				store.EXPECT().
+					CreateMultiLegTransfer(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, util.NewInsufficientBalanceError())
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPaymentRequired, recorder.Code)
+			},
+		},
+		{
+			name: "NoLegs",
+			body: gin.H{"source_account_id": source.ID, "amount": "10", "legs": []gin.H{}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateMultiLegTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/transactions/multi-leg", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestListAccountTransactionsAPI(t *testing.T) {
+	account := testutil.GenerateAccount()
+	transactions := make([]*db.Transaction, 3)
+	for i := range transactions {
+		transactions[i] = testutil.GenerateTransaction()
+		transactions[i].ID = int64(30 - i)
+		transactions[i].SourceAccountID = account.ID
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "FirstPage",
+			query: "?limit=2",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().
+					ListAccountTransactions(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.ListAccountTransactionsParams) ([]*db.Transaction, error) {
+						require.Equal(t, account.ID, arg.AccountID)
+						require.True(t, arg.Incoming)
+						require.True(t, arg.Outgoing)
+						require.Equal(t, int32(3), arg.PageSize)
+						return transactions, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.ListAccountTransactionsResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Len(t, resp.Transactions, 2)
+				require.Equal(t, util.EncodeCursor(transactions[1].ID), resp.NextCursor)
+			},
+		},
+		{
+			name: "Filters",
+			query: fmt.Sprintf("?direction=outgoing&cursor=%s&from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z&min_amount=1&max_amount=2.5",
+				util.EncodeCursor(28)),
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().
+					ListAccountTransactions(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ any, arg *db.ListAccountTransactionsParams) ([]*db.Transaction, error) {
+						require.False(t, arg.Incoming)
+						require.True(t, arg.Outgoing)
+						require.Equal(t, int64(28), arg.BeforeID)
+						require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), arg.FromTime.UTC())
+						require.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), arg.ToTime.UTC())
+						require.Equal(t, "1.00000", arg.MinAmount.String())
+						require.Equal(t, "2.50000", arg.MaxAmount.String())
+						return transactions[2:], nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.ListAccountTransactionsResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Len(t, resp.Transactions, 1)
+				require.Empty(t, resp.NextCursor)
+			},
+		},
+		{
+			name:  "InvalidDirection",
+			query: "?direction=sideways",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountTransactions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InvalidAmountRange",
+			query: "?min_amount=5&max_amount=1",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountTransactions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InvalidCursor",
+			query: "?cursor=abc",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountTransactions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "AccountNotFound",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(nil, pgx.ErrNoRows)
+				store.EXPECT().ListAccountTransactions(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d/transactions%s", account.ID, tc.query)
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestListTransactionsAPI(t *testing.T) {
+	transactions := []*db.Transaction{
+		{ID: 3, SourceAccountID: 1, Amount: util.MustParseMoney("1.00000"), Currency: "USD", DestinationCurrency: "USD", ExternalReference: "inv-1", Metadata: util.Metadata(`{}`)},
+		{ID: 2, SourceAccountID: 1, Amount: util.MustParseMoney("2.00000"), Currency: "USD", DestinationCurrency: "USD", ExternalReference: "inv-1", Metadata: util.Metadata(`{"a": 1}`)},
+		{ID: 1, SourceAccountID: 1, Amount: util.MustParseMoney("3.00000"), Currency: "USD", DestinationCurrency: "USD", ExternalReference: "inv-1"},
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recoder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?external_reference=inv-1&limit=2",
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := &db.ListTransactionsByExternalReferenceParams{
+					ExternalReference: "inv-1",
+					BeforeID:          math.MaxInt64,
+					PageSize:          3,
+				}
+				store.EXPECT().
+					ListTransactionsByExternalReference(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(transactions, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.ListTransactionsResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Len(t, resp.Transactions, 2)
+				require.Equal(t, "inv-1", resp.Transactions[0].ExternalReference)
+				require.Empty(t, resp.Transactions[0].Metadata)
+				require.JSONEq(t, `{"a": 1}`, string(resp.Transactions[1].Metadata))
+				require.Equal(t, util.EncodeCursor(transactions[1].ID), resp.NextCursor)
+			},
+		},
+		{
+			name:  "NextPage",
+			query: "?external_reference=inv-1&cursor=" + util.EncodeCursor(2),
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := &db.ListTransactionsByExternalReferenceParams{
+					ExternalReference: "inv-1",
+					BeforeID:          2,
+					PageSize:          21,
+				}
+				store.EXPECT().
+					ListTransactionsByExternalReference(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(transactions[2:], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				resp := models.ListTransactionsResponse{}
+				testutil.UnmarshalToResp(t, recorder.Body, &resp)
+				require.Len(t, resp.Transactions, 1)
+				require.Empty(t, resp.NextCursor)
+			},
+		},
+		{
+			name:  "MissingReference",
+			query: "",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListTransactionsByExternalReference(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/transactions"+tc.query, http.NoBody)
+			require.NoError(t, err)
+
+			server.engine.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"transfers/api"
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/service"
+	"transfers/util"
+)
+
+/*
+runCommand runs a subcommand of the server binary instead of the server, writing its document to out or to the file
+given by -out:
+
+	camt053 -account 1 [-from 2024-02-01T00:00:00Z] [-to 2024-03-01T00:00:00Z] [-out statement.xml]
+	mt940 -account 1 [-from 2024-02-01T00:00:00Z] [-to 2024-03-01T00:00:00Z] [-out statement.sta]
+	ofx -account 1 [-from 2024-02-01T00:00:00Z] [-to 2024-03-01T00:00:00Z] [-out statement.ofx]
+	camt054 -account 1 -transaction 7 [-out notification.xml]
+	pain001 [-in payments.xml] [-out report.xml]
+
+pain001 makes the payments of a pain.001 file, read from stdin without -in, and writes its pain.002 status report.
+*/
+func runCommand(ctx context.Context, config util.Config, store db.Store, args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	accountID := flags.Int64("account", 0, "account ID")
+	output := flags.String("out", "", "file to write to instead of stdout")
+
+	var document []byte
+	var err error
+	switch args[0] {
+	case "camt053", "mt940", "ofx":
+		from := flags.String("from", "", "start of the period, RFC 3339 (default when the account was created)")
+		to := flags.String("to", "", "end of the period, RFC 3339 (default now)")
+		if err = flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		request := &models.GetAccountStatementRequest{AccountID: *accountID}
+		if request.From, err = parseTimeFlag("from", *from); err != nil {
+			return err
+		}
+		if request.To, err = parseTimeFlag("to", *to); err != nil {
+			return err
+		}
+		svc := map[string]api.DocumentService[models.GetAccountStatementRequest]{
+			"camt053": &service.ExportCamt053Service{Store: store},
+			"mt940":   &service.ExportMT940Service{Store: store},
+			"ofx":     &service.ExportOFXService{Store: store},
+		}[args[0]]
+		document, err = runDocumentService[models.GetAccountStatementRequest](ctx, svc, request)
+	case "camt054":
+		transactionID := flags.Int64("transaction", 0, "transaction ID")
+		if err = flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		request := &models.GetTransactionNotificationRequest{AccountID: *accountID, TransactionID: *transactionID}
+		document, err = runDocumentService[models.GetTransactionNotificationRequest](ctx, &service.ExportCamt054Service{Store: store}, request)
+	case "pain001":
+		input := flags.String("in", "", "pain.001 file to read instead of stdin")
+		if err = flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		request := &models.IngestPaymentFileRequest{}
+		if *input != "" {
+			request.Document, err = os.ReadFile(*input)
+		} else {
+			request.Document, err = io.ReadAll(in)
+		}
+		if err != nil {
+			return err
+		}
+		var rounding util.RoundingMode
+		if rounding, err = util.ParseRoundingMode(config.FxRounding); err != nil {
+			return err
+		}
+		svc := &service.IngestPaymentFileService{Store: store, Rounding: rounding, TTL: config.IdempotencyKeyTTL}
+		document, err = runDocumentService[models.IngestPaymentFileRequest](ctx, svc, request)
+	default:
+		return fmt.Errorf("unknown command %q, expected camt053, camt054, mt940, ofx or pain001", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, document, 0o644)
+	}
+	_, err = out.Write(document)
+	return err
+}
+
+// runDocumentService validates request and renders its document, as the API does
+func runDocumentService[Req any](ctx context.Context, svc api.DocumentService[Req], request *Req) ([]byte, error) {
+	if err := svc.Validate(ctx, request); err != nil {
+		return nil, err
+	}
+	return svc.Do(ctx, request)
+}
+
+// parseTimeFlag parses an optional RFC 3339 time flag, which is zero when not given
+func parseTimeFlag(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+	return t, nil
+}
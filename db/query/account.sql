@@ -1,11 +1,39 @@
 -- name: CreateAccount :one
 INSERT INTO accounts (
   id,
-  balance
+  balance,
+  currency,
+  type,
+  balance_floor,
+  display_name,
+  owner_reference,
+  labels,
+  initial_balance
 ) VALUES (
-  $1, $2
+  $1, $2, $3, $4, $5, $6, $7, $8, $2
 ) RETURNING *;
 
+-- name: CreateAccountWithNextID :one
+INSERT INTO accounts (
+  balance,
+  currency,
+  type,
+  balance_floor,
+  display_name,
+  owner_reference,
+  labels,
+  initial_balance
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $1
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING *;
+
+-- name: AdvanceAccountIDSequence :exec
+SELECT setval('accounts_id_seq', (SELECT max(id) FROM accounts))
+FROM accounts_id_seq
+WHERE last_value < (SELECT max(id) FROM accounts);
+
 -- name: GetAccount :one
 SELECT * FROM accounts
 WHERE id = $1 LIMIT 1;
@@ -15,12 +43,60 @@ SELECT * FROM accounts
 WHERE id = $1 LIMIT 1
 FOR NO KEY UPDATE;
 
+-- name: ListAccounts :many
+SELECT * FROM accounts
+WHERE (sqlc.arg(owner_reference)::text = '' OR owner_reference = sqlc.arg(owner_reference))
+  AND labels @> sqlc.arg(labels)
+  AND id < sqlc.arg(before_id)
+ORDER BY id DESC
+LIMIT sqlc.arg(page_size);
+
 -- name: UpdateAccount :one
 UPDATE accounts
-SET balance = $2
+SET balance = $2,
+    version = version + 1
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateAccountIfVersion :one
+UPDATE accounts
+SET balance = $2,
+    version = version + 1
+WHERE id = $1 AND version = $3
+RETURNING *;
+
+-- name: UpdateAccountMetadata :one
+UPDATE accounts
+SET display_name = COALESCE(sqlc.narg(display_name), display_name),
+    owner_reference = COALESCE(sqlc.narg(owner_reference), owner_reference),
+    labels = jsonb_strip_nulls(labels || sqlc.arg(labels)::jsonb),
+    version = version + 1
+WHERE id = sqlc.arg(id)
+  AND (sqlc.narg(versions)::bigint[] IS NULL OR version = ANY(sqlc.narg(versions)::bigint[]))
+  AND (SELECT count(*) FROM jsonb_object_keys(jsonb_strip_nulls(labels || sqlc.arg(labels)::jsonb))) <= sqlc.arg(max_labels)::bigint
+RETURNING *;
+
+-- name: UpdateAccountStatus :one
+UPDATE accounts
+SET status = $2,
+    version = version + 1
+WHERE id = $1
+RETURNING *;
+
+-- name: AddAccountBalance :one
+UPDATE accounts
+SET balance = balance + sqlc.arg(amount),
+    version = version + 1
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: AddAccountHeld :one
+UPDATE accounts
+SET held = held + sqlc.arg(amount),
+    version = version + 1
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
 -- name: DeleteAccount :exec
 DELETE FROM accounts
 WHERE id = $1;
@@ -0,0 +1,38 @@
+-- name: CreateEntry :one
+INSERT INTO entries (
+  transaction_id,
+  account_id,
+  amount,
+  currency
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: ListEntriesByTransaction :many
+SELECT * FROM entries
+WHERE transaction_id = $1
+ORDER BY id;
+
+-- name: ListAccountStatementEntries :many
+SELECT entries.id, entries.transaction_id, entries.amount, entries.currency, entries.created_at,
+  transactions.source_account_id, transactions.destination_account_id,
+  transactions.description, transactions.external_reference
+FROM entries
+JOIN transactions ON transactions.id = entries.transaction_id
+WHERE entries.account_id = sqlc.arg(account_id)::bigint
+  AND entries.created_at >= sqlc.arg(from_time)
+  AND entries.created_at < sqlc.arg(to_time)
+ORDER BY entries.created_at, entries.id;
+
+-- name: SumAccountEntries :one
+SELECT COALESCE(SUM(amount), 0)::numeric AS total FROM entries
+WHERE account_id = sqlc.arg(account_id)::bigint
+  AND created_at < sqlc.arg(before);
+
+-- name: SumEntriesByCurrency :many
+SELECT currency, SUM(amount)::numeric AS total FROM entries
+GROUP BY currency
+ORDER BY currency;
+
+-- name: DeleteAllEntries :exec
+DELETE FROM entries;
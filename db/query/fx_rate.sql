@@ -0,0 +1,21 @@
+-- name: CreateFxRate :execrows
+INSERT INTO fx_rates (
+  base_currency,
+  quote_currency,
+  rate,
+  effective_from
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (base_currency, quote_currency, effective_from) DO NOTHING;
+
+-- name: GetFxRate :one
+SELECT * FROM fx_rates
+WHERE base_currency = sqlc.arg(base_currency)
+  AND quote_currency = sqlc.arg(quote_currency)
+  AND effective_from <= sqlc.arg(at)
+ORDER BY effective_from DESC
+LIMIT 1;
+
+-- name: DeleteAllFxRates :exec
+DELETE FROM fx_rates;
@@ -0,0 +1,36 @@
+-- name: CreateHold :one
+INSERT INTO holds (
+  account_id,
+  destination_account_id,
+  amount,
+  currency,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetHold :one
+SELECT * FROM holds
+WHERE id = $1 LIMIT 1;
+
+-- name: GetHoldForUpdate :one
+SELECT * FROM holds
+WHERE id = $1 LIMIT 1
+FOR NO KEY UPDATE;
+
+-- name: UpdateHoldStatus :one
+UPDATE holds
+SET status = $2,
+    captured_amount = $3,
+    transaction_id = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: ExpireHolds :many
+UPDATE holds
+SET status = 'expired'
+WHERE status = 'active' AND expires_at <= sqlc.arg(now)
+RETURNING *;
+
+-- name: DeleteAllHolds :exec
+DELETE FROM holds;
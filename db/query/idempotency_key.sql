@@ -0,0 +1,34 @@
+-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys (
+  key,
+  request_hash,
+  expires_at
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (key) DO UPDATE
+SET request_hash = EXCLUDED.request_hash,
+    response_status = 0,
+    response_body = NULL,
+    response_headers = NULL,
+    created_at = now(),
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= now()
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE key = $1 LIMIT 1;
+
+-- name: UpdateIdempotencyKeyResponse :one
+UPDATE idempotency_keys
+SET response_status = $2,
+    response_body = $3,
+    response_headers = $4
+WHERE key = $1
+RETURNING *;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE key = $1;
+
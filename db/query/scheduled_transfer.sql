@@ -0,0 +1,57 @@
+-- name: CreateScheduledTransfer :one
+INSERT INTO scheduled_transfers (
+  source_account_id,
+  destination_account_id,
+  amount,
+  currency,
+  recurrence,
+  start_at,
+  end_at,
+  max_occurrences,
+  next_run_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $6
+) RETURNING *;
+
+-- name: GetScheduledTransfer :one
+SELECT * FROM scheduled_transfers
+WHERE id = $1 LIMIT 1;
+
+-- name: GetDueScheduledTransfer :one
+SELECT * FROM scheduled_transfers
+WHERE status = 'active' AND next_run_at <= sqlc.arg(now)::timestamptz
+ORDER BY next_run_at
+LIMIT 1
+FOR NO KEY UPDATE SKIP LOCKED;
+
+-- name: UpdateScheduledTransfer :one
+UPDATE scheduled_transfers
+SET occurrences = $2,
+    attempt = $3,
+    next_run_at = $4,
+    status = $5
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateScheduledTransferRun :one
+INSERT INTO scheduled_transfer_runs (
+  scheduled_transfer_id,
+  occurrence,
+  attempt,
+  status,
+  transaction_id,
+  error
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+) RETURNING *;
+
+-- name: ListScheduledTransferRuns :many
+SELECT * FROM scheduled_transfer_runs
+WHERE scheduled_transfer_id = $1
+ORDER BY id;
+
+-- name: DeleteAllScheduledTransferRuns :exec
+DELETE FROM scheduled_transfer_runs;
+
+-- name: DeleteAllScheduledTransfers :exec
+DELETE FROM scheduled_transfers;
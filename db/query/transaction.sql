@@ -2,11 +2,125 @@
 INSERT INTO transactions (
     source_account_id,
     destination_account_id,
-    amount
+    amount,
+    currency,
+    destination_amount,
+    destination_currency,
+    fx_rate,
+    fx_rate_id,
+    description,
+    external_reference,
+    metadata
 ) VALUES (
-  $1, $2, $3
+  sqlc.arg(source_account_id),
+  sqlc.arg(destination_account_id)::bigint,
+  sqlc.arg(amount),
+  sqlc.arg(currency),
+  sqlc.arg(destination_amount),
+  sqlc.arg(destination_currency),
+  sqlc.arg(fx_rate),
+  sqlc.arg(fx_rate_id),
+  sqlc.arg(description),
+  sqlc.arg(external_reference),
+  sqlc.arg(metadata)
 ) RETURNING *;
 
+-- name: CreateMultiLegTransaction :one
+INSERT INTO transactions (
+    source_account_id,
+    amount,
+    currency,
+    destination_amount,
+    destination_currency
+) VALUES (
+  $1, $2, $3, $2, $3
+) RETURNING *;
+
+-- name: CreateReversalTransaction :one
+INSERT INTO transactions (
+    source_account_id,
+    destination_account_id,
+    amount,
+    currency,
+    destination_amount,
+    destination_currency,
+    fx_rate,
+    reversal_of
+) VALUES (
+  sqlc.arg(source_account_id),
+  sqlc.arg(destination_account_id)::bigint,
+  sqlc.arg(amount),
+  sqlc.arg(currency),
+  sqlc.arg(destination_amount),
+  sqlc.arg(destination_currency),
+  sqlc.arg(fx_rate),
+  sqlc.arg(reversal_of)
+) RETURNING *;
+
+-- name: GetTransaction :one
+SELECT * FROM transactions
+WHERE id = $1 LIMIT 1;
+
+-- name: GetTransactionForUpdate :one
+SELECT * FROM transactions
+WHERE id = $1 LIMIT 1
+FOR UPDATE;
+
+-- name: ListAccountTransactions :many
+SELECT * FROM (
+  SELECT * FROM transactions
+  WHERE sqlc.arg(outgoing)::boolean AND source_account_id = sqlc.arg(account_id)
+    AND id < sqlc.arg(before_id)
+    AND created_at >= sqlc.arg(from_time)
+    AND created_at < sqlc.arg(to_time)
+    AND amount >= sqlc.arg(min_amount)
+    AND amount <= sqlc.arg(max_amount)
+  UNION ALL
+  SELECT * FROM transactions
+  WHERE sqlc.arg(incoming)::boolean AND destination_account_id = sqlc.arg(account_id)
+    AND NOT (sqlc.arg(outgoing)::boolean AND source_account_id = sqlc.arg(account_id))
+    AND id < sqlc.arg(before_id)
+    AND created_at >= sqlc.arg(from_time)
+    AND created_at < sqlc.arg(to_time)
+    AND amount >= sqlc.arg(min_amount)
+    AND amount <= sqlc.arg(max_amount)
+  UNION ALL
+  SELECT * FROM transactions
+  WHERE sqlc.arg(incoming)::boolean AND destination_account_id IS NULL
+    AND NOT (sqlc.arg(outgoing)::boolean AND source_account_id = sqlc.arg(account_id))
+    AND id IN (
+      SELECT transaction_id FROM entries
+      WHERE account_id = sqlc.arg(account_id) AND amount > 0
+        AND created_at >= sqlc.arg(from_time)
+        AND created_at < sqlc.arg(to_time)
+    )
+    AND id < sqlc.arg(before_id)
+    AND created_at >= sqlc.arg(from_time)
+    AND created_at < sqlc.arg(to_time)
+    AND amount >= sqlc.arg(min_amount)
+    AND amount <= sqlc.arg(max_amount)
+) AS account_transactions
+ORDER BY id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListTransactionsByExternalReference :many
+SELECT * FROM transactions
+WHERE external_reference = sqlc.arg(external_reference)
+  AND id < sqlc.arg(before_id)
+ORDER BY id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListReversals :many
+SELECT * FROM transactions
+WHERE reversal_of = $1
+ORDER BY id;
+
+-- name: SumReversals :one
+SELECT COALESCE(SUM(amount), 0)::numeric AS amount,
+  COALESCE(SUM(destination_amount), 0)::numeric AS destination_amount
+FROM transactions
+WHERE reversal_of = $1;
+
 
 -- name: DeleteAllTransactions :exec
-DELETE FROM transactions;
\ No newline at end of file
+DELETE FROM transactions;
@@ -1,21 +1,120 @@
 CREATE TABLE "accounts" (
-  "id" bigint PRIMARY KEY,
-  "balance" numeric(20,5) CHECK (balance >= 0) NOT NULL,
-  "created_at" timestamptz NOT NULL DEFAULT (now())
+  "id" bigserial PRIMARY KEY,
+  "balance" numeric(20,5) NOT NULL,
+  "currency" varchar(3) CHECK (currency ~ '^[A-Z]{3}$') NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "version" bigint NOT NULL DEFAULT 0,
+  "held" numeric(20,5) CHECK (held >= 0) NOT NULL DEFAULT 0,
+  "status" varchar(10) CHECK (status IN ('active', 'frozen', 'closed')) NOT NULL DEFAULT 'active',
+  "type" varchar(10) CHECK (type IN ('cash', 'credit', 'system')) NOT NULL DEFAULT 'cash',
+  "balance_floor" numeric(20,5) DEFAULT 0,
+  "display_name" varchar(255) NOT NULL DEFAULT '',
+  "owner_reference" varchar(255) NOT NULL DEFAULT '',
+  "labels" jsonb CHECK (jsonb_typeof(labels) = 'object') NOT NULL DEFAULT '{}',
+  "initial_balance" numeric(20,5) NOT NULL DEFAULT 0,
+  CONSTRAINT "accounts_balance_floor_check" CHECK (balance - held >= balance_floor),
+  CONSTRAINT "accounts_type_floor_check" CHECK (
+    (type = 'cash' AND balance_floor IS NOT DISTINCT FROM 0) OR
+    (type = 'credit' AND balance_floor IS NOT NULL AND balance_floor <= 0) OR
+    (type = 'system' AND balance_floor IS NULL)
+  )
 );
 
 CREATE TABLE "transactions" (
   "id" bigserial PRIMARY KEY,
   "source_account_id" bigint NOT NULL,
-  "destination_account_id" bigint NOT NULL,
+  "destination_account_id" bigint,
   "amount" numeric(20,5) NOT NULL,
+  "currency" varchar(3) NOT NULL,
+  "destination_amount" numeric(20,5) NOT NULL,
+  "destination_currency" varchar(3) NOT NULL,
+  "fx_rate" numeric(20,10) NOT NULL DEFAULT 1,
+  "fx_rate_id" bigint,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "reversal_of" bigint,
+  "description" varchar(255) NOT NULL DEFAULT '',
+  "external_reference" varchar(255) NOT NULL DEFAULT '',
+  "metadata" jsonb CHECK (jsonb_typeof(metadata) = 'object') NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE "entries" (
+  "id" bigserial PRIMARY KEY,
+  "transaction_id" bigint NOT NULL,
+  "account_id" bigint,
+  "amount" numeric(20,5) NOT NULL,
+  "currency" varchar(3) NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "fx_rates" (
+  "id" bigserial PRIMARY KEY,
+  "base_currency" varchar(3) NOT NULL,
+  "quote_currency" varchar(3) NOT NULL,
+  "rate" numeric(20,10) CHECK (rate > 0) NOT NULL,
+  "effective_from" timestamptz NOT NULL,
   "created_at" timestamptz NOT NULL DEFAULT (now())
 );
 
+CREATE TABLE "holds" (
+  "id" bigserial PRIMARY KEY,
+  "account_id" bigint NOT NULL,
+  "destination_account_id" bigint NOT NULL,
+  "amount" numeric(20,5) CHECK (amount > 0) NOT NULL,
+  "currency" varchar(3) NOT NULL,
+  "captured_amount" numeric(20,5) NOT NULL DEFAULT 0,
+  "status" varchar(10) CHECK (status IN ('active', 'captured', 'voided', 'expired')) NOT NULL DEFAULT 'active',
+  "expires_at" timestamptz NOT NULL,
+  "transaction_id" bigint,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  CHECK (captured_amount <= amount)
+);
+
+CREATE TABLE "scheduled_transfers" (
+  "id" bigserial PRIMARY KEY,
+  "source_account_id" bigint NOT NULL,
+  "destination_account_id" bigint NOT NULL,
+  "amount" numeric(20,5) CHECK (amount > 0) NOT NULL,
+  "currency" varchar(3) NOT NULL,
+  "recurrence" varchar(10) CHECK (recurrence IN ('once', 'daily', 'weekly', 'monthly')) NOT NULL DEFAULT 'once',
+  "start_at" timestamptz NOT NULL,
+  "end_at" timestamptz,
+  "max_occurrences" integer CHECK (max_occurrences > 0),
+  "occurrences" integer NOT NULL DEFAULT 0,
+  "attempt" integer NOT NULL DEFAULT 0,
+  "next_run_at" timestamptz,
+  "status" varchar(10) CHECK (status IN ('active', 'completed', 'failed')) NOT NULL DEFAULT 'active',
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "scheduled_transfer_runs" (
+  "id" bigserial PRIMARY KEY,
+  "scheduled_transfer_id" bigint NOT NULL,
+  "occurrence" integer NOT NULL,
+  "attempt" integer NOT NULL,
+  "status" varchar(10) CHECK (status IN ('succeeded', 'failed')) NOT NULL,
+  "transaction_id" bigint,
+  "error" text NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "idempotency_keys" (
+  "key" varchar(255) PRIMARY KEY,
+  "request_hash" text NOT NULL,
+  "response_status" integer NOT NULL DEFAULT 0,
+  "response_body" bytea,
+  "response_headers" jsonb,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expires_at" timestamptz NOT NULL
+);
+
 CREATE INDEX ON "accounts" ("id");
 
 CREATE INDEX ON "accounts" ("created_at");
 
+CREATE INDEX ON "accounts" ("owner_reference");
+
+CREATE INDEX ON "accounts" USING GIN ("labels" jsonb_path_ops);
+
 CREATE INDEX ON "transactions" ("id");
 
 CREATE INDEX ON "transactions" ("created_at");
@@ -28,10 +127,138 @@ CREATE INDEX ON "transactions" ("source_account_id", "destination_account_id");
 
 CREATE INDEX ON "transactions" ("source_account_id", "destination_account_id", "amount");
 
-COMMENT ON COLUMN "accounts"."balance" IS 'positive';
+CREATE INDEX ON "transactions" ("reversal_of");
+
+CREATE INDEX ON "transactions" ("external_reference");
+
+CREATE INDEX ON "entries" ("transaction_id");
+
+CREATE INDEX ON "entries" ("account_id", "created_at");
+
+CREATE UNIQUE INDEX ON "fx_rates" ("base_currency", "quote_currency", "effective_from");
+
+CREATE INDEX ON "holds" ("account_id");
+
+CREATE INDEX ON "holds" ("status", "expires_at");
+
+CREATE INDEX ON "scheduled_transfers" ("status", "next_run_at");
+
+CREATE INDEX ON "scheduled_transfer_runs" ("scheduled_transfer_id");
+
+CREATE INDEX ON "idempotency_keys" ("expires_at");
+
+COMMENT ON COLUMN "accounts"."id" IS 'chosen by the client, or allocated from the sequence';
+
+COMMENT ON COLUMN "accounts"."balance" IS 'at least balance_floor plus held';
+
+COMMENT ON COLUMN "accounts"."currency" IS 'ISO 4217 code';
+
+COMMENT ON COLUMN "accounts"."version" IS 'incremented on every change';
+
+COMMENT ON COLUMN "accounts"."held" IS 'reserved by active holds, the available balance is balance - held';
 
-COMMENT ON COLUMN "transactions"."amount" IS 'positive';
+COMMENT ON COLUMN "accounts"."status" IS 'active, frozen (no debits or credits) or closed (for good, at zero balance)';
+
+COMMENT ON COLUMN "accounts"."type" IS 'cash (floor 0), credit (negative floor, the credit limit) or system (no floor)';
+
+COMMENT ON COLUMN "accounts"."balance_floor" IS 'lowest the available balance may go, null for no floor';
+
+COMMENT ON COLUMN "accounts"."owner_reference" IS 'external reference of the customer owning the account';
+
+COMMENT ON COLUMN "accounts"."labels" IS 'string keys and values for grouping and filtering accounts';
+
+COMMENT ON COLUMN "accounts"."initial_balance" IS 'balance the account was created with, which its entries add up from';
+
+COMMENT ON COLUMN "transactions"."destination_account_id" IS 'null for multi-leg transactions, which credit the accounts of their entries';
+
+COMMENT ON COLUMN "transactions"."amount" IS 'positive, debited from the source account in its currency';
+
+COMMENT ON COLUMN "transactions"."destination_amount" IS 'credited to the destination account in its currency, or split across the legs of a multi-leg transaction';
+
+COMMENT ON COLUMN "transactions"."fx_rate" IS 'destination currency units per source currency unit';
+
+COMMENT ON COLUMN "transactions"."fx_rate_id" IS 'published rate the conversion was locked to, null when the client gave the rate';
+
+COMMENT ON COLUMN "transactions"."reversal_of" IS 'original transaction compensated by this reversal';
+
+COMMENT ON COLUMN "transactions"."external_reference" IS 'reference of the transfer in the client''s system, not unique';
+
+COMMENT ON COLUMN "transactions"."metadata" IS 'JSON object given by the client';
+
+COMMENT ON COLUMN "entries"."account_id" IS 'null for the FX position legs of a cross-currency transaction';
+
+COMMENT ON COLUMN "entries"."amount" IS 'negative for debits, positive for credits';
+
+COMMENT ON COLUMN "fx_rates"."rate" IS 'quote currency units per base currency unit';
+
+COMMENT ON COLUMN "holds"."amount" IS 'reserved in the currency of the held account';
+
+COMMENT ON COLUMN "holds"."captured_amount" IS 'moved by the capture, the rest of the hold is released';
+
+COMMENT ON COLUMN "holds"."transaction_id" IS 'transaction created by the capture';
+
+COMMENT ON COLUMN "scheduled_transfers"."amount" IS 'debited from the source account in its currency on every occurrence';
+
+COMMENT ON COLUMN "scheduled_transfers"."start_at" IS 'time of the first occurrence, later ones recur from it';
+
+COMMENT ON COLUMN "scheduled_transfers"."end_at" IS 'no occurrences after this time, null for no end';
+
+COMMENT ON COLUMN "scheduled_transfers"."max_occurrences" IS 'null for no limit';
+
+COMMENT ON COLUMN "scheduled_transfers"."occurrences" IS 'occurrences done, whether they succeeded or ran out of retries';
+
+COMMENT ON COLUMN "scheduled_transfers"."attempt" IS 'failed attempts at the next occurrence';
+
+COMMENT ON COLUMN "scheduled_transfers"."next_run_at" IS 'when the next attempt is due, null once there are no more occurrences';
+
+COMMENT ON COLUMN "scheduled_transfer_runs"."occurrence" IS 'starting from 1';
+
+COMMENT ON COLUMN "scheduled_transfer_runs"."attempt" IS 'starting from 1 for every occurrence';
+
+COMMENT ON COLUMN "idempotency_keys"."response_status" IS '0 until the response is saved, in the transaction that claims the key';
+
+COMMENT ON COLUMN "idempotency_keys"."response_headers" IS 'headers to replay with the response, such as ETag';
 
 ALTER TABLE "transactions" ADD FOREIGN KEY ("source_account_id") REFERENCES "accounts" ("id");
 
 ALTER TABLE "transactions" ADD FOREIGN KEY ("destination_account_id") REFERENCES "accounts" ("id");
+
+ALTER TABLE "transactions" ADD FOREIGN KEY ("fx_rate_id") REFERENCES "fx_rates" ("id");
+
+ALTER TABLE "transactions" ADD FOREIGN KEY ("reversal_of") REFERENCES "transactions" ("id");
+
+ALTER TABLE "holds" ADD FOREIGN KEY ("account_id") REFERENCES "accounts" ("id");
+
+ALTER TABLE "holds" ADD FOREIGN KEY ("destination_account_id") REFERENCES "accounts" ("id");
+
+ALTER TABLE "holds" ADD FOREIGN KEY ("transaction_id") REFERENCES "transactions" ("id");
+
+ALTER TABLE "scheduled_transfers" ADD FOREIGN KEY ("source_account_id") REFERENCES "accounts" ("id");
+
+ALTER TABLE "scheduled_transfers" ADD FOREIGN KEY ("destination_account_id") REFERENCES "accounts" ("id");
+
+ALTER TABLE "scheduled_transfer_runs" ADD FOREIGN KEY ("scheduled_transfer_id") REFERENCES "scheduled_transfers" ("id");
+
+ALTER TABLE "scheduled_transfer_runs" ADD FOREIGN KEY ("transaction_id") REFERENCES "transactions" ("id");
+
+ALTER TABLE "entries" ADD FOREIGN KEY ("transaction_id") REFERENCES "transactions" ("id");
+
+ALTER TABLE "entries" ADD FOREIGN KEY ("account_id") REFERENCES "accounts" ("id");
+
+-- Every transaction's legs must net to zero in each currency once the DB transaction that wrote them commits
+CREATE FUNCTION check_entries_balanced() RETURNS trigger AS $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM entries WHERE transaction_id = NEW.transaction_id
+    GROUP BY currency HAVING SUM(amount) <> 0
+  ) THEN
+    RAISE EXCEPTION 'entries of transaction % do not sum to zero', NEW.transaction_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER entries_balanced
+AFTER INSERT OR UPDATE ON entries
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION check_entries_balanced();
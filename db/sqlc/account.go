@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"transfers/util"
+)
+
+// Statuses of an account. Only active accounts can be debited or credited.
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	AccountClosed = "closed"
+)
+
+// Types of account, which set how low their balance may go
+const (
+	// Cash accounts cannot go below zero
+	AccountCash = "cash"
+	// Credit accounts can go down to their negative floor, the credit limit
+	AccountCredit = "credit"
+	// System and settlement accounts have no floor
+	AccountSystem = "system"
+)
+
+// maxAllocateAttempts caps the IDs that AllocateAccount tries, as each one taken moves the sequence past the taken IDs
+const maxAllocateAttempts = 10
+
+/*
+CreateAccount creates an account with the ID of arg, failing with ErrDuplicateAccount when the ID is taken,
+including by a concurrent request. The ID sequence is moved past the ID in the same transaction, so that
+AllocateAccount does not hand it out again.
+*/
+func (s *PgxStore) CreateAccount(ctx context.Context, arg *CreateAccountParams) (*Account, error) {
+	var account *Account
+	err := s.doTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted}, func(tx DBTX) error {
+		q := New(tx)
+		var err error
+		account, err = q.CreateAccount(ctx, arg)
+		if err != nil {
+			if isPgError(err, uniqueViolation, accountsPkey) {
+				return util.NewAccountAlreadyExistsError(arg.ID)
+			}
+			return toDBError(err)
+		}
+		if err = q.AdvanceAccountIDSequence(ctx); err != nil {
+			return toDBError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+/*
+AllocateAccount creates an account with the next ID from the sequence. CreateAccount keeps the sequence past the IDs
+that clients choose, and when an ID is taken anyway, by an account created before that or concurrently, the sequence
+is moved past every taken ID before trying again. It gives up after maxAllocateAttempts, or once ctx is done.
+*/
+func (s *PgxStore) AllocateAccount(ctx context.Context, param *CreateAccountWithNextIDParams) (*Account, error) {
+	var account *Account
+	err := s.doTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted}, func(tx DBTX) error {
+		q := New(tx)
+		for attempt := 0; attempt < maxAllocateAttempts; attempt++ {
+			if err := ctx.Err(); err != nil {
+				return toDBError(err)
+			}
+			var err error
+			account, err = q.CreateAccountWithNextID(ctx, param)
+			if errors.Is(err, pgx.ErrNoRows) {
+				// The ID was taken
+				if err = q.AdvanceAccountIDSequence(ctx); err != nil {
+					return toDBError(err)
+				}
+				continue
+			}
+			if err != nil {
+				return toDBError(err)
+			}
+			return nil
+		}
+		return util.NewAccountIDUnavailableError(maxAllocateAttempts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+/*
+SetAccountStatus freezes, unfreezes or closes an account. The account is locked like a transfer would, so the change
+is ordered with the transfers to and from it. Closed accounts cannot be changed, and an account is only closed once
+it has a zero balance and no active holds.
+*/
+func (s *PgxStore) SetAccountStatus(ctx context.Context, id int64, status string) (*Account, error) {
+	var account *Account
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		current, err := q.GetAccountForUpdate(ctx, id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return util.NewAccountNotFoundError(id)
+			}
+			return toDBError(err)
+		}
+		if current.Status == AccountClosed {
+			return util.NewAccountClosedError(id)
+		}
+		if status == AccountClosed && (current.Balance.Sign() != 0 || current.Held.Sign() != 0) {
+			return util.NewAccountNotEmptyError(id, current.Balance.String(), current.Held.String())
+		}
+		account, err = q.UpdateAccountStatus(ctx, &UpdateAccountStatusParams{
+			ID:     id,
+			Status: status,
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// RequireActive checks that the account can be debited or credited
+func (a *Account) RequireActive() error {
+	if a.Status != AccountActive {
+		return util.NewAccountNotActiveError(a.ID, a.Status)
+	}
+	return nil
+}
+
+// AvailableBalance returns how much can be debited from the account: its balance less the amount held and its floor.
+// Accounts without a floor can always be debited, and for them this is the balance less the amount held.
+func (a *Account) AvailableBalance() (util.Money, error) {
+	available, err := a.Balance.Sub(a.Held)
+	if err != nil || a.BalanceFloor == nil {
+		return available, err
+	}
+	return available.Sub(*a.BalanceFloor)
+}
@@ -7,26 +7,200 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"transfers/util"
 )
 
+const addAccountBalance = `-- name: AddAccountBalance :one
+UPDATE accounts
+SET balance = balance + $1,
+    version = version + 1
+WHERE id = $2
+RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
+`
+
+type AddAccountBalanceParams struct {
+	Amount util.Money `json:"amount"`
+	ID     int64      `json:"id"`
+}
+
+func (q *Queries) AddAccountBalance(ctx context.Context, arg *AddAccountBalanceParams) (*Account, error) {
+	row := q.db.QueryRow(ctx, addAccountBalance, arg.Amount, arg.ID)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
+	return &i, err
+}
+
+const addAccountHeld = `-- name: AddAccountHeld :one
+UPDATE accounts
+SET held = held + $1,
+    version = version + 1
+WHERE id = $2
+RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
+`
+
+type AddAccountHeldParams struct {
+	Amount util.Money `json:"amount"`
+	ID     int64      `json:"id"`
+}
+
+func (q *Queries) AddAccountHeld(ctx context.Context, arg *AddAccountHeldParams) (*Account, error) {
+	row := q.db.QueryRow(ctx, addAccountHeld, arg.Amount, arg.ID)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
+	return &i, err
+}
+
+const advanceAccountIDSequence = `-- name: AdvanceAccountIDSequence :exec
+SELECT setval('accounts_id_seq', (SELECT max(id) FROM accounts))
+FROM accounts_id_seq
+WHERE last_value < (SELECT max(id) FROM accounts)
+`
+
+func (q *Queries) AdvanceAccountIDSequence(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, advanceAccountIDSequence)
+	return err
+}
+
 const createAccount = `-- name: CreateAccount :one
 INSERT INTO accounts (
   id,
-  balance
+  balance,
+  currency,
+  type,
+  balance_floor,
+  display_name,
+  owner_reference,
+  labels,
+  initial_balance
 ) VALUES (
-  $1, $2
-) RETURNING id, balance, created_at
+  $1, $2, $3, $4, $5, $6, $7, $8, $2
+) RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
 `
 
 type CreateAccountParams struct {
-	ID      int64  `json:"id"`
-	Balance string `json:"balance"`
+	ID             int64       `json:"id"`
+	Balance        util.Money  `json:"balance"`
+	Currency       string      `json:"currency"`
+	Type           string      `json:"type"`
+	BalanceFloor   *util.Money `json:"balance_floor"`
+	DisplayName    string      `json:"display_name"`
+	OwnerReference string      `json:"owner_reference"`
+	Labels         util.Labels `json:"labels"`
 }
 
 func (q *Queries) CreateAccount(ctx context.Context, arg *CreateAccountParams) (*Account, error) {
-	row := q.db.QueryRow(ctx, createAccount, arg.ID, arg.Balance)
+	row := q.db.QueryRow(ctx, createAccount,
+		arg.ID,
+		arg.Balance,
+		arg.Currency,
+		arg.Type,
+		arg.BalanceFloor,
+		arg.DisplayName,
+		arg.OwnerReference,
+		arg.Labels,
+	)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
+	return &i, err
+}
+
+const createAccountWithNextID = `-- name: CreateAccountWithNextID :one
+INSERT INTO accounts (
+  balance,
+  currency,
+  type,
+  balance_floor,
+  display_name,
+  owner_reference,
+  labels,
+  initial_balance
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $1
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
+`
+
+type CreateAccountWithNextIDParams struct {
+	Balance        util.Money  `json:"balance"`
+	Currency       string      `json:"currency"`
+	Type           string      `json:"type"`
+	BalanceFloor   *util.Money `json:"balance_floor"`
+	DisplayName    string      `json:"display_name"`
+	OwnerReference string      `json:"owner_reference"`
+	Labels         util.Labels `json:"labels"`
+}
+
+func (q *Queries) CreateAccountWithNextID(ctx context.Context, arg *CreateAccountWithNextIDParams) (*Account, error) {
+	row := q.db.QueryRow(ctx, createAccountWithNextID,
+		arg.Balance,
+		arg.Currency,
+		arg.Type,
+		arg.BalanceFloor,
+		arg.DisplayName,
+		arg.OwnerReference,
+		arg.Labels,
+	)
 	var i Account
-	err := row.Scan(&i.ID, &i.Balance, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
 	return &i, err
 }
 
@@ -50,19 +224,33 @@ func (q *Queries) DeleteAllAccounts(ctx context.Context) error {
 }
 
 const getAccount = `-- name: GetAccount :one
-SELECT id, balance, created_at FROM accounts
+SELECT id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance FROM accounts
 WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetAccount(ctx context.Context, id int64) (*Account, error) {
 	row := q.db.QueryRow(ctx, getAccount, id)
 	var i Account
-	err := row.Scan(&i.ID, &i.Balance, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
 	return &i, err
 }
 
 const getAccountForUpdate = `-- name: GetAccountForUpdate :one
-SELECT id, balance, created_at FROM accounts
+SELECT id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance FROM accounts
 WHERE id = $1 LIMIT 1
 FOR NO KEY UPDATE
 `
@@ -70,25 +258,227 @@ FOR NO KEY UPDATE
 func (q *Queries) GetAccountForUpdate(ctx context.Context, id int64) (*Account, error) {
 	row := q.db.QueryRow(ctx, getAccountForUpdate, id)
 	var i Account
-	err := row.Scan(&i.ID, &i.Balance, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
 	return &i, err
 }
 
+const listAccounts = `-- name: ListAccounts :many
+SELECT id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance FROM accounts
+WHERE ($1::text = '' OR owner_reference = $1)
+  AND labels @> $2
+  AND id < $3
+ORDER BY id DESC
+LIMIT $4
+`
+
+type ListAccountsParams struct {
+	OwnerReference string      `json:"owner_reference"`
+	Labels         util.Labels `json:"labels"`
+	BeforeID       int64       `json:"before_id"`
+	PageSize       int32       `json:"page_size"`
+}
+
+func (q *Queries) ListAccounts(ctx context.Context, arg *ListAccountsParams) ([]*Account, error) {
+	rows, err := q.db.Query(ctx, listAccounts,
+		arg.OwnerReference,
+		arg.Labels,
+		arg.BeforeID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Account
+	for rows.Next() {
+		var i Account
+		if err := rows.Scan(
+			&i.ID,
+			&i.Balance,
+			&i.Currency,
+			&i.CreatedAt,
+			&i.Version,
+			&i.Held,
+			&i.Status,
+			&i.Type,
+			&i.BalanceFloor,
+			&i.DisplayName,
+			&i.OwnerReference,
+			&i.Labels,
+			&i.InitialBalance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateAccount = `-- name: UpdateAccount :one
 UPDATE accounts
-SET balance = $2
+SET balance = $2,
+    version = version + 1
 WHERE id = $1
-RETURNING id, balance, created_at
+RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
 `
 
 type UpdateAccountParams struct {
-	ID      int64  `json:"id"`
-	Balance string `json:"balance"`
+	ID      int64      `json:"id"`
+	Balance util.Money `json:"balance"`
 }
 
 func (q *Queries) UpdateAccount(ctx context.Context, arg *UpdateAccountParams) (*Account, error) {
 	row := q.db.QueryRow(ctx, updateAccount, arg.ID, arg.Balance)
 	var i Account
-	err := row.Scan(&i.ID, &i.Balance, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
+	return &i, err
+}
+
+const updateAccountIfVersion = `-- name: UpdateAccountIfVersion :one
+UPDATE accounts
+SET balance = $2,
+    version = version + 1
+WHERE id = $1 AND version = $3
+RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
+`
+
+type UpdateAccountIfVersionParams struct {
+	ID      int64      `json:"id"`
+	Balance util.Money `json:"balance"`
+	Version int64      `json:"version"`
+}
+
+func (q *Queries) UpdateAccountIfVersion(ctx context.Context, arg *UpdateAccountIfVersionParams) (*Account, error) {
+	row := q.db.QueryRow(ctx, updateAccountIfVersion, arg.ID, arg.Balance, arg.Version)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
+	return &i, err
+}
+
+const updateAccountMetadata = `-- name: UpdateAccountMetadata :one
+UPDATE accounts
+SET display_name = COALESCE($1, display_name),
+    owner_reference = COALESCE($2, owner_reference),
+    labels = jsonb_strip_nulls(labels || $3::jsonb),
+    version = version + 1
+WHERE id = $4
+  AND ($5::bigint[] IS NULL OR version = ANY($5::bigint[]))
+  AND (SELECT count(*) FROM jsonb_object_keys(jsonb_strip_nulls(labels || $3::jsonb))) <= $6::bigint
+RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
+`
+
+type UpdateAccountMetadataParams struct {
+	DisplayName    pgtype.Text `json:"display_name"`
+	OwnerReference pgtype.Text `json:"owner_reference"`
+	Labels         []byte      `json:"labels"`
+	ID             int64       `json:"id"`
+	Versions       []int64     `json:"versions"`
+	MaxLabels      int64       `json:"max_labels"`
+}
+
+func (q *Queries) UpdateAccountMetadata(ctx context.Context, arg *UpdateAccountMetadataParams) (*Account, error) {
+	row := q.db.QueryRow(ctx, updateAccountMetadata,
+		arg.DisplayName,
+		arg.OwnerReference,
+		arg.Labels,
+		arg.ID,
+		arg.Versions,
+		arg.MaxLabels,
+	)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
+	return &i, err
+}
+
+const updateAccountStatus = `-- name: UpdateAccountStatus :one
+UPDATE accounts
+SET status = $2,
+    version = version + 1
+WHERE id = $1
+RETURNING id, balance, currency, created_at, version, held, status, type, balance_floor, display_name, owner_reference, labels, initial_balance
+`
+
+type UpdateAccountStatusParams struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+func (q *Queries) UpdateAccountStatus(ctx context.Context, arg *UpdateAccountStatusParams) (*Account, error) {
+	row := q.db.QueryRow(ctx, updateAccountStatus, arg.ID, arg.Status)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.Version,
+		&i.Held,
+		&i.Status,
+		&i.Type,
+		&i.BalanceFloor,
+		&i.DisplayName,
+		&i.OwnerReference,
+		&i.Labels,
+		&i.InitialBalance,
+	)
 	return &i, err
 }
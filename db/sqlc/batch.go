@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+
+	"transfers/util"
+)
+
+type CreateTransactionBatchParams struct {
+	Transfers []*CreateTransactionParams
+	// Make the transfers that can be made and report the ones that fail, instead of making none of them
+	BestEffort bool
+}
+
+// TransferBatchResult is the outcome of one transfer of a batch: its transaction, or why it was not made
+type TransferBatchResult struct {
+	Transaction *Transaction
+	Err         error
+}
+
+/*
+CreateTransactionBatch makes the transfers of a batch in a single DB transaction, returning a result per transfer.
+Every account involved is locked up front in the same descending ID order as single transfers, so batches cannot
+deadlock with each other or with transfers. Transfers are applied in order, so one may spend what an earlier one credited.
+Unless param.BestEffort, the first transfer that fails rolls back the whole batch.
+*/
+func (s *PgxStore) CreateTransactionBatch(ctx context.Context, param *CreateTransactionBatchParams) ([]*TransferBatchResult, error) {
+	var results []*TransferBatchResult
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		accountIDs := batchAccountIDs(param.Transfers)
+		accounts, err := lockAccounts(ctx, q, accountIDs)
+		if err != nil {
+			return err
+		}
+
+		results = make([]*TransferBatchResult, len(param.Transfers))
+		changed := map[int64]bool{}
+		for i, transfer := range param.Transfers {
+			results[i] = &TransferBatchResult{}
+			source, destination := accounts[transfer.SourceAccountID], accounts[transfer.DestinationAccountID]
+			sourceBalance, destinationBalance, err := transferBalances(source, destination, transfer)
+			if err != nil {
+				if !param.BestEffort {
+					return util.NewBatchTransferError(i, err)
+				}
+				results[i].Err = err
+				continue
+			}
+			source.Balance, destination.Balance = sourceBalance, destinationBalance
+			changed[source.ID], changed[destination.ID] = true, true
+
+			results[i].Transaction, err = q.CreateTransaction(ctx, transfer)
+			if err != nil {
+				return toDBError(err)
+			}
+			if err = createEntries(ctx, q, results[i].Transaction); err != nil {
+				return err
+			}
+		}
+
+		// Write each balance once, after all the transfers of the batch
+		for _, id := range accountIDs {
+			if !changed[id] {
+				continue
+			}
+			_, err := q.UpdateAccount(ctx, &UpdateAccountParams{
+				ID:      id,
+				Balance: accounts[id].Balance,
+			})
+			if err != nil {
+				return toDBError(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// batchAccountIDs returns the distinct accounts of transfers in lock order
+func batchAccountIDs(transfers []*CreateTransactionParams) []int64 {
+	var ids []int64
+	for _, transfer := range transfers {
+		ids = append(ids, transfer.SourceAccountID, transfer.DestinationAccountID)
+	}
+	return lockOrder(ids)
+}
+
+// lockOrder returns the distinct ids in the order accounts are locked, largest ID first like toCreateTransactionSqlParams
+func lockOrder(ids []int64) []int64 {
+	seen := map[int64]bool{}
+	var ordered []int64
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			ordered = append(ordered, id)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i] > ordered[j] })
+	return ordered
+}
+
+// lockAccounts locks the accounts with ids, which must already be in lock order, and returns them by ID
+func lockAccounts(ctx context.Context, q *Queries, ids []int64) (map[int64]*Account, error) {
+	accounts := make(map[int64]*Account, len(ids))
+	for _, id := range ids {
+		account, err := q.GetAccountForUpdate(ctx, id)
+		if err != nil {
+			return nil, toDBError(err)
+		}
+		accounts[id] = account
+	}
+	return accounts, nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"transfers/util"
+)
+
+// SQLSTATE codes of the Postgres errors that the store maps to its own errors
+const (
+	uniqueViolation      = "23505"
+	checkViolation       = "23514"
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// Constraints whose violations the store maps to its own errors
+const (
+	accountsPkey              = "accounts_pkey"
+	accountsBalanceFloorCheck = "accounts_balance_floor_check"
+)
+
+/*
+toDBError maps an error from the DB to an error of the store. Serialization failures and deadlocks are conflicts
+that can be retried, and an account going below its floor, with its balance or held amount, has insufficient balance.
+Any other error is a DB error.
+*/
+func toDBError(err error) error {
+	switch {
+	case isPgError(err, serializationFailure, ""), isPgError(err, deadlockDetected, ""):
+		return util.NewTransactionConflictError(err)
+	case isPgError(err, checkViolation, accountsBalanceFloorCheck):
+		return util.NewInsufficientBalanceError()
+	default:
+		return util.NewDBError(err)
+	}
+}
+
+// isPgError tells whether err is a Postgres error with code, violating constraint unless it is empty
+func isPgError(err error, code string, constraint string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == code && (constraint == "" || pgErr.ConstraintName == constraint)
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+
+	"transfers/util"
+)
+
+func TestToDBError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantType *errorx.Type
+	}{
+		{name: "serialization failure", err: &pgconn.PgError{Code: serializationFailure}, wantType: util.ErrTransactionConflict},
+		{name: "deadlock", err: &pgconn.PgError{Code: deadlockDetected}, wantType: util.ErrTransactionConflict},
+		{
+			name:     "wrapped serialization failure",
+			err:      fmt.Errorf("commit: %w", &pgconn.PgError{Code: serializationFailure}),
+			wantType: util.ErrTransactionConflict,
+		},
+		{
+			name:     "balance floor",
+			err:      &pgconn.PgError{Code: checkViolation, ConstraintName: accountsBalanceFloorCheck},
+			wantType: util.ErrInsufficientBalance,
+		},
+		{
+			name:     "other check",
+			err:      &pgconn.PgError{Code: checkViolation, ConstraintName: "accounts_type_floor_check"},
+			wantType: errorx.ExternalError,
+		},
+		{name: "unique violation", err: &pgconn.PgError{Code: uniqueViolation, ConstraintName: accountsPkey}, wantType: errorx.ExternalError},
+		{name: "message only", err: errors.New("ERROR: could not serialize access (SQLSTATE 40001)"), wantType: errorx.ExternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := toDBError(tt.err)
+			require.True(t, errorx.IsOfType(err, tt.wantType), "got %v", err)
+		})
+	}
+}
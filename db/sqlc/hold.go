@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"transfers/util"
+)
+
+// Statuses of a hold. Only active holds reserve funds.
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+/*
+PlaceHold reserves param.Amount of an account's available balance until the hold is captured, voided or expires.
+No money moves: the amount is added to the held amount of the account, which the balance floor constraint
+keeps within its balance, so a hold that does not fit in the available balance is rejected.
+*/
+func (s *PgxStore) PlaceHold(ctx context.Context, param *CreateHoldParams) (*Hold, error) {
+	var hold *Hold
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		account, err := q.AddAccountHeld(ctx, &AddAccountHeldParams{
+			ID:     param.AccountID,
+			Amount: param.Amount,
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		if err = account.RequireActive(); err != nil {
+			return err
+		}
+		hold, err = q.CreateHold(ctx, param)
+		if err != nil {
+			return toDBError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+type CaptureHoldParams struct {
+	HoldID int64
+	// Transfer of the captured amount from the held account, at most the amount of the hold
+	Transfer *CreateTransactionParams
+}
+
+/*
+CaptureHold turns an active hold into a transaction. The whole hold is released, and param.Transfer is made with the
+same row locks as CreateTransactionWithLock, so a partial capture gives the rest of the hold back to the account.
+*/
+func (s *PgxStore) CaptureHold(ctx context.Context, param *CaptureHoldParams) (*Hold, error) {
+	var hold *Hold
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		active, err := lockActiveHold(ctx, q, param.HoldID)
+		if err != nil {
+			return err
+		}
+		transfer := param.Transfer
+		if transfer.Amount.Sign() <= 0 || transfer.Amount.Cmp(active.Amount) > 0 {
+			return util.NewCaptureExceedsHoldError(transfer.Amount.String(), active.Amount.String())
+		}
+
+		// Prevent deadlock by locking both accounts in the same order as transfers before releasing the hold
+		sqlParam := toCreateTransactionSqlParams(transfer)
+		for _, id := range []int64{sqlParam.LowAccountID, sqlParam.HighAccountID} {
+			if _, err = q.GetAccountForUpdate(ctx, id); err != nil {
+				return toDBError(err)
+			}
+		}
+		_, err = q.AddAccountHeld(ctx, &AddAccountHeldParams{
+			ID:     active.AccountID,
+			Amount: active.Amount.Neg(),
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		err = updateBalancesWithLock(ctx, q, transfer)
+		if err != nil {
+			return err
+		}
+		transaction, err := q.CreateTransaction(ctx, transfer)
+		if err != nil {
+			return toDBError(err)
+		}
+		if err = createEntries(ctx, q, transaction); err != nil {
+			return err
+		}
+		hold, err = q.UpdateHoldStatus(ctx, &UpdateHoldStatusParams{
+			ID:             active.ID,
+			Status:         HoldCaptured,
+			CapturedAmount: transfer.Amount,
+			TransactionID:  pgtype.Int8{Int64: transaction.ID, Valid: true},
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// VoidHold releases an active hold without moving any money
+func (s *PgxStore) VoidHold(ctx context.Context, id int64) (*Hold, error) {
+	var hold *Hold
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		active, err := lockActiveHold(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		_, err = q.AddAccountHeld(ctx, &AddAccountHeldParams{
+			ID:     active.AccountID,
+			Amount: active.Amount.Neg(),
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		hold, err = q.UpdateHoldStatus(ctx, &UpdateHoldStatusParams{
+			ID:     active.ID,
+			Status: HoldVoided,
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+/*
+ReleaseExpiredHolds marks the active holds that expired by now as expired and releases their amounts, returning how
+many holds expired. Holds being captured or voided concurrently are locked, and are skipped once they are no longer active.
+*/
+func (s *PgxStore) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	var count int
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		holds, err := q.ExpireHolds(ctx, now)
+		if err != nil {
+			return toDBError(err)
+		}
+		released := map[int64]util.Money{}
+		for _, hold := range holds {
+			released[hold.AccountID], err = released[hold.AccountID].Add(hold.Amount)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Prevent deadlock by updating in consistent order based on accountID, like transfers
+		accountIDs := make([]int64, 0, len(released))
+		for id := range released {
+			accountIDs = append(accountIDs, id)
+		}
+		sort.Slice(accountIDs, func(i, j int) bool { return accountIDs[i] > accountIDs[j] })
+		for _, id := range accountIDs {
+			_, err = q.AddAccountHeld(ctx, &AddAccountHeldParams{
+				ID:     id,
+				Amount: released[id].Neg(),
+			})
+			if err != nil {
+				return toDBError(err)
+			}
+		}
+		count = len(holds)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// lockActiveHold locks the hold with id, which must still be active and not expired yet
+func lockActiveHold(ctx context.Context, q *Queries, id int64) (*Hold, error) {
+	hold, err := q.GetHoldForUpdate(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewHoldNotFoundError(id)
+		}
+		return nil, toDBError(err)
+	}
+	if hold.Status != HoldActive {
+		return nil, util.NewHoldNotActiveError(id, hold.Status)
+	}
+	if !hold.ExpiresAt.After(time.Now()) {
+		return nil, util.NewHoldNotActiveError(id, HoldExpired)
+	}
+	return hold, nil
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"transfers/util"
+)
+
+// IdempotentResponse is the response to a request made with an idempotency key, which is saved to be replayed
+type IdempotentResponse struct {
+	Status  int32
+	Body    []byte
+	Headers map[string]string
+}
+
+// IdempotentFunc handles a request made with an idempotency key, making its changes with ctx
+type IdempotentFunc func(ctx context.Context) (*IdempotentResponse, error)
+
+/*
+DoIdempotent handles a request made with the idempotency key of param with fn, claiming the key in the first
+transaction that fn makes and saving the response of fn in that transaction before it commits, so that changes are
+never committed without the key, nor the key without its response. Later transactions of fn are nested within the
+first one. A response of nil, as after a server error, or an error of fn rolls back what fn wrote, and releases the key.
+When an earlier request holds the key, fn writes nothing and its record is returned instead, to be replayed.
+*/
+func (s *PgxStore) DoIdempotent(ctx context.Context, param *CreateIdempotencyKeyParams, fn IdempotentFunc) (*IdempotencyKey, error) {
+	scope := &idempotencyScope{param: param}
+	response, err := fn(context.WithValue(ctx, idempotencyScopeKey{}, scope))
+	if err == nil && response != nil && scope.tx == nil && !scope.taken {
+		// fn made no transaction, as when it turned the request down, so the key is claimed with its response alone
+		err = scope.begin(ctx, s.dbConn, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	}
+	if scope.taken {
+		record, err := s.GetIdempotencyKey(ctx, param.Key)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				// The key expired and was released after our claim was attempted
+				return nil, util.NewIdempotencyKeyInProgressError(param.Key)
+			}
+			return nil, toDBError(err)
+		}
+		return record, nil
+	}
+	if err != nil || response == nil {
+		return nil, scope.rollback(ctx, err)
+	}
+
+	headers, err := json.Marshal(response.Headers)
+	if err != nil {
+		return nil, scope.rollback(ctx, err)
+	}
+	_, err = New(scope.tx).UpdateIdempotencyKeyResponse(ctx, &UpdateIdempotencyKeyResponseParams{
+		Key:             param.Key,
+		ResponseStatus:  response.Status,
+		ResponseBody:    response.Body,
+		ResponseHeaders: headers,
+	})
+	if err != nil {
+		return nil, scope.rollback(ctx, toDBError(err))
+	}
+	if err = scope.tx.Commit(ctx); err != nil {
+		return nil, toDBError(err)
+	}
+	return nil, nil
+}
+
+type idempotencyScopeKey struct{}
+
+// idempotencyScope is the transaction of a request made with an idempotency key, which claims the key
+type idempotencyScope struct {
+	param *CreateIdempotencyKeyParams
+	// Open from the first transaction of the request until its response is saved
+	tx pgx.Tx
+	// Whether an earlier request holds the key
+	taken bool
+}
+
+func idempotencyScopeOf(ctx context.Context) *idempotencyScope {
+	scope, _ := ctx.Value(idempotencyScopeKey{}).(*idempotencyScope)
+	return scope
+}
+
+// begin opens the transaction of the scope, claiming the key before anything else is written
+func (scope *idempotencyScope) begin(ctx context.Context, dbConn *pgxpool.Pool, txOptions pgx.TxOptions) error {
+	tx, err := dbConn.BeginTx(ctx, txOptions)
+	if err != nil {
+		return toDBError(err)
+	}
+	_, err = New(tx).CreateIdempotencyKey(ctx, scope.param)
+	if err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return util.NewDBError(rbErr).WithUnderlyingErrors(err)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			scope.taken = true
+			return util.NewIdempotencyKeyInProgressError(scope.param.Key)
+		}
+		return toDBError(err)
+	}
+	scope.tx = tx
+	return nil
+}
+
+/*
+doTx executes fn within the transaction of the scope, which the first call opens with txOptions. An error of that
+first call rolls back the claim too, so that a transfer retried after a conflict starts over from a new snapshot.
+Later calls are nested in savepoints, and an error of theirs only rolls back what they wrote.
+*/
+func (scope *idempotencyScope) doTx(ctx context.Context, dbConn *pgxpool.Pool, txOptions pgx.TxOptions, fn func(DBTX) error) error {
+	if scope.tx != nil {
+		tx := scope.tx
+		return doSavepoint(ctx, tx, func(*Queries) error {
+			return fn(tx)
+		})
+	}
+	if err := scope.begin(ctx, dbConn, txOptions); err != nil {
+		return err
+	}
+	if err := fn(scope.tx); err != nil {
+		return scope.rollback(ctx, err)
+	}
+	return nil
+}
+
+// rollback ends the transaction of the scope, if it is open, and returns err
+func (scope *idempotencyScope) rollback(ctx context.Context, err error) error {
+	if scope.tx == nil {
+		return err
+	}
+	tx := scope.tx
+	scope.tx = nil
+	if rbErr := tx.Rollback(ctx); rbErr != nil {
+		if err == nil {
+			return util.NewDBError(rbErr)
+		}
+		return util.NewDBError(rbErr).WithUnderlyingErrors(err)
+	}
+	return err
+}
+
+/*
+scopedDB runs the queries of a request made with an idempotency key in the transaction that claimed the key, once the
+request has opened it, so that the request reads what it wrote before the transaction commits. Other queries use
+the pool.
+*/
+type scopedDB struct {
+	pool *pgxpool.Pool
+}
+
+func (db scopedDB) conn(ctx context.Context) DBTX {
+	if scope := idempotencyScopeOf(ctx); scope != nil && scope.tx != nil {
+		return scope.tx
+	}
+	return db.pool
+}
+
+func (db scopedDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return db.conn(ctx).Exec(ctx, sql, args...)
+}
+
+func (db scopedDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return db.conn(ctx).Query(ctx, sql, args...)
+}
+
+func (db scopedDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return db.conn(ctx).QueryRow(ctx, sql, args...)
+}
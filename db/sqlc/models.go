@@ -6,20 +6,145 @@ package db
 
 import (
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"transfers/util"
 )
 
 type Account struct {
+	// chosen by the client, or allocated from the sequence
 	ID int64 `json:"id"`
-	// positive
-	Balance   string    `json:"balance"`
+	// at least balance_floor plus held
+	Balance util.Money `json:"balance"`
+	// ISO 4217 code
+	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
+	// incremented on every change
+	Version int64 `json:"version"`
+	// reserved by active holds, the available balance is balance - held
+	Held util.Money `json:"held"`
+	// active, frozen (no debits or credits) or closed (for good, at zero balance)
+	Status string `json:"status"`
+	// cash (floor 0), credit (negative floor, the credit limit) or system (no floor)
+	Type string `json:"type"`
+	// lowest the available balance may go, null for no floor
+	BalanceFloor *util.Money `json:"balance_floor"`
+	DisplayName  string      `json:"display_name"`
+	// external reference of the customer owning the account
+	OwnerReference string `json:"owner_reference"`
+	// string keys and values for grouping and filtering accounts
+	Labels util.Labels `json:"labels"`
+	// balance the account was created with, which its entries add up from
+	InitialBalance util.Money `json:"initial_balance"`
 }
 
-type Transaction struct {
+type Entry struct {
+	ID            int64 `json:"id"`
+	TransactionID int64 `json:"transaction_id"`
+	// null for the FX position legs of a cross-currency transaction
+	AccountID pgtype.Int8 `json:"account_id"`
+	// negative for debits, positive for credits
+	Amount    util.Money `json:"amount"`
+	Currency  string     `json:"currency"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type FxRate struct {
+	ID            int64  `json:"id"`
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+	// quote currency units per base currency unit
+	Rate          string    `json:"rate"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type Hold struct {
+	ID                   int64 `json:"id"`
+	AccountID            int64 `json:"account_id"`
+	DestinationAccountID int64 `json:"destination_account_id"`
+	// reserved in the currency of the held account
+	Amount   util.Money `json:"amount"`
+	Currency string     `json:"currency"`
+	// moved by the capture, the rest of the hold is released
+	CapturedAmount util.Money `json:"captured_amount"`
+	Status         string     `json:"status"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	// transaction created by the capture
+	TransactionID pgtype.Int8 `json:"transaction_id"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+type IdempotencyKey struct {
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+	// 0 until the response is saved, in the transaction that claims the key
+	ResponseStatus int32  `json:"response_status"`
+	ResponseBody   []byte `json:"response_body"`
+	// headers to replay with the response, such as ETag
+	ResponseHeaders []byte    `json:"response_headers"`
+	CreatedAt       time.Time `json:"created_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+type ScheduledTransfer struct {
 	ID                   int64 `json:"id"`
 	SourceAccountID      int64 `json:"source_account_id"`
 	DestinationAccountID int64 `json:"destination_account_id"`
-	// positive
-	Amount    string    `json:"amount"`
-	CreatedAt time.Time `json:"created_at"`
+	// debited from the source account in its currency on every occurrence
+	Amount     util.Money `json:"amount"`
+	Currency   string     `json:"currency"`
+	Recurrence string     `json:"recurrence"`
+	// time of the first occurrence, later ones recur from it
+	StartAt time.Time `json:"start_at"`
+	// no occurrences after this time, null for no end
+	EndAt pgtype.Timestamptz `json:"end_at"`
+	// null for no limit
+	MaxOccurrences pgtype.Int4 `json:"max_occurrences"`
+	// occurrences done, whether they succeeded or ran out of retries
+	Occurrences int32 `json:"occurrences"`
+	// failed attempts at the next occurrence
+	Attempt int32 `json:"attempt"`
+	// when the next attempt is due, null once there are no more occurrences
+	NextRunAt pgtype.Timestamptz `json:"next_run_at"`
+	Status    string             `json:"status"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type ScheduledTransferRun struct {
+	ID                  int64 `json:"id"`
+	ScheduledTransferID int64 `json:"scheduled_transfer_id"`
+	// starting from 1
+	Occurrence int32 `json:"occurrence"`
+	// starting from 1 for every occurrence
+	Attempt       int32       `json:"attempt"`
+	Status        string      `json:"status"`
+	TransactionID pgtype.Int8 `json:"transaction_id"`
+	Error         string      `json:"error"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+type Transaction struct {
+	ID              int64 `json:"id"`
+	SourceAccountID int64 `json:"source_account_id"`
+	// null for multi-leg transactions, which credit the accounts of their entries
+	DestinationAccountID pgtype.Int8 `json:"destination_account_id"`
+	// positive, debited from the source account in its currency
+	Amount   util.Money `json:"amount"`
+	Currency string     `json:"currency"`
+	// credited to the destination account in its currency, or split across the legs of a multi-leg transaction
+	DestinationAmount   util.Money `json:"destination_amount"`
+	DestinationCurrency string     `json:"destination_currency"`
+	// destination currency units per source currency unit
+	FxRate string `json:"fx_rate"`
+	// published rate the conversion was locked to, null when the client gave the rate
+	FxRateID  pgtype.Int8 `json:"fx_rate_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	// original transaction compensated by this reversal
+	ReversalOf  pgtype.Int8 `json:"reversal_of"`
+	Description string      `json:"description"`
+	// reference of the transfer in the client's system, not unique
+	ExternalReference string `json:"external_reference"`
+	// JSON object given by the client
+	Metadata util.Metadata `json:"metadata"`
 }
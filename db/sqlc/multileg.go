@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"transfers/util"
+)
+
+// TransactionLeg credits Amount to an account, in the currency of the transaction
+type TransactionLeg struct {
+	AccountID int64
+	Amount    util.Money
+}
+
+type MultiLegTransferParams struct {
+	SourceAccountID int64
+	// Debited from the source account, which the legs must add up to
+	Amount   util.Money
+	Currency string
+	Legs     []*TransactionLeg
+}
+
+/*
+CreateMultiLegTransfer debits one account and credits each of param.Legs in a single transaction, whose entries are
+its legs. Every account involved is locked in the same order as transfers, and the legs must net to zero with the debit.
+*/
+func (s *PgxStore) CreateMultiLegTransfer(ctx context.Context, param *MultiLegTransferParams) (*Transaction, error) {
+	var credits util.Money
+	ids := []int64{param.SourceAccountID}
+	for _, leg := range param.Legs {
+		var err error
+		credits, err = credits.Add(leg.Amount)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, leg.AccountID)
+	}
+	if credits.Cmp(param.Amount) != 0 {
+		return nil, util.NewUnbalancedLegsError(param.Amount.String(), credits.String())
+	}
+
+	var transaction *Transaction
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		accountIDs := lockOrder(ids)
+		accounts, err := lockAccounts(ctx, q, accountIDs)
+		if err != nil {
+			return err
+		}
+		source := accounts[param.SourceAccountID]
+		source.Balance, err = debitBalance(source, param.Amount)
+		if err != nil {
+			return err
+		}
+		for _, leg := range param.Legs {
+			account := accounts[leg.AccountID]
+			account.Balance, err = creditBalance(account, leg.Amount)
+			if err != nil {
+				return err
+			}
+		}
+		for _, id := range accountIDs {
+			_, err = q.UpdateAccount(ctx, &UpdateAccountParams{
+				ID:      id,
+				Balance: accounts[id].Balance,
+			})
+			if err != nil {
+				return toDBError(err)
+			}
+		}
+
+		transaction, err = q.CreateMultiLegTransaction(ctx, &CreateMultiLegTransactionParams{
+			SourceAccountID: param.SourceAccountID,
+			Amount:          param.Amount,
+			Currency:        param.Currency,
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		entries := []*CreateEntryParams{
+			{
+				AccountID: pgtype.Int8{Int64: param.SourceAccountID, Valid: true},
+				Amount:    param.Amount.Neg(),
+			},
+		}
+		for _, leg := range param.Legs {
+			entries = append(entries, &CreateEntryParams{
+				AccountID: pgtype.Int8{Int64: leg.AccountID, Valid: true},
+				Amount:    leg.Amount,
+			})
+		}
+		for _, entry := range entries {
+			entry.TransactionID = transaction.ID
+			entry.Currency = param.Currency
+			if _, err = q.CreateEntry(ctx, entry); err != nil {
+				return toDBError(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
@@ -6,17 +6,64 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"transfers/util"
 )
 
 type Querier interface {
+	AddAccountBalance(ctx context.Context, arg *AddAccountBalanceParams) (*Account, error)
+	AddAccountHeld(ctx context.Context, arg *AddAccountHeldParams) (*Account, error)
+	AdvanceAccountIDSequence(ctx context.Context) error
 	CreateAccount(ctx context.Context, arg *CreateAccountParams) (*Account, error)
+	CreateAccountWithNextID(ctx context.Context, arg *CreateAccountWithNextIDParams) (*Account, error)
+	CreateEntry(ctx context.Context, arg *CreateEntryParams) (*Entry, error)
+	CreateFxRate(ctx context.Context, arg *CreateFxRateParams) (int64, error)
+	CreateHold(ctx context.Context, arg *CreateHoldParams) (*Hold, error)
+	CreateIdempotencyKey(ctx context.Context, arg *CreateIdempotencyKeyParams) (*IdempotencyKey, error)
+	CreateMultiLegTransaction(ctx context.Context, arg *CreateMultiLegTransactionParams) (*Transaction, error)
+	CreateReversalTransaction(ctx context.Context, arg *CreateReversalTransactionParams) (*Transaction, error)
+	CreateScheduledTransfer(ctx context.Context, arg *CreateScheduledTransferParams) (*ScheduledTransfer, error)
+	CreateScheduledTransferRun(ctx context.Context, arg *CreateScheduledTransferRunParams) (*ScheduledTransferRun, error)
 	CreateTransaction(ctx context.Context, arg *CreateTransactionParams) (*Transaction, error)
 	DeleteAccount(ctx context.Context, id int64) error
 	DeleteAllAccounts(ctx context.Context) error
+	DeleteAllEntries(ctx context.Context) error
+	DeleteAllFxRates(ctx context.Context) error
+	DeleteAllHolds(ctx context.Context) error
+	DeleteAllScheduledTransferRuns(ctx context.Context) error
+	DeleteAllScheduledTransfers(ctx context.Context) error
 	DeleteAllTransactions(ctx context.Context) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	ExpireHolds(ctx context.Context, now time.Time) ([]*Hold, error)
 	GetAccount(ctx context.Context, id int64) (*Account, error)
 	GetAccountForUpdate(ctx context.Context, id int64) (*Account, error)
+	GetDueScheduledTransfer(ctx context.Context, now time.Time) (*ScheduledTransfer, error)
+	GetFxRate(ctx context.Context, arg *GetFxRateParams) (*FxRate, error)
+	GetHold(ctx context.Context, id int64) (*Hold, error)
+	GetHoldForUpdate(ctx context.Context, id int64) (*Hold, error)
+	GetIdempotencyKey(ctx context.Context, key string) (*IdempotencyKey, error)
+	GetScheduledTransfer(ctx context.Context, id int64) (*ScheduledTransfer, error)
+	GetTransaction(ctx context.Context, id int64) (*Transaction, error)
+	GetTransactionForUpdate(ctx context.Context, id int64) (*Transaction, error)
+	ListAccountStatementEntries(ctx context.Context, arg *ListAccountStatementEntriesParams) ([]*ListAccountStatementEntriesRow, error)
+	ListAccountTransactions(ctx context.Context, arg *ListAccountTransactionsParams) ([]*Transaction, error)
+	ListAccounts(ctx context.Context, arg *ListAccountsParams) ([]*Account, error)
+	ListEntriesByTransaction(ctx context.Context, transactionID int64) ([]*Entry, error)
+	ListReversals(ctx context.Context, reversalOf pgtype.Int8) ([]*Transaction, error)
+	ListScheduledTransferRuns(ctx context.Context, scheduledTransferID int64) ([]*ScheduledTransferRun, error)
+	ListTransactionsByExternalReference(ctx context.Context, arg *ListTransactionsByExternalReferenceParams) ([]*Transaction, error)
+	SumAccountEntries(ctx context.Context, arg *SumAccountEntriesParams) (util.Money, error)
+	SumEntriesByCurrency(ctx context.Context) ([]*SumEntriesByCurrencyRow, error)
+	SumReversals(ctx context.Context, reversalOf pgtype.Int8) (*SumReversalsRow, error)
 	UpdateAccount(ctx context.Context, arg *UpdateAccountParams) (*Account, error)
+	UpdateAccountIfVersion(ctx context.Context, arg *UpdateAccountIfVersionParams) (*Account, error)
+	UpdateAccountMetadata(ctx context.Context, arg *UpdateAccountMetadataParams) (*Account, error)
+	UpdateAccountStatus(ctx context.Context, arg *UpdateAccountStatusParams) (*Account, error)
+	UpdateHoldStatus(ctx context.Context, arg *UpdateHoldStatusParams) (*Hold, error)
+	UpdateIdempotencyKeyResponse(ctx context.Context, arg *UpdateIdempotencyKeyResponseParams) (*IdempotencyKey, error)
+	UpdateScheduledTransfer(ctx context.Context, arg *UpdateScheduledTransferParams) (*ScheduledTransfer, error)
 }
 
 var _ Querier = (*Queries)(nil)
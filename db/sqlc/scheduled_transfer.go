@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Recurrences of a scheduled transfer
+const (
+	RecurrenceOnce    = "once"
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+// Statuses of a scheduled transfer. Only active ones are run.
+const (
+	ScheduleActive    = "active"
+	ScheduleCompleted = "completed"
+	ScheduleFailed    = "failed"
+)
+
+// Statuses of a run of a scheduled transfer
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+/*
+ScheduledTransferFunc makes an attempt at the next occurrence of scheduled at now, returning the run to record and the
+update of the schedule. The money is moved with transfer, within the transaction that records the run.
+*/
+type ScheduledTransferFunc func(ctx context.Context, now time.Time, scheduled *ScheduledTransfer, transfer CreateTransactionFunc) (*CreateScheduledTransferRunParams, *UpdateScheduledTransferParams)
+
+// CreateScheduledTransfer creates a scheduled transfer in a transaction, so that a request made with an idempotency
+// key claims the key together with it
+func (s *PgxStore) CreateScheduledTransfer(ctx context.Context, arg *CreateScheduledTransferParams) (*ScheduledTransfer, error) {
+	var scheduled *ScheduledTransfer
+	err := s.doTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted}, func(tx DBTX) error {
+		var err error
+		scheduled, err = New(tx).CreateScheduledTransfer(ctx, arg)
+		if err != nil {
+			return toDBError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+/*
+RunDueScheduledTransfer locks the scheduled transfer that has been due the longest by now, skipping those locked by
+other schedulers, and makes an attempt at it with run. The transfer of the attempt, its run and the update of the
+schedule are saved in the transaction that holds the lock, so they are saved together or not at all, and other
+schedulers cannot make the same attempt. A transfer that fails is rolled back on its own, so that its failed run can
+still be saved. It returns false when none is due.
+*/
+func (s *PgxStore) RunDueScheduledTransfer(ctx context.Context, now time.Time, run ScheduledTransferFunc) (bool, error) {
+	found := false
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		scheduled, err := q.GetDueScheduledTransfer(ctx, now)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return toDBError(err)
+		}
+		found = true
+
+		transfer := func(ctx context.Context, param *CreateTransactionParams) (*Transaction, error) {
+			var transaction *Transaction
+			err := doSavepoint(ctx, tx, func(q *Queries) error {
+				var err error
+				transaction, err = createTransactionWithLock(ctx, q, param)
+				return err
+			})
+			return transaction, err
+		}
+		runParam, update := run(ctx, now, scheduled, transfer)
+		if _, err = q.CreateScheduledTransferRun(ctx, runParam); err != nil {
+			return toDBError(err)
+		}
+		if _, err = q.UpdateScheduledTransfer(ctx, update); err != nil {
+			return toDBError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"transfers/util"
+)
+
+type AccountStatementParams struct {
+	AccountID int64
+	// Movements from From, inclusive, to To, exclusive
+	From time.Time
+	To   time.Time
+}
+
+// AccountStatement is the history of an account over a period
+type AccountStatement struct {
+	Account *Account
+	// Balance before the first movement of the period
+	OpeningBalance util.Money
+	// Entries of the account in the period, oldest first
+	Entries []*ListAccountStatementEntriesRow
+}
+
+// StatementVisitor receives a statement as it is read: its account and opening balance first, then each of its entries
+type StatementVisitor interface {
+	Open(account *Account, openingBalance util.Money) error
+	Entry(entry *ListAccountStatementEntriesRow) error
+}
+
+/*
+GetAccountStatement reads the entries of an account in a period, and its balance before them. The balance adds up the
+initial balance of the account and its entries, not the balance of the account which changes as transfers are made.
+Both are read from the same snapshot, so that transfers made meanwhile cannot leave a gap between them.
+*/
+func (s *PgxStore) GetAccountStatement(ctx context.Context, param *AccountStatementParams) (*AccountStatement, error) {
+	statement := &AccountStatement{}
+	txOptions := pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		account, opening, err := openStatement(ctx, q, param)
+		if err != nil {
+			return err
+		}
+		statement.Account, statement.OpeningBalance = account, opening
+		return queryStatementEntries(ctx, tx, param, func(entry *ListAccountStatementEntriesRow) error {
+			statement.Entries = append(statement.Entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+/*
+StreamAccountStatement reads the same statement as GetAccountStatement, but hands each entry to visitor as its row
+arrives from the database instead of collecting them, so that the statement of a busy account is never held in memory.
+An error returned by visitor stops the statement and is returned as it is.
+*/
+func (s *PgxStore) StreamAccountStatement(ctx context.Context, param *AccountStatementParams, visitor StatementVisitor) error {
+	txOptions := pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	}
+	return s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		account, opening, err := openStatement(ctx, q, param)
+		if err != nil {
+			return err
+		}
+		if err = visitor.Open(account, opening); err != nil {
+			return err
+		}
+		return queryStatementEntries(ctx, tx, param, visitor.Entry)
+	})
+}
+
+/*
+queryStatementEntries runs the ListAccountStatementEntries query of a statement, handing each entry to fn as its row
+arrives: GetAccountStatement collects them, and StreamAccountStatement visits them. An error returned by fn stops the
+query and is returned as it is.
+*/
+func queryStatementEntries(ctx context.Context, tx DBTX, param *AccountStatementParams, fn func(*ListAccountStatementEntriesRow) error) error {
+	rows, err := tx.Query(ctx, listAccountStatementEntries, param.AccountID, param.From, param.To)
+	if err != nil {
+		return toDBError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry, err := scanStatementEntry(rows)
+		if err != nil {
+			return toDBError(err)
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return toDBError(err)
+	}
+	return nil
+}
+
+// scanStatementEntry scans a row of the ListAccountStatementEntries query, in the column order of the generated code
+func scanStatementEntry(row pgx.Row) (*ListAccountStatementEntriesRow, error) {
+	var i ListAccountStatementEntriesRow
+	err := row.Scan(
+		&i.ID,
+		&i.TransactionID,
+		&i.Amount,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.SourceAccountID,
+		&i.DestinationAccountID,
+		&i.Description,
+		&i.ExternalReference,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// openStatement reads the account of a statement and its balance at the start of the period
+func openStatement(ctx context.Context, q *Queries, param *AccountStatementParams) (*Account, util.Money, error) {
+	account, err := q.GetAccount(ctx, param.AccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.Money{}, util.NewAccountNotFoundError(param.AccountID)
+		}
+		return nil, util.Money{}, toDBError(err)
+	}
+	total, err := q.SumAccountEntries(ctx, &SumAccountEntriesParams{
+		AccountID: param.AccountID,
+		Before:    param.From,
+	})
+	if err != nil {
+		return nil, util.Money{}, toDBError(err)
+	}
+	opening, err := account.InitialBalance.Add(total)
+	if err != nil {
+		return nil, util.Money{}, err
+	}
+	return account, opening, nil
+}
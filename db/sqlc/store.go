@@ -1,14 +1,13 @@
 package db
 
 import (
-	"bytes"
 	"context"
-	"math/rand"
-	"strings"
-	"text/template"
+	"errors"
+	"math/big"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"transfers/util"
@@ -18,6 +17,21 @@ type Store interface {
 	Querier
 	CreateTransactionWithLock(ctx context.Context, param *CreateTransactionParams) (*Transaction, error)
 	CreateTransactionWithSSI(ctx context.Context, param *CreateTransactionParams) (*Transaction, error)
+	CreateTransactionWithVersion(ctx context.Context, param *CreateTransactionParams) (*Transaction, error)
+	CreateTransactionBatch(ctx context.Context, param *CreateTransactionBatchParams) ([]*TransferBatchResult, error)
+	CreateMultiLegTransfer(ctx context.Context, param *MultiLegTransferParams) (*Transaction, error)
+	ReverseTransaction(ctx context.Context, param *ReverseTransactionParams) (*Transaction, error)
+	PlaceHold(ctx context.Context, param *CreateHoldParams) (*Hold, error)
+	CaptureHold(ctx context.Context, param *CaptureHoldParams) (*Hold, error)
+	VoidHold(ctx context.Context, id int64) (*Hold, error)
+	ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error)
+	AllocateAccount(ctx context.Context, param *CreateAccountWithNextIDParams) (*Account, error)
+	SetAccountStatus(ctx context.Context, id int64, status string) (*Account, error)
+	RunDueScheduledTransfer(ctx context.Context, now time.Time, run ScheduledTransferFunc) (bool, error)
+	GetAccountStatement(ctx context.Context, param *AccountStatementParams) (*AccountStatement, error)
+	StreamAccountStatement(ctx context.Context, param *AccountStatementParams, visitor StatementVisitor) error
+	CheckEntriesBalanced(ctx context.Context) error
+	DoIdempotent(ctx context.Context, param *CreateIdempotencyKeyParams, fn IdempotentFunc) (*IdempotencyKey, error)
 }
 
 type CreateTransactionFunc func(context.Context, *CreateTransactionParams) (*Transaction, error)
@@ -30,191 +44,444 @@ type PgxStore struct {
 func NewPgxStore(dbConn *pgxpool.Pool) *PgxStore {
 	return &PgxStore{
 		dbConn:  dbConn,
-		Queries: New(dbConn),
+		Queries: New(scopedDB{pool: dbConn}),
 	}
 }
 
 // CreateTransactionWithLock handles creating transaction and updating account balances safely with DB locking
 func (s *PgxStore) CreateTransactionWithLock(ctx context.Context, param *CreateTransactionParams) (*Transaction, error) {
-	// Prevent deadlock by updating in consistent order based on accountID
-	sqlParam := toCreateTransactionSqlParams(param)
-
 	var transaction *Transaction
 	var err error
 	txOptions := pgx.TxOptions{
 		IsoLevel: pgx.ReadCommitted,
 	}
 	err = s.doTx(ctx, txOptions, func(tx DBTX) error {
+		transaction, err = createTransactionWithLock(ctx, New(tx), param)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// createTransactionWithLock makes the transfer of param with q, locking both account rows until q's transaction ends
+func createTransactionWithLock(ctx context.Context, q *Queries, param *CreateTransactionParams) (*Transaction, error) {
+	err := updateBalancesWithLock(ctx, q, param)
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := q.CreateTransaction(ctx, param)
+	if err != nil {
+		return nil, toDBError(err)
+	}
+	if err = createEntries(ctx, q, transaction); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// updateBalancesWithLock moves param.Amount between the accounts of param, locking both account rows
+func updateBalancesWithLock(ctx context.Context, q *Queries, param *CreateTransactionParams) error {
+	// Prevent deadlock by updating in consistent order based on accountID
+	sqlParam := toCreateTransactionSqlParams(param)
+
+	lowAccount, err := q.GetAccountForUpdate(ctx, sqlParam.LowAccountID)
+	if err != nil {
+		return toDBError(err)
+	}
+	highAccount, err := q.GetAccountForUpdate(ctx, sqlParam.HighAccountID)
+	if err != nil {
+		return toDBError(err)
+	}
+	sourceAccount, destinationAccount := lowAccount, highAccount
+	if param.SourceAccountID == sqlParam.HighAccountID {
+		sourceAccount, destinationAccount = highAccount, lowAccount
+	}
+
+	sourceBalance, destinationBalance, err := transferBalances(sourceAccount, destinationAccount, param)
+	if err != nil {
+		return err
+	}
+
+	// Write updates to DB
+	_, err = q.UpdateAccount(ctx, &UpdateAccountParams{
+		ID:      sourceAccount.ID,
+		Balance: sourceBalance,
+	})
+	if err != nil {
+		return toDBError(err)
+	}
+	_, err = q.UpdateAccount(ctx, &UpdateAccountParams{
+		ID:      destinationAccount.ID,
+		Balance: destinationBalance,
+	})
+	if err != nil {
+		return toDBError(err)
+	}
+	return nil
+}
+
+// transferBalances returns the balances of source and destination after param is debited from source and credited to destination.
+// Only the available balance of source, which excludes the amount reserved by holds, can be debited.
+func transferBalances(source *Account, destination *Account, param *CreateTransactionParams) (util.Money, util.Money, error) {
+	sourceBalance, err := debitBalance(source, param.Amount)
+	if err != nil {
+		return util.Money{}, util.Money{}, err
+	}
+	destinationBalance, err := creditBalance(destination, param.DestinationAmount)
+	if err != nil {
+		return util.Money{}, util.Money{}, err
+	}
+	return sourceBalance, destinationBalance, nil
+}
+
+// debitBalance returns the balance of account after amount is debited from its available balance, which only accounts with a floor run out of
+func debitBalance(account *Account, amount util.Money) (util.Money, error) {
+	if err := account.RequireActive(); err != nil {
+		return util.Money{}, err
+	}
+	available, err := account.AvailableBalance()
+	if err != nil {
+		return util.Money{}, err
+	}
+	if account.BalanceFloor != nil && available.Cmp(amount) < 0 {
+		return util.Money{}, util.NewInsufficientBalanceError()
+	}
+	return account.Balance.Sub(amount)
+}
+
+// creditBalance returns the balance of account after amount is credited to it
+func creditBalance(account *Account, amount util.Money) (util.Money, error) {
+	if err := account.RequireActive(); err != nil {
+		return util.Money{}, err
+	}
+	return account.Balance.Add(amount)
+}
+
+type ReverseTransactionParams struct {
+	TransactionID int64
+	// Amount to reverse, or nil to reverse everything not reversed yet
+	Amount *util.Money
+	// Rounding of the share of the destination amount taken back by a partial reversal
+	Rounding util.RoundingMode
+}
+
+/*
+ReverseTransaction creates a compensating transaction that moves money back from the destination to the source
+of the original transaction. Partial reversals are allowed, as long as the reversals of a transaction never add
+up to more than its amount. The original transaction is locked so that concurrent reversals are checked in turn.
+*/
+func (s *PgxStore) ReverseTransaction(ctx context.Context, param *ReverseTransactionParams) (*Transaction, error) {
+	var reversal *Transaction
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
 		q := New(tx)
 
-		lowAccount, err := q.GetAccountForUpdate(ctx, sqlParam.LowAccountID)
+		original, err := q.GetTransactionForUpdate(ctx, param.TransactionID)
 		if err != nil {
-			return util.NewDBError(err)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return util.NewTransactionNotFoundError(param.TransactionID)
+			}
+			return toDBError(err)
 		}
-		highAccount, err := q.GetAccountForUpdate(ctx, sqlParam.HighAccountID)
-		if err != nil {
-			return util.NewDBError(err)
+		if original.ReversalOf.Valid {
+			return util.NewReversalOfReversalError(original.ID)
 		}
-		sourceAccount, destinationAccount := lowAccount, highAccount
-		if param.SourceAccountID == sqlParam.HighAccountID {
-			sourceAccount, destinationAccount = highAccount, lowAccount
+		if !original.DestinationAccountID.Valid {
+			return util.NewReversalOfMultiLegError(original.ID)
 		}
+		originalID := pgtype.Int8{Int64: original.ID, Valid: true}
 
-		// Check and update balances
-		transferAmount, err := util.StringToAmount(param.Amount)
+		// Work out how much of the original is left to reverse, in the currency of its source account.
+		// Reversals move money the other way, so they credit their destination amount to the original source.
+		reversedTotal, err := q.SumReversals(ctx, originalID)
 		if err != nil {
-			return err
+			return toDBError(err)
 		}
-		sourceBalance, err := util.StringToAmount(sourceAccount.Balance)
+		remaining, err := original.Amount.Sub(reversedTotal.DestinationAmount)
 		if err != nil {
 			return err
 		}
-		destinationBalance, err := util.StringToAmount(destinationAccount.Balance)
+		amount := remaining
+		if param.Amount != nil {
+			amount = *param.Amount
+		}
+		if amount.Sign() <= 0 || amount.Cmp(remaining) > 0 {
+			return util.NewReversalExceedsRemainingError(amount.String(), remaining.String())
+		}
+		sourceCurrency, err := util.LookupCurrency(original.Currency)
 		if err != nil {
 			return err
 		}
-		if sourceBalance.Cmp(&transferAmount) < 0 {
-			return util.NewInsufficientBalanceError()
+		if err = sourceCurrency.ValidateAmount(amount); err != nil {
+			return err
 		}
-		sourceBalance.Sub(&sourceBalance, &transferAmount)
-		destinationBalance.Add(&destinationBalance, &transferAmount)
 
-		// Write updates to DB
-		_, err = q.UpdateAccount(ctx, &UpdateAccountParams{
-			ID:      sourceAccount.ID,
-			Balance: util.AmountToString(sourceBalance),
-		})
+		// Take back the same share of the destination amount, leaving no rounding residue after the last reversal
+		destinationCurrency, err := util.LookupCurrency(original.DestinationCurrency)
 		if err != nil {
-			return util.NewDBError(err)
+			return err
+		}
+		var destinationAmount util.Money
+		if amount.Cmp(remaining) == 0 {
+			destinationAmount, err = original.DestinationAmount.Sub(reversedTotal.Amount)
+		} else {
+			share := new(big.Rat).Mul(original.DestinationAmount.Rat(), amount.Rat())
+			destinationAmount, err = destinationCurrency.RoundWith(*share.Quo(share, original.Amount.Rat()), param.Rounding)
 		}
-		_, err = q.UpdateAccount(ctx, &UpdateAccountParams{
-			ID:      destinationAccount.ID,
-			Balance: util.AmountToString(destinationBalance),
-		})
 		if err != nil {
-			return util.NewDBError(err)
+			return err
 		}
-		transaction, err = q.CreateTransaction(ctx, param)
+		if destinationAmount.Sign() <= 0 {
+			return util.NewInvalidAmountError(amount.String())
+		}
+		fxRate, err := util.ParseFxRate(original.FxRate)
 		if err != nil {
-			return util.NewDBError(err)
+			return err
 		}
-		return nil
+
+		reverseParam := &CreateTransactionParams{
+			SourceAccountID:      original.DestinationAccountID.Int64,
+			DestinationAccountID: original.SourceAccountID,
+			Amount:               destinationAmount,
+			Currency:             original.DestinationCurrency,
+			DestinationAmount:    amount,
+			DestinationCurrency:  original.Currency,
+			FxRate:               util.FxRateToString(util.InvertFxRate(fxRate)),
+		}
+		err = updateBalancesWithLock(ctx, q, reverseParam)
+		if err != nil {
+			return err
+		}
+		reversal, err = q.CreateReversalTransaction(ctx, &CreateReversalTransactionParams{
+			SourceAccountID:      reverseParam.SourceAccountID,
+			DestinationAccountID: reverseParam.DestinationAccountID,
+			Amount:               reverseParam.Amount,
+			Currency:             reverseParam.Currency,
+			DestinationAmount:    reverseParam.DestinationAmount,
+			DestinationCurrency:  reverseParam.DestinationCurrency,
+			FxRate:               reverseParam.FxRate,
+			ReversalOf:           originalID,
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		return createEntries(ctx, q, reversal)
 	})
 	if err != nil {
 		return nil, err
 	}
-	return transaction, nil
+	return reversal, nil
+}
+
+// createEntries records the debit and credit legs of transaction in the journal.
+// A cross-currency transaction also gets a leg in each currency against the FX position, so that every currency nets to zero.
+func createEntries(ctx context.Context, q *Queries, transaction *Transaction) error {
+	legs := []*CreateEntryParams{
+		{
+			AccountID: pgtype.Int8{Int64: transaction.SourceAccountID, Valid: true},
+			Amount:    transaction.Amount.Neg(),
+			Currency:  transaction.Currency,
+		},
+	}
+	if transaction.Currency != transaction.DestinationCurrency {
+		legs = append(legs,
+			&CreateEntryParams{Amount: transaction.Amount, Currency: transaction.Currency},
+			&CreateEntryParams{Amount: transaction.DestinationAmount.Neg(), Currency: transaction.DestinationCurrency},
+		)
+	}
+	legs = append(legs, &CreateEntryParams{
+		AccountID: transaction.DestinationAccountID,
+		Amount:    transaction.DestinationAmount,
+		Currency:  transaction.DestinationCurrency,
+	})
+	for _, leg := range legs {
+		leg.TransactionID = transaction.ID
+		_, err := q.CreateEntry(ctx, leg)
+		if err != nil {
+			return toDBError(err)
+		}
+	}
+	return nil
+}
+
+// CheckEntriesBalanced verifies the double-entry invariant that the journal legs in each currency sum to zero
+func (s *PgxStore) CheckEntriesBalanced(ctx context.Context) error {
+	totals, err := s.SumEntriesByCurrency(ctx)
+	if err != nil {
+		return toDBError(err)
+	}
+	for _, total := range totals {
+		if total.Total.Sign() != 0 {
+			return util.NewUnbalancedEntriesError(total.Currency, total.Total.String())
+		}
+	}
+	return nil
 }
 
-// doTx executes fn within a DB transaction with txOptions
+// doTx executes fn within a DB transaction with txOptions, or within the transaction of the request when it is made
+// with an idempotency key (see DoIdempotent).
+// Errors returned by fn are passed through as they are, so fn is expected to wrap DB errors itself.
 func (s *PgxStore) doTx(ctx context.Context, txOptions pgx.TxOptions, fn func(DBTX) error) error {
+	if scope := idempotencyScopeOf(ctx); scope != nil {
+		return scope.doTx(ctx, s.dbConn, txOptions, fn)
+	}
 	tx, err := s.dbConn.BeginTx(ctx, txOptions)
 	if err != nil {
-		return util.NewDBError(err)
+		return toDBError(err)
 	}
 	err = fn(tx)
 	if err != nil {
 		if rbErr := tx.Rollback(ctx); rbErr != nil {
 			return util.NewDBError(rbErr).WithUnderlyingErrors(err)
 		}
-		return util.NewDBError(err)
+		return err
 	}
-	return tx.Commit(ctx)
+	err = tx.Commit(ctx)
+	if err != nil {
+		return toDBError(err)
+	}
+	return nil
 }
 
-const createTransactionSqlTemplate = `
---name: CreateTransactionSql :exec
-BEGIN TRANSACTION ISOLATION LEVEL SERIALIZABLE; 
-
-UPDATE accounts
-SET balance = balance + {{.AddLowAmount}}
-WHERE id = {{.LowAccountID}};
-
-UPDATE accounts
-SET balance = balance + {{.AddHighAmount}}
-WHERE id = {{.HighAccountID}};
-
-INSERT INTO transactions (
-	source_account_id,
-	destination_account_id,
-	amount
-) VALUES (
-  {{.SourceAccountID}}, {{.DestinationAccountID}}, {{.Amount}}
-);
-
-COMMIT;`
-
-// TODO: Tune these config settings based on the performance of the server hardware
-const (
-	maxRetries     = 5
-	initialRetryMs = 50
-	randomRetryMs  = 200
-)
+// doSavepoint executes fn within a savepoint of tx, so that an error of fn rolls back what fn wrote but leaves tx usable
+func doSavepoint(ctx context.Context, tx DBTX, fn func(*Queries) error) error {
+	if _, err := tx.Exec(ctx, "SAVEPOINT nested"); err != nil {
+		return toDBError(err)
+	}
+	err := fn(New(tx))
+	if err != nil {
+		if _, rbErr := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT nested"); rbErr != nil {
+			return util.NewDBError(rbErr).WithUnderlyingErrors(err)
+		}
+		return err
+	}
+	if _, err = tx.Exec(ctx, "RELEASE SAVEPOINT nested"); err != nil {
+		return toDBError(err)
+	}
+	return nil
+}
 
 /*
 CreateTransactionWithSSI handles creating transaction and updating account balances safely with Serializable Snapshot Isolation (SSI)
-With SSI, transactions can fail due to deadlocks and serialization errors, so a retry with simple exponential random backoff is implemented
+Balances are adjusted in place with bound parameters, relying on the balance floor constraint instead of row locks
+With SSI, transactions can fail due to deadlocks and serialization errors, which are returned as retryable conflicts
 */
 func (s *PgxStore) CreateTransactionWithSSI(ctx context.Context, param *CreateTransactionParams) (*Transaction, error) {
 	// Prevent deadlock by updating in consistent order based on accountID
 	sqlParam := toCreateTransactionSqlParams(param)
 
-	tmpl, err := template.New("CreateTransactionSql").Parse(createTransactionSqlTemplate)
-	if err != nil {
-		return nil, err
+	var transaction *Transaction
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.Serializable,
 	}
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, sqlParam)
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		lowAccount, err := q.AddAccountBalance(ctx, &AddAccountBalanceParams{
+			ID:     sqlParam.LowAccountID,
+			Amount: sqlParam.AddLowAmount,
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		highAccount, err := q.AddAccountBalance(ctx, &AddAccountBalanceParams{
+			ID:     sqlParam.HighAccountID,
+			Amount: sqlParam.AddHighAmount,
+		})
+		if err != nil {
+			return toDBError(err)
+		}
+		// A concurrent status change writes the same rows, so it either shows here or fails serialization
+		for _, account := range []*Account{lowAccount, highAccount} {
+			if err = account.RequireActive(); err != nil {
+				return err
+			}
+		}
+		transaction, err = q.CreateTransaction(ctx, param)
+		if err != nil {
+			return toDBError(err)
+		}
+		return createEntries(ctx, q, transaction)
+	})
 	if err != nil {
 		return nil, err
 	}
-	sql := buf.String()
+	return transaction, nil
+}
 
-	retryTime := initialRetryMs
-	for i := 0; i < maxRetries; i++ {
-		_, err = s.dbConn.Exec(ctx, sql)
-		if err == nil {
-			return &Transaction{
-				SourceAccountID:      param.SourceAccountID,
-				DestinationAccountID: param.DestinationAccountID,
-				Amount:               param.Amount,
-			}, nil
+/*
+CreateTransactionWithVersion handles creating transaction and updating account balances safely with optimistic concurrency control
+Accounts are read without locks, and each balance is only written if the account version is still the one that was read
+A transfer that lost the race to a concurrent one writes no rows and is returned as a retryable conflict
+*/
+func (s *PgxStore) CreateTransactionWithVersion(ctx context.Context, param *CreateTransactionParams) (*Transaction, error) {
+	var transaction *Transaction
+	txOptions := pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	}
+	err := s.doTx(ctx, txOptions, func(tx DBTX) error {
+		q := New(tx)
+
+		sourceAccount, err := q.GetAccount(ctx, param.SourceAccountID)
+		if err != nil {
+			return toDBError(err)
+		}
+		destinationAccount, err := q.GetAccount(ctx, param.DestinationAccountID)
+		if err != nil {
+			return toDBError(err)
 		}
-		if strings.Contains(err.Error(), "(SQLSTATE 40001)") || // serialization failure
-			strings.Contains(err.Error(), "(SQLSTATE 40P01)") { // deadlock detected
-			time.Sleep(time.Millisecond * time.Duration(retryTime+rand.Intn(randomRetryMs)))
-			retryTime *= 2
-			continue
+		sourceBalance, destinationBalance, err := transferBalances(sourceAccount, destinationAccount, param)
+		if err != nil {
+			return err
+		}
+
+		// Prevent deadlock by updating in consistent order based on accountID
+		updates := []*UpdateAccountIfVersionParams{
+			{ID: sourceAccount.ID, Balance: sourceBalance, Version: sourceAccount.Version},
+			{ID: destinationAccount.ID, Balance: destinationBalance, Version: destinationAccount.Version},
 		}
-		if strings.Contains(err.Error(), "(SQLSTATE 23514)") { // constraint violated
-			// Since we have already checked for valid account ID before this, the other
-			// DB constraint is balance >= 0
-			return nil, util.NewInsufficientBalanceError()
+		if updates[1].ID > updates[0].ID {
+			updates[0], updates[1] = updates[1], updates[0]
 		}
-		return nil, util.NewDBError(err)
+		for _, update := range updates {
+			_, err = q.UpdateAccountIfVersion(ctx, update)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return util.NewStaleAccountVersionError(update.ID, update.Version)
+			}
+			if err != nil {
+				return toDBError(err)
+			}
+		}
+
+		transaction, err = q.CreateTransaction(ctx, param)
+		if err != nil {
+			return toDBError(err)
+		}
+		return createEntries(ctx, q, transaction)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil, util.NewDBError(err)
+	return transaction, nil
 }
 
 type createTransactionSqlParam struct {
-	Amount               string
-	SourceAccountID      int64
-	DestinationAccountID int64
-	LowAccountID         int64
-	HighAccountID        int64
-	AddLowAmount         string
-	AddHighAmount        string
+	LowAccountID  int64
+	HighAccountID int64
+	AddLowAmount  util.Money
+	AddHighAmount util.Money
 }
 
 func toCreateTransactionSqlParams(param *CreateTransactionParams) *createTransactionSqlParam {
 	sqlParam := createTransactionSqlParam{
-		Amount:               param.Amount,
-		SourceAccountID:      param.SourceAccountID,
-		DestinationAccountID: param.DestinationAccountID,
-		LowAccountID:         param.SourceAccountID,
-		HighAccountID:        param.DestinationAccountID,
-		AddLowAmount:         "-" + param.Amount,
-		AddHighAmount:        param.Amount,
+		LowAccountID:  param.SourceAccountID,
+		HighAccountID: param.DestinationAccountID,
+		AddLowAmount:  param.Amount.Neg(),
+		AddHighAmount: param.DestinationAmount,
 	}
 	// Swap
 	if sqlParam.HighAccountID > sqlParam.LowAccountID {
@@ -2,11 +2,16 @@ package db
 
 import (
 	"context"
-	"math/big"
+	"errors"
+	"math"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/joomcode/errorx"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 
@@ -16,11 +21,11 @@ import (
 func TestPgxStore_CreateTransactionTx(t *testing.T) {
 	accountA := &CreateAccountParams{
 		ID:      1,
-		Balance: "100.0",
+		Balance: util.MustParseMoney("100.0"),
 	}
 	accountB := &CreateAccountParams{
 		ID:      2,
-		Balance: "100.0",
+		Balance: util.MustParseMoney("100.0"),
 	}
 	accounts := []*CreateAccountParams{accountA, accountB}
 
@@ -28,7 +33,7 @@ func TestPgxStore_CreateTransactionTx(t *testing.T) {
 		name           string
 		param          *CreateTransactionParams
 		want           *Transaction
-		wantTransacted string
+		wantTransacted util.Money
 		wantErr        bool
 	}{
 		{
@@ -36,44 +41,54 @@ func TestPgxStore_CreateTransactionTx(t *testing.T) {
 			param: &CreateTransactionParams{
 				SourceAccountID:      1,
 				DestinationAccountID: 2,
-				Amount:               "100.00000",
+				Amount:               util.MustParseMoney("100.00000"),
 			},
 			want: &Transaction{
 				SourceAccountID:      1,
-				DestinationAccountID: 2,
-				Amount:               "100.00000",
+				DestinationAccountID: pgtype.Int8{Int64: 2, Valid: true},
+				Amount:               util.MustParseMoney("100.00000"),
 			},
-			wantTransacted: "100.00000",
+			wantTransacted: util.MustParseMoney("100.00000"),
 		},
 		{
 			name: "insufficient balance",
 			param: &CreateTransactionParams{
 				SourceAccountID:      1,
 				DestinationAccountID: 2,
-				Amount:               "100.00001",
+				Amount:               util.MustParseMoney("100.00001"),
+			},
+			wantErr:        true,
+			wantTransacted: util.MustParseMoney("0.00000"),
+		},
+		{
+			name: "largest amount is bound as numeric",
+			param: &CreateTransactionParams{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               util.MaxMoney,
 			},
 			wantErr:        true,
-			wantTransacted: "0.00000",
+			wantTransacted: util.MustParseMoney("0.00000"),
 		},
 		{
 			name: "missing destination account",
 			param: &CreateTransactionParams{
 				SourceAccountID:      1,
 				DestinationAccountID: 0,
-				Amount:               "100.00001",
+				Amount:               util.MustParseMoney("100.00001"),
 			},
 			wantErr:        true,
-			wantTransacted: "0.00000",
+			wantTransacted: util.MustParseMoney("0.00000"),
 		},
 		{
 			name: "missing source account",
 			param: &CreateTransactionParams{
 				SourceAccountID:      0,
 				DestinationAccountID: 2,
-				Amount:               "100.00001",
+				Amount:               util.MustParseMoney("100.00001"),
 			},
 			wantErr:        true,
-			wantTransacted: "0.00000",
+			wantTransacted: util.MustParseMoney("0.00000"),
 		},
 	}
 	ctx := context.Background()
@@ -83,23 +98,27 @@ func TestPgxStore_CreateTransactionTx(t *testing.T) {
 		for _, fn := range []CreateTransactionFunc{
 			s.CreateTransactionWithLock,
 			s.CreateTransactionWithSSI,
+			s.CreateTransactionWithVersion,
 		} {
 			t.Run(tt.name, func(t *testing.T) {
 				setup(t, accounts)
 				defer teardown(t)
-				got, err := fn(ctx, tt.param)
+				got, err := fn(ctx, usd(tt.param))
 				require.Equal(t, tt.wantErr, err != nil)
 				if err == nil {
+					require.NotZero(t, got.ID)
+					require.False(t, got.CreatedAt.IsZero())
 					require.Equal(t, got.Amount, tt.want.Amount)
 					require.Equal(t, got.SourceAccountID, tt.want.SourceAccountID)
 					require.Equal(t, got.DestinationAccountID, tt.want.DestinationAccountID)
 				}
 				accA, err := s.GetAccount(ctx, accountA.ID)
 				require.NoError(t, err)
-				requireBalanceChange(t, accountA.Balance, accA.Balance, "-"+tt.wantTransacted)
+				requireBalanceChange(t, accountA.Balance, accA.Balance, tt.wantTransacted.Neg())
 				accB, err := s.GetAccount(ctx, accountB.ID)
 				require.NoError(t, err)
 				requireBalanceChange(t, accountB.Balance, accB.Balance, tt.wantTransacted)
+				require.NoError(t, s.CheckEntriesBalanced(ctx))
 			})
 		}
 	}
@@ -107,8 +126,8 @@ func TestPgxStore_CreateTransactionTx(t *testing.T) {
 
 func TestPgxStore_CreateTransactionDeadlock(t *testing.T) {
 	numTransactions := 50
-	initialBalance := strconv.Itoa(numTransactions * 2)
-	amountTransacted := strconv.Itoa(numTransactions)
+	initialBalance := util.MustParseMoney(strconv.Itoa(numTransactions * 2))
+	amountTransacted := util.MustParseMoney(strconv.Itoa(numTransactions))
 
 	accountA := &CreateAccountParams{
 		ID:      1,
@@ -120,24 +139,29 @@ func TestPgxStore_CreateTransactionDeadlock(t *testing.T) {
 	}
 	accounts := []*CreateAccountParams{accountA, accountB}
 
-	debit := &CreateTransactionParams{
+	debit := usd(&CreateTransactionParams{
 		SourceAccountID:      accountA.ID,
 		DestinationAccountID: accountB.ID,
-		Amount:               "2.00000",
-	}
-	credit := &CreateTransactionParams{
+		Amount:               util.MustParseMoney("2.00000"),
+	})
+	credit := usd(&CreateTransactionParams{
 		SourceAccountID:      accountB.ID,
 		DestinationAccountID: accountA.ID,
-		Amount:               "1.0000",
-	}
+		Amount:               util.MustParseMoney("1.0000"),
+	})
 	ctx := context.Background()
 	s := testStore
 
-	for _, fn := range []CreateTransactionFunc{
-		s.CreateTransactionWithLock,
-		s.CreateTransactionWithSSI,
-	} {
-		t.Run("Test Transaction Lock", func(t *testing.T) {
+	policy := util.RetryPolicy{
+		MaxRetries:     10,
+		InitialBackoff: 10 * time.Millisecond,
+		RandomBackoff:  50 * time.Millisecond,
+	}
+	for _, name := range []string{StrategyLock, StrategySSI, StrategyOptimistic} {
+		strategy, err := NewTransferStrategy(s, name, policy)
+		require.NoError(t, err)
+		fn := strategy.Transfer
+		t.Run("Test Transaction "+name, func(t *testing.T) {
 			{
 				setup(t, accounts)
 				defer teardown(t)
@@ -165,19 +189,1206 @@ func TestPgxStore_CreateTransactionDeadlock(t *testing.T) {
 				require.Equal(t, errCnt.Load(), int64(0))
 				accA, err := s.GetAccount(ctx, accountA.ID)
 				require.NoError(t, err)
-				requireBalanceChange(t, initialBalance, accA.Balance, "-"+amountTransacted)
+				requireBalanceChange(t, initialBalance, accA.Balance, amountTransacted.Neg())
 				accB, err := s.GetAccount(ctx, accountB.ID)
 				require.NoError(t, err)
 				requireBalanceChange(t, initialBalance, accB.Balance, amountTransacted)
+				require.NoError(t, s.CheckEntriesBalanced(ctx))
 			}
 		})
 	}
 }
 
+func TestPgxStore_CreateTransactionBatch(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("10.0")},
+		{ID: 2, Balance: util.MustParseMoney("0")},
+		{ID: 3, Balance: util.MustParseMoney("0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	transfer := func(source, destination int64, amount string) *CreateTransactionParams {
+		return usd(&CreateTransactionParams{
+			SourceAccountID:      source,
+			DestinationAccountID: destination,
+			Amount:               util.MustParseMoney(amount),
+		})
+	}
+
+	// A transfer can spend what an earlier one in the batch credited
+	results, err := s.CreateTransactionBatch(ctx, &CreateTransactionBatchParams{Transfers: []*CreateTransactionParams{
+		transfer(1, 2, "6.00000"),
+		transfer(2, 3, "4.00000"),
+	}})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.NoError(t, results[1].Err)
+	require.Equal(t, int64(3), results[1].Transaction.DestinationAccountID.Int64)
+
+	// All or nothing: the failing transfer rolls back the one before it
+	_, err = s.CreateTransactionBatch(ctx, &CreateTransactionBatchParams{Transfers: []*CreateTransactionParams{
+		transfer(1, 3, "4.00000"),
+		transfer(2, 1, "2.00001"),
+	}})
+	require.True(t, errorx.IsOfType(err, util.ErrInsufficientBalance))
+
+	// Best effort: only the failing transfer is left out
+	results, err = s.CreateTransactionBatch(ctx, &CreateTransactionBatchParams{
+		Transfers: []*CreateTransactionParams{
+			transfer(1, 3, "4.00000"),
+			transfer(2, 1, "2.00001"),
+			transfer(3, 2, "1.00000"),
+		},
+		BestEffort: true,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, results[0].Transaction)
+	require.True(t, errorx.IsOfType(results[1].Err, util.ErrInsufficientBalance))
+	require.Nil(t, results[1].Transaction)
+	require.NotNil(t, results[2].Transaction)
+
+	for id, want := range map[int64]string{1: "0", 2: "3", 3: "7"} {
+		account, err := s.GetAccount(ctx, id)
+		require.NoError(t, err)
+		require.Zero(t, util.MustParseMoney(want).Cmp(account.Balance), "account %d: %s", id, account.Balance)
+	}
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_CreateTransactionBatchDeadlock(t *testing.T) {
+	numBatches := 20
+	initialBalance := util.MustParseMoney("100")
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: initialBalance},
+		{ID: 2, Balance: initialBalance},
+		{ID: 3, Balance: initialBalance},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	// Batches touching the same accounts in opposite orders, which would deadlock if locked in transfer order
+	forward := &CreateTransactionBatchParams{Transfers: []*CreateTransactionParams{
+		usd(&CreateTransactionParams{SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("1.00000")}),
+		usd(&CreateTransactionParams{SourceAccountID: 2, DestinationAccountID: 3, Amount: util.MustParseMoney("1.00000")}),
+	}}
+	backward := &CreateTransactionBatchParams{Transfers: []*CreateTransactionParams{
+		usd(&CreateTransactionParams{SourceAccountID: 3, DestinationAccountID: 2, Amount: util.MustParseMoney("1.00000")}),
+		usd(&CreateTransactionParams{SourceAccountID: 2, DestinationAccountID: 1, Amount: util.MustParseMoney("1.00000")}),
+	}}
+
+	var errCnt atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(numBatches * 2)
+	for i := 0; i < numBatches; i++ {
+		for _, batch := range []*CreateTransactionBatchParams{forward, backward} {
+			go func(batch *CreateTransactionBatchParams) {
+				defer wg.Done()
+				if _, err := s.CreateTransactionBatch(ctx, batch); err != nil {
+					errCnt.Add(1)
+				}
+			}(batch)
+		}
+	}
+	wg.Wait()
+	require.Equal(t, errCnt.Load(), int64(0))
+	for _, account := range accounts {
+		acc, err := s.GetAccount(ctx, account.ID)
+		require.NoError(t, err)
+		requireBalanceChange(t, initialBalance, acc.Balance, util.Money{})
+	}
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_UpdateAccountIfVersion(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("100.0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	account, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	require.Zero(t, account.Version)
+
+	// A transfer bumps the version of both accounts
+	_, err = s.CreateTransactionWithVersion(ctx, usd(&CreateTransactionParams{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               util.MustParseMoney("1.00000"),
+	}))
+	require.NoError(t, err)
+	updated, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, account.Version+1, updated.Version)
+
+	// Writing with the version read before the transfer changes nothing
+	_, err = s.UpdateAccountIfVersion(ctx, &UpdateAccountIfVersionParams{
+		ID:      1,
+		Balance: util.MustParseMoney("0.00000"),
+		Version: account.Version,
+	})
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+	unchanged, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, updated, unchanged)
+}
+
+func TestPgxStore_CreateTransactionEntries(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("100.0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	transaction, err := s.CreateTransactionWithLock(ctx, usd(&CreateTransactionParams{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               util.MustParseMoney("12.34500"),
+	}))
+	require.NoError(t, err)
+
+	entries, err := s.ListEntriesByTransaction(ctx, transaction.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, int64(1), entries[0].AccountID.Int64)
+	require.Equal(t, "-12.34500", entries[0].Amount.String())
+	require.Equal(t, int64(2), entries[1].AccountID.Int64)
+	require.Equal(t, "12.34500", entries[1].Amount.String())
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_ReverseTransaction(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("100.0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	original, err := s.CreateTransactionWithLock(ctx, usd(&CreateTransactionParams{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               util.MustParseMoney("30.00000"),
+	}))
+	require.NoError(t, err)
+
+	// Partial reversal
+	reversal, err := s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID, Amount: money("10.00000")})
+	require.NoError(t, err)
+	require.Equal(t, original.ID, reversal.ReversalOf.Int64)
+	require.Equal(t, int64(2), reversal.SourceAccountID)
+	require.Equal(t, int64(1), reversal.DestinationAccountID.Int64)
+
+	// Cannot reverse more than what is left
+	_, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID, Amount: money("20.00001")})
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidReversal))
+
+	// Cannot reverse a reversal
+	_, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: reversal.ID})
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidReversal))
+
+	// Reverse the rest
+	reversal, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID})
+	require.NoError(t, err)
+	require.Equal(t, "20.00000", reversal.Amount.String())
+
+	_, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID})
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidReversal))
+
+	_, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID + 100})
+	require.True(t, errorx.IsOfType(err, util.ErrTransactionNotFound))
+
+	accA, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	requireBalanceChange(t, util.MustParseMoney("100.0"), accA.Balance, util.Money{})
+	accB, err := s.GetAccount(ctx, 2)
+	require.NoError(t, err)
+	requireBalanceChange(t, util.MustParseMoney("100.0"), accB.Balance, util.Money{})
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_Holds(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	place := func(amount string, expiresAt time.Time) (*Hold, error) {
+		return s.PlaceHold(ctx, &CreateHoldParams{
+			AccountID:            1,
+			DestinationAccountID: 2,
+			Amount:               util.MustParseMoney(amount),
+			Currency:             "USD",
+			ExpiresAt:            expiresAt,
+		})
+	}
+	later := time.Now().Add(time.Hour)
+
+	captured, err := place("60.00000", later)
+	require.NoError(t, err)
+	require.Equal(t, HoldActive, captured.Status)
+
+	// Held funds cannot be held again or transferred
+	_, err = place("50.00000", later)
+	require.True(t, errorx.IsOfType(err, util.ErrInsufficientBalance))
+	_, err = s.CreateTransactionWithLock(ctx, usd(&CreateTransactionParams{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               util.MustParseMoney("50.00000"),
+	}))
+	require.True(t, errorx.IsOfType(err, util.ErrInsufficientBalance))
+
+	// Capturing part of the hold releases the rest
+	_, err = s.CaptureHold(ctx, &CaptureHoldParams{
+		HoldID:   captured.ID,
+		Transfer: usd(&CreateTransactionParams{SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("60.00001")}),
+	})
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidHold))
+	captured, err = s.CaptureHold(ctx, &CaptureHoldParams{
+		HoldID:   captured.ID,
+		Transfer: usd(&CreateTransactionParams{SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("40.00000")}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, HoldCaptured, captured.Status)
+	require.Equal(t, "40.00000", captured.CapturedAmount.String())
+	require.True(t, captured.TransactionID.Valid)
+	_, err = s.VoidHold(ctx, captured.ID)
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidHold))
+
+	voided, err := place("10.00000", later)
+	require.NoError(t, err)
+	voided, err = s.VoidHold(ctx, voided.ID)
+	require.NoError(t, err)
+	require.Equal(t, HoldVoided, voided.Status)
+
+	expired, err := place("20.00000", time.Now().Add(time.Second))
+	require.NoError(t, err)
+	count, err := s.ReleaseExpiredHolds(ctx, time.Now())
+	require.NoError(t, err)
+	require.Zero(t, count)
+	count, err = s.ReleaseExpiredHolds(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	expired, err = s.GetHold(ctx, expired.ID)
+	require.NoError(t, err)
+	require.Equal(t, HoldExpired, expired.Status)
+
+	_, err = s.VoidHold(ctx, expired.ID+100)
+	require.True(t, errorx.IsOfType(err, util.ErrHoldNotFound))
+
+	accA, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	requireBalanceChange(t, util.MustParseMoney("100.0"), accA.Balance, util.MustParseMoney("-40"))
+	require.True(t, accA.Held.IsZero())
+	accB, err := s.GetAccount(ctx, 2)
+	require.NoError(t, err)
+	requireBalanceChange(t, util.Money{}, accB.Balance, util.MustParseMoney("40"))
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_CrossCurrencyTransaction(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.00"), Currency: "USD"},
+		{ID: 2, Balance: util.MustParseMoney("0"), Currency: "JPY"},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	original, err := s.CreateTransactionWithLock(ctx, &CreateTransactionParams{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               util.MustParseMoney("10.00000"),
+		Currency:             "USD",
+		DestinationAmount:    util.MustParseMoney("1500.00000"),
+		DestinationCurrency:  "JPY",
+		FxRate:               "150",
+	})
+	require.NoError(t, err)
+
+	// Both currencies net to zero through the FX position legs
+	entries, err := s.ListEntriesByTransaction(ctx, original.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, int64(1), entries[0].AccountID.Int64)
+	require.False(t, entries[1].AccountID.Valid)
+	require.False(t, entries[2].AccountID.Valid)
+	require.Equal(t, int64(2), entries[3].AccountID.Int64)
+	require.Equal(t, "1500.00000", entries[3].Amount.String())
+	require.Equal(t, "JPY", entries[3].Currency)
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+
+	// Reversal amounts are in the original source currency
+	reversal, err := s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID, Amount: money("4.00000")})
+	require.NoError(t, err)
+	require.Equal(t, "600.00000", reversal.Amount.String())
+	require.Equal(t, "JPY", reversal.Currency)
+	require.Equal(t, "4.00000", reversal.DestinationAmount.String())
+
+	_, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID, Amount: money("0.001")})
+	require.Error(t, err)
+
+	reversal, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: original.ID})
+	require.NoError(t, err)
+	require.Equal(t, "900.00000", reversal.Amount.String())
+	require.Equal(t, "6.00000", reversal.DestinationAmount.String())
+
+	accA, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	requireBalanceChange(t, util.MustParseMoney("100.00"), accA.Balance, util.Money{})
+	accB, err := s.GetAccount(ctx, 2)
+	require.NoError(t, err)
+	requireBalanceChange(t, util.MustParseMoney("0"), accB.Balance, util.Money{})
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_GetFxRate(t *testing.T) {
+	ctx := context.Background()
+	s := testStore
+	defer teardown(t)
+
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		param *CreateFxRateParams
+		rows  int64
+	}{
+		{param: &CreateFxRateParams{BaseCurrency: "USD", QuoteCurrency: "JPY", Rate: "140", EffectiveFrom: jan}, rows: 1},
+		{param: &CreateFxRateParams{BaseCurrency: "USD", QuoteCurrency: "JPY", Rate: "150", EffectiveFrom: feb}, rows: 1},
+		// Already published, ignored
+		{param: &CreateFxRateParams{BaseCurrency: "USD", QuoteCurrency: "JPY", Rate: "999", EffectiveFrom: feb}, rows: 0},
+	} {
+		rows, err := s.CreateFxRate(ctx, tc.param)
+		require.NoError(t, err)
+		require.Equal(t, tc.rows, rows)
+	}
+
+	rate, err := s.GetFxRate(ctx, &GetFxRateParams{BaseCurrency: "USD", QuoteCurrency: "JPY", At: feb.Add(-time.Second)})
+	require.NoError(t, err)
+	require.Equal(t, "140.0000000000", rate.Rate)
+
+	rate, err = s.GetFxRate(ctx, &GetFxRateParams{BaseCurrency: "USD", QuoteCurrency: "JPY", At: time.Now()})
+	require.NoError(t, err)
+	require.Equal(t, "150.0000000000", rate.Rate)
+
+	_, err = s.GetFxRate(ctx, &GetFxRateParams{BaseCurrency: "USD", QuoteCurrency: "JPY", At: jan.Add(-time.Second)})
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestPgxStore_CreateMultiLegTransfer(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("10.0")},
+		{ID: 2, Balance: util.MustParseMoney("0")},
+		{ID: 3, Balance: util.MustParseMoney("0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	param := &MultiLegTransferParams{
+		SourceAccountID: 1,
+		Amount:          util.MustParseMoney("10.00000"),
+		Currency:        "USD",
+		Legs: []*TransactionLeg{
+			{AccountID: 2, Amount: util.MustParseMoney("9.50000")},
+			{AccountID: 3, Amount: util.MustParseMoney("0.50000")},
+		},
+	}
+	transaction, err := s.CreateMultiLegTransfer(ctx, param)
+	require.NoError(t, err)
+	require.False(t, transaction.DestinationAccountID.Valid)
+	entries, err := s.ListEntriesByTransaction(ctx, transaction.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "-10.00000", entries[0].Amount.String())
+	require.Equal(t, int64(3), entries[2].AccountID.Int64)
+
+	// Every credited account sees the transaction as incoming
+	got, err := s.ListAccountTransactions(ctx, &ListAccountTransactionsParams{
+		Incoming:  true,
+		AccountID: 3,
+		BeforeID:  math.MaxInt64,
+		ToTime:    time.Now().Add(time.Hour),
+		MaxAmount: util.MaxMoney,
+		PageSize:  10,
+	})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, transaction.ID, got[0].ID)
+
+	_, err = s.CreateMultiLegTransfer(ctx, param)
+	require.True(t, errorx.IsOfType(err, util.ErrInsufficientBalance))
+	_, err = s.ReverseTransaction(ctx, &ReverseTransactionParams{TransactionID: transaction.ID})
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidReversal))
+
+	param.Amount = util.MustParseMoney("9.00000")
+	_, err = s.CreateMultiLegTransfer(ctx, param)
+	require.True(t, errorx.IsOfType(err, errorx.IllegalArgument))
+
+	for id, want := range map[int64]string{1: "0", 2: "9.5", 3: "0.5"} {
+		account, err := s.GetAccount(ctx, id)
+		require.NoError(t, err)
+		require.Zero(t, util.MustParseMoney(want).Cmp(account.Balance), "account %d: %s", id, account.Balance)
+	}
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_RunDueScheduledTransfer(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	startAt := time.Now().Add(time.Hour)
+	scheduled, err := s.CreateScheduledTransfer(ctx, &CreateScheduledTransferParams{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               util.MustParseMoney("10.00000"),
+		Currency:             "USD",
+		Recurrence:           RecurrenceDaily,
+		StartAt:              startAt,
+		MaxOccurrences:       pgtype.Int4{Int32: 2, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, ScheduleActive, scheduled.Status)
+	require.True(t, scheduled.NextRunAt.Time.Equal(scheduled.StartAt))
+
+	// Nothing is due before the first occurrence
+	attempt := func(ctx context.Context, now time.Time, due *ScheduledTransfer, transfer CreateTransactionFunc) (*CreateScheduledTransferRunParams, *UpdateScheduledTransferParams) {
+		t.Fatalf("unexpected attempt at scheduled transfer %d", due.ID)
+		return nil, nil
+	}
+	found, err := s.RunDueScheduledTransfer(ctx, time.Now(), attempt)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// makeAttempt transfers the amount of the schedule, or amount if it is not empty, and records the run with status
+	makeAttempt := func(amount string, status string) ScheduledTransferFunc {
+		return func(ctx context.Context, now time.Time, due *ScheduledTransfer, transfer CreateTransactionFunc) (*CreateScheduledTransferRunParams, *UpdateScheduledTransferParams) {
+			require.Equal(t, scheduled.ID, due.ID)
+			param := &CreateTransactionParams{
+				SourceAccountID:      due.SourceAccountID,
+				DestinationAccountID: due.DestinationAccountID,
+				Amount:               due.Amount,
+			}
+			if amount != "" {
+				param.Amount = util.MustParseMoney(amount)
+			}
+			param = usd(param)
+			run := &CreateScheduledTransferRunParams{
+				ScheduledTransferID: due.ID,
+				Occurrence:          due.Occurrences + 1,
+				Attempt:             due.Attempt + 1,
+				Status:              status,
+			}
+			update := &UpdateScheduledTransferParams{
+				ID:          due.ID,
+				Occurrences: due.Occurrences + 1,
+				NextRunAt:   pgtype.Timestamptz{Time: due.StartAt.AddDate(0, 0, 1), Valid: true},
+				Status:      ScheduleActive,
+			}
+			transaction, err := transfer(ctx, param)
+			if err != nil {
+				run.Error = err.Error()
+				update.Occurrences, update.Attempt, update.NextRunAt = due.Occurrences, run.Attempt, due.NextRunAt
+				return run, update
+			}
+			run.TransactionID = pgtype.Int8{Int64: transaction.ID, Valid: true}
+			return run, update
+		}
+	}
+	requireBalance := func(id int64, want string) {
+		account, err := s.GetAccount(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, want, account.Balance.String())
+	}
+
+	// A run that cannot be saved rolls back the transfer with it, so the schedule stays due and nothing is paid twice
+	_, err = s.RunDueScheduledTransfer(ctx, startAt, makeAttempt("", "unknown"))
+	require.Error(t, err)
+	requireBalance(1, "100.00000")
+	runs, err := s.ListScheduledTransferRuns(ctx, scheduled.ID)
+	require.NoError(t, err)
+	require.Empty(t, runs)
+
+	// A failed transfer is rolled back on its own, and its run is still saved
+	found, err = s.RunDueScheduledTransfer(ctx, startAt, makeAttempt("1000.00000", RunFailed))
+	require.NoError(t, err)
+	require.True(t, found)
+	requireBalance(1, "100.00000")
+
+	// The attempt's transfer, run and update are saved together
+	found, err = s.RunDueScheduledTransfer(ctx, startAt, makeAttempt("", RunSucceeded))
+	require.NoError(t, err)
+	require.True(t, found)
+	found, err = s.RunDueScheduledTransfer(ctx, startAt, makeAttempt("", RunSucceeded))
+	require.NoError(t, err)
+	require.False(t, found)
+
+	scheduled, err = s.GetScheduledTransfer(ctx, scheduled.ID)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), scheduled.Occurrences)
+	require.True(t, scheduled.NextRunAt.Time.Equal(scheduled.StartAt.AddDate(0, 0, 1)))
+	runs, err = s.ListScheduledTransferRuns(ctx, scheduled.ID)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	require.Equal(t, RunFailed, runs[0].Status)
+	require.False(t, runs[0].TransactionID.Valid)
+	require.Equal(t, RunSucceeded, runs[1].Status)
+	require.True(t, runs[1].TransactionID.Valid)
+	requireBalance(1, "90.00000")
+	requireBalance(2, "10.00000")
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
+func TestPgxStore_SetAccountStatus(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	transfer := func(source int64, destination int64, amount string) *CreateTransactionParams {
+		return usd(&CreateTransactionParams{
+			SourceAccountID:      source,
+			DestinationAccountID: destination,
+			Amount:               util.MustParseMoney(amount),
+		})
+	}
+	strategies := map[string]CreateTransactionFunc{
+		StrategyLock:       s.CreateTransactionWithLock,
+		StrategySSI:        s.CreateTransactionWithSSI,
+		StrategyOptimistic: s.CreateTransactionWithVersion,
+	}
+
+	// Frozen accounts can be neither debited nor credited, by any strategy
+	frozen, err := s.SetAccountStatus(ctx, 2, AccountFrozen)
+	require.NoError(t, err)
+	require.Equal(t, AccountFrozen, frozen.Status)
+	for name, createTransaction := range strategies {
+		_, err = createTransaction(ctx, transfer(1, 2, "10.00000"))
+		require.True(t, errorx.IsOfType(err, util.ErrAccountNotActive), name)
+	}
+	_, err = s.PlaceHold(ctx, &CreateHoldParams{
+		AccountID:            2,
+		DestinationAccountID: 1,
+		Amount:               util.MustParseMoney("0.00000"),
+		Currency:             "USD",
+		ExpiresAt:            time.Now().Add(time.Hour),
+	})
+	require.True(t, errorx.IsOfType(err, util.ErrAccountNotActive))
+
+	_, err = s.SetAccountStatus(ctx, 2, AccountActive)
+	require.NoError(t, err)
+	_, err = s.CreateTransactionWithLock(ctx, transfer(1, 2, "10.00000"))
+	require.NoError(t, err)
+
+	// Accounts are only closed at zero balance, and for good
+	_, err = s.SetAccountStatus(ctx, 2, AccountClosed)
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidStatusChange))
+	_, err = s.CreateTransactionWithLock(ctx, transfer(2, 1, "10.00000"))
+	require.NoError(t, err)
+	closed, err := s.SetAccountStatus(ctx, 2, AccountClosed)
+	require.NoError(t, err)
+	require.Equal(t, AccountClosed, closed.Status)
+	_, err = s.SetAccountStatus(ctx, 2, AccountActive)
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidStatusChange))
+	_, err = s.CreateTransactionWithLock(ctx, transfer(1, 2, "10.00000"))
+	require.True(t, errorx.IsOfType(err, util.ErrAccountNotActive))
+
+	_, err = s.SetAccountStatus(ctx, 3, AccountFrozen)
+	require.True(t, errorx.IsOfType(err, util.ErrAccountNotFound))
+}
+
+func TestPgxStore_BalanceFloor(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("0")},
+		{ID: 2, Balance: util.MustParseMoney("0"), Type: AccountCredit, BalanceFloor: money("-100.00000")},
+		{ID: 3, Balance: util.MustParseMoney("0"), Type: AccountSystem},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	transfer := func(source int64, destination int64, amount string) *CreateTransactionParams {
+		return usd(&CreateTransactionParams{
+			SourceAccountID:      source,
+			DestinationAccountID: destination,
+			Amount:               util.MustParseMoney(amount),
+		})
+	}
+	strategies := map[string]CreateTransactionFunc{
+		StrategyLock:       s.CreateTransactionWithLock,
+		StrategySSI:        s.CreateTransactionWithSSI,
+		StrategyOptimistic: s.CreateTransactionWithVersion,
+	}
+
+	// Each strategy lets the credit account go down to its floor, and no further
+	for name, createTransaction := range strategies {
+		_, err := createTransaction(ctx, transfer(2, 1, "30.00000"))
+		require.NoError(t, err, name)
+		_, err = createTransaction(ctx, transfer(1, 2, "30.00000"))
+		require.NoError(t, err, name)
+		_, err = createTransaction(ctx, transfer(2, 1, "100.00001"))
+		require.True(t, errorx.IsOfType(err, util.ErrInsufficientBalance), name)
+	}
+	_, err := s.CreateTransactionWithSSI(ctx, transfer(2, 1, "100.00000"))
+	require.NoError(t, err)
+	credit, err := s.GetAccount(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, "-100.00000", credit.Balance.String())
+
+	// The cash account cannot go below zero, nor hold more than it has
+	_, err = s.CreateTransactionWithSSI(ctx, transfer(1, 2, "100.00001"))
+	require.True(t, errorx.IsOfType(err, util.ErrInsufficientBalance))
+	_, err = s.PlaceHold(ctx, &CreateHoldParams{
+		AccountID:            1,
+		DestinationAccountID: 2,
+		Amount:               util.MustParseMoney("100.00001"),
+		Currency:             "USD",
+		ExpiresAt:            time.Now().Add(time.Hour),
+	})
+	require.True(t, errorx.IsOfType(err, util.ErrInsufficientBalance))
+
+	// The system account has no floor
+	for name, createTransaction := range strategies {
+		_, err = createTransaction(ctx, transfer(3, 1, "1000000.00000"))
+		require.NoError(t, err, name)
+	}
+	system, err := s.GetAccount(ctx, 3)
+	require.NoError(t, err)
+	require.Equal(t, "-3000000.00000", system.Balance.String())
+	require.Nil(t, system.BalanceFloor)
+}
+
+func TestPgxStore_CreateAccountDuplicate(t *testing.T) {
+	numRequests := 10
+	ctx := context.Background()
+	s := testStore
+	defer teardown(t)
+
+	// Concurrent requests for the same ID, of which exactly one creates the account
+	var created, duplicates atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(numRequests)
+	for i := 0; i < numRequests; i++ {
+		go func() {
+			defer wg.Done()
+			_, err := s.CreateAccount(ctx, &CreateAccountParams{
+				ID:           1,
+				Balance:      util.MustParseMoney("0"),
+				Currency:     "USD",
+				Type:         AccountCash,
+				BalanceFloor: &util.Money{},
+			})
+			switch {
+			case err == nil:
+				created.Add(1)
+			case errorx.IsOfType(err, util.ErrDuplicateAccount):
+				duplicates.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(1), created.Load())
+	require.Equal(t, int64(numRequests-1), duplicates.Load())
+}
+
+func TestPgxStore_AllocateAccount(t *testing.T) {
+	ctx := context.Background()
+	s := testStore
+	defer teardown(t)
+
+	param := &CreateAccountWithNextIDParams{
+		Balance:      util.MustParseMoney("0"),
+		Currency:     "USD",
+		Type:         AccountCash,
+		BalanceFloor: &util.Money{},
+	}
+	first, err := s.AllocateAccount(ctx, param)
+	require.NoError(t, err)
+
+	// IDs chosen by clients are skipped
+	setup(t, []*CreateAccountParams{
+		{ID: first.ID + 1, Balance: util.MustParseMoney("0")},
+		{ID: first.ID + 2, Balance: util.MustParseMoney("0")},
+	})
+	next, err := s.AllocateAccount(ctx, param)
+	require.NoError(t, err)
+	require.Equal(t, first.ID+3, next.ID)
+	require.Equal(t, AccountActive, next.Status)
+
+	// IDs taken without moving the sequence, as before it was moved past chosen IDs, are all skipped at once
+	for _, id := range []int64{next.ID + 1, next.ID + 2, next.ID + 50} {
+		_, err = testStore.(*PgxStore).Queries.CreateAccount(ctx, &CreateAccountParams{
+			ID: id, Balance: util.MustParseMoney("0"), Currency: "USD", Type: AccountCash, BalanceFloor: &util.Money{},
+		})
+		require.NoError(t, err)
+	}
+	next, err = s.AllocateAccount(ctx, param)
+	require.NoError(t, err)
+	require.Equal(t, first.ID+53, next.ID)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.AllocateAccount(cancelled, param)
+	require.Error(t, err)
+}
+
+func TestPgxStore_AccountMetadata(t *testing.T) {
+	ctx := context.Background()
+	s := testStore
+	setup(t, []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("0"), OwnerReference: "cust-1", Labels: util.Labels{"team": "payments", "region": "eu"}},
+		{ID: 2, Balance: util.MustParseMoney("0"), OwnerReference: "cust-1", Labels: util.Labels{"team": "risk"}},
+		{ID: 3, Balance: util.MustParseMoney("0"), OwnerReference: "cust-2", Labels: util.Labels{"team": "payments"}},
+		{ID: 4, Balance: util.MustParseMoney("0")},
+	})
+	defer teardown(t)
+
+	ids := func(param *ListAccountsParams) []int64 {
+		param.BeforeID, param.PageSize = math.MaxInt64, 10
+		accounts, err := s.ListAccounts(ctx, param)
+		require.NoError(t, err)
+		var ids []int64
+		for _, account := range accounts {
+			ids = append(ids, account.ID)
+		}
+		return ids
+	}
+	require.Equal(t, []int64{4, 3, 2, 1}, ids(&ListAccountsParams{Labels: util.Labels{}}))
+	require.Equal(t, []int64{2, 1}, ids(&ListAccountsParams{OwnerReference: "cust-1", Labels: util.Labels{}}))
+	require.Equal(t, []int64{3, 1}, ids(&ListAccountsParams{Labels: util.Labels{"team": "payments"}}))
+	require.Equal(t, []int64{1}, ids(&ListAccountsParams{OwnerReference: "cust-1", Labels: util.Labels{"team": "payments"}}))
+	require.Empty(t, ids(&ListAccountsParams{Labels: util.Labels{"team": "payments", "region": "us"}}))
+
+	// Labels are merged, and removed when null
+	account, err := s.UpdateAccountMetadata(ctx, &UpdateAccountMetadataParams{
+		ID:          1,
+		DisplayName: pgtype.Text{String: "Payroll", Valid: true},
+		Labels:      []byte(`{"region": null, "tier": "gold"}`),
+		MaxLabels:   util.MaxLabels,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Payroll", account.DisplayName)
+	require.Equal(t, "cust-1", account.OwnerReference)
+	require.Equal(t, util.Labels{"team": "payments", "tier": "gold"}, account.Labels)
+	require.Equal(t, int64(1), account.Version)
+
+	// Only the versions given are changed
+	_, err = s.UpdateAccountMetadata(ctx, &UpdateAccountMetadataParams{
+		ID: 1, Labels: []byte(`{}`), Versions: []int64{0}, MaxLabels: util.MaxLabels,
+	})
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = s.UpdateAccountMetadata(ctx, &UpdateAccountMetadataParams{
+		ID: 1, Labels: []byte(`{}`), Versions: []int64{}, MaxLabels: util.MaxLabels,
+	})
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+	account, err = s.UpdateAccountMetadata(ctx, &UpdateAccountMetadataParams{
+		ID: 1, Labels: []byte(`{}`), Versions: []int64{0, 1}, MaxLabels: util.MaxLabels,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), account.Version)
+
+	// The labels after the merge are limited, so that labels can still be replaced at the limit
+	_, err = s.UpdateAccountMetadata(ctx, &UpdateAccountMetadataParams{
+		ID: 1, Labels: []byte(`{"region": "us"}`), MaxLabels: 2,
+	})
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+	account, err = s.UpdateAccountMetadata(ctx, &UpdateAccountMetadataParams{
+		ID: 1, Labels: []byte(`{"tier": null, "region": "us"}`), MaxLabels: 2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, util.Labels{"team": "payments", "region": "us"}, account.Labels)
+
+	_, err = s.UpdateAccountMetadata(ctx, &UpdateAccountMetadataParams{ID: 5, Labels: []byte(`{}`), MaxLabels: util.MaxLabels})
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestPgxStore_TransactionMetadata(t *testing.T) {
+	ctx := context.Background()
+	s := testStore
+	setup(t, []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100")},
+		{ID: 2, Balance: util.MustParseMoney("100")},
+	})
+	defer teardown(t)
+
+	var created []*Transaction
+	for _, param := range []*CreateTransactionParams{
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("1.00000"), ExternalReference: "inv-1"},
+		{SourceAccountID: 2, DestinationAccountID: 1, Amount: util.MustParseMoney("2.00000")},
+		{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               util.MustParseMoney("3.00000"),
+			Description:          "March rent",
+			ExternalReference:    "inv-1",
+			Metadata:             util.Metadata(`{"invoice": {"id": 123456789012345678}}`),
+		},
+	} {
+		transaction, err := s.CreateTransactionWithLock(ctx, usd(param))
+		require.NoError(t, err)
+		created = append(created, transaction)
+	}
+	require.Equal(t, util.Metadata(`{}`), created[0].Metadata)
+	require.Equal(t, "March rent", created[2].Description)
+	require.JSONEq(t, `{"invoice": {"id": 123456789012345678}}`, string(created[2].Metadata))
+
+	found, err := s.ListTransactionsByExternalReference(ctx, &ListTransactionsByExternalReferenceParams{
+		ExternalReference: "inv-1",
+		BeforeID:          math.MaxInt64,
+		PageSize:          10,
+	})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, created[2].ID, found[0].ID)
+	require.Equal(t, created[0].ID, found[1].ID)
+}
+
+func TestPgxStore_AccountStatement(t *testing.T) {
+	ctx := context.Background()
+	s := testStore
+	setup(t, []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100")},
+		{ID: 2, Balance: util.MustParseMoney("100")},
+	})
+	defer teardown(t)
+
+	var created []*Transaction
+	for _, param := range []*CreateTransactionParams{
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("10.00000")},
+		{SourceAccountID: 2, DestinationAccountID: 1, Amount: util.MustParseMoney("2.50000"), Description: "Refund"},
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("1.25000")},
+	} {
+		transaction, err := s.CreateTransactionWithLock(ctx, usd(param))
+		require.NoError(t, err)
+		created = append(created, transaction)
+	}
+
+	// The balance from the journal is the balance of the account
+	account, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	require.Zero(t, util.MustParseMoney("100").Cmp(account.InitialBalance))
+	total, err := s.SumAccountEntries(ctx, &SumAccountEntriesParams{AccountID: 1, Before: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	requireBalanceChange(t, account.InitialBalance, account.Balance, total)
+
+	// The statement of the period after the first transfer opens with its balance and closes with the current one
+	statement, err := s.GetAccountStatement(ctx, &AccountStatementParams{
+		AccountID: 1,
+		From:      created[1].CreatedAt,
+		To:        time.Now().Add(time.Minute),
+	})
+	require.NoError(t, err)
+	require.Zero(t, util.MustParseMoney("90").Cmp(statement.OpeningBalance))
+	require.Len(t, statement.Entries, 2)
+	require.Equal(t, created[1].ID, statement.Entries[0].TransactionID)
+	require.Equal(t, "Refund", statement.Entries[0].Description)
+	require.Equal(t, int64(2), statement.Entries[0].SourceAccountID)
+	require.Equal(t, created[2].ID, statement.Entries[1].TransactionID)
+	closing := statement.OpeningBalance
+	for _, entry := range statement.Entries {
+		closing, err = closing.Add(entry.Amount)
+		require.NoError(t, err)
+	}
+	require.Zero(t, account.Balance.Cmp(closing))
+
+	// Streaming the statement visits the same entries
+	visitor := &collectingVisitor{}
+	err = s.StreamAccountStatement(ctx, &AccountStatementParams{
+		AccountID: 1,
+		From:      created[1].CreatedAt,
+		To:        time.Now().Add(time.Minute),
+	}, visitor)
+	require.NoError(t, err)
+	require.Equal(t, statement, &visitor.AccountStatement)
+
+	_, err = s.GetAccountStatement(ctx, &AccountStatementParams{AccountID: 3, To: time.Now()})
+	require.True(t, errorx.IsOfType(err, util.ErrAccountNotFound))
+	err = s.StreamAccountStatement(ctx, &AccountStatementParams{AccountID: 3, To: time.Now()}, &collectingVisitor{})
+	require.True(t, errorx.IsOfType(err, util.ErrAccountNotFound))
+}
+
+func TestPgxStore_StreamAccountStatement(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100")},
+		{ID: 2, Balance: util.MustParseMoney("100")},
+		{ID: 3, Balance: util.MustParseMoney("100")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	_, err := s.CreateTransactionWithLock(ctx, usd(&CreateTransactionParams{
+		SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("10"), ExternalReference: "inv-1",
+	}))
+	require.NoError(t, err)
+	multiLeg, err := s.CreateMultiLegTransfer(ctx, &MultiLegTransferParams{
+		SourceAccountID: 2,
+		Amount:          util.MustParseMoney("5"),
+		Currency:        "USD",
+		Legs: []*TransactionLeg{
+			{AccountID: 1, Amount: util.MustParseMoney("2")},
+			{AccountID: 3, Amount: util.MustParseMoney("3")},
+		},
+	})
+	require.NoError(t, err)
+	param := &AccountStatementParams{AccountID: 1, To: time.Now().Add(time.Minute)}
+
+	// Every column is scanned the same as when the statement is collected, including a missing destination
+	statement, err := s.GetAccountStatement(ctx, param)
+	require.NoError(t, err)
+	visitor := &collectingVisitor{}
+	require.NoError(t, s.StreamAccountStatement(ctx, param, visitor))
+	require.Equal(t, statement, &visitor.AccountStatement)
+	require.Len(t, visitor.Entries, 2)
+	require.Equal(t, "inv-1", visitor.Entries[0].ExternalReference)
+	require.Equal(t, int64(2), visitor.Entries[0].DestinationAccountID.Int64)
+	require.Equal(t, multiLeg.ID, visitor.Entries[1].TransactionID)
+	require.False(t, visitor.Entries[1].DestinationAccountID.Valid)
+	require.Zero(t, util.MustParseMoney("2").Cmp(visitor.Entries[1].Amount))
+
+	// An error of the visitor stops the statement and is returned as it is
+	stop := errors.New("stop")
+	failing := &failingVisitor{err: stop}
+	require.ErrorIs(t, s.StreamAccountStatement(ctx, param, failing), stop)
+	require.Equal(t, 1, failing.entries)
+
+	failing = &failingVisitor{err: stop, onOpen: true}
+	require.ErrorIs(t, s.StreamAccountStatement(ctx, param, failing), stop)
+	require.Zero(t, failing.entries)
+}
+
+// failingVisitor fails on the first entry of a streamed statement, or when it is opened
+type failingVisitor struct {
+	err     error
+	onOpen  bool
+	entries int
+}
+
+func (v *failingVisitor) Open(account *Account, openingBalance util.Money) error {
+	if v.onOpen {
+		return v.err
+	}
+	return nil
+}
+
+func (v *failingVisitor) Entry(entry *ListAccountStatementEntriesRow) error {
+	v.entries++
+	return v.err
+}
+
+// collectingVisitor collects a streamed statement
+type collectingVisitor struct {
+	AccountStatement
+}
+
+func (v *collectingVisitor) Open(account *Account, openingBalance util.Money) error {
+	v.Account, v.OpeningBalance = account, openingBalance
+	return nil
+}
+
+func (v *collectingVisitor) Entry(entry *ListAccountStatementEntriesRow) error {
+	v.Entries = append(v.Entries, entry)
+	return nil
+}
+
+func TestPgxStore_ListAccountTransactions(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("100.0")},
+		{ID: 3, Balance: util.MustParseMoney("100.0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	var created []*Transaction
+	for _, param := range []*CreateTransactionParams{
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: util.MustParseMoney("1.00000")},
+		{SourceAccountID: 2, DestinationAccountID: 1, Amount: util.MustParseMoney("2.00000")},
+		{SourceAccountID: 2, DestinationAccountID: 3, Amount: util.MustParseMoney("3.00000")},
+		{SourceAccountID: 1, DestinationAccountID: 3, Amount: util.MustParseMoney("4.00000")},
+	} {
+		transaction, err := s.CreateTransactionWithLock(ctx, usd(param))
+		require.NoError(t, err)
+		created = append(created, transaction)
+	}
+	all := &ListAccountTransactionsParams{
+		Incoming:  true,
+		AccountID: 1,
+		Outgoing:  true,
+		BeforeID:  math.MaxInt64,
+		FromTime:  time.Time{},
+		ToTime:    time.Now().Add(time.Hour),
+		MinAmount: util.MustParseMoney("0"),
+		MaxAmount: util.MustParseMoney("1000"),
+		PageSize:  10,
+	}
+
+	got, err := s.ListAccountTransactions(ctx, all)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	require.Equal(t, created[3].ID, got[0].ID) // newest first
+
+	incoming := *all
+	incoming.Outgoing = false
+	got, err = s.ListAccountTransactions(ctx, &incoming)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, created[1].ID, got[0].ID)
+
+	nextPage := *all
+	nextPage.BeforeID = created[1].ID
+	got, err = s.ListAccountTransactions(ctx, &nextPage)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, created[0].ID, got[0].ID)
+
+	amountRange := *all
+	amountRange.MinAmount = util.MustParseMoney("1.5")
+	amountRange.MaxAmount = util.MustParseMoney("3")
+	got, err = s.ListAccountTransactions(ctx, &amountRange)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, created[1].ID, got[0].ID)
+
+	// Multi-leg credits are merged into the same order, once each
+	multiLeg, err := s.CreateMultiLegTransfer(ctx, &MultiLegTransferParams{
+		SourceAccountID: 2,
+		Amount:          util.MustParseMoney("5.00000"),
+		Currency:        "USD",
+		Legs: []*TransactionLeg{
+			{AccountID: 1, Amount: util.MustParseMoney("2.00000")},
+			{AccountID: 3, Amount: util.MustParseMoney("3.00000")},
+		},
+	})
+	require.NoError(t, err)
+	got, err = s.ListAccountTransactions(ctx, all)
+	require.NoError(t, err)
+	var ids []int64
+	for _, transaction := range got {
+		ids = append(ids, transaction.ID)
+	}
+	require.Equal(t, []int64{multiLeg.ID, created[3].ID, created[1].ID, created[0].ID}, ids)
+
+	firstPage := *all
+	firstPage.PageSize = 2
+	got, err = s.ListAccountTransactions(ctx, &firstPage)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, created[3].ID, got[1].ID)
+}
+
+func TestPgxStore_DoIdempotent(t *testing.T) {
+	accounts := []*CreateAccountParams{
+		{ID: 1, Balance: util.MustParseMoney("100.0")},
+		{ID: 2, Balance: util.MustParseMoney("100.0")},
+	}
+	ctx := context.Background()
+	s := testStore
+	setup(t, accounts)
+	defer teardown(t)
+
+	key := "store-test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	defer func() {
+		require.NoError(t, s.DeleteIdempotencyKey(ctx, key))
+		require.NoError(t, s.DeleteIdempotencyKey(ctx, key+"-released"))
+	}()
+	param := &CreateIdempotencyKeyParams{Key: key, RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	balance := "90.00000" // of account 1 after the transfer
+	transfer := func(ctx context.Context) (*IdempotentResponse, error) {
+		_, err := s.CreateTransactionWithLock(ctx, usd(&CreateTransactionParams{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               util.MustParseMoney("10.00000"),
+		}))
+		if err != nil {
+			return &IdempotentResponse{Status: 409}, nil
+		}
+		// The request reads what it wrote, before it commits
+		account, err := s.GetAccount(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, balance, account.Balance.String())
+		return &IdempotentResponse{Status: 201, Body: []byte(`{}`), Headers: map[string]string{"ETag": `"2"`}}, nil
+	}
+
+	record, err := s.DoIdempotent(ctx, param, transfer)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	// The transfer was committed with the key and its response
+	saved, err := s.GetIdempotencyKey(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, int32(201), saved.ResponseStatus)
+	require.JSONEq(t, `{"ETag":"\"2\""}`, string(saved.ResponseHeaders))
+
+	// A replay gets the saved record, and moves nothing
+	record, err = s.DoIdempotent(ctx, param, transfer)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	require.Equal(t, int32(201), record.ResponseStatus)
+
+	// No response rolls back the transfer and releases the key
+	released := *param
+	released.Key = key + "-released"
+	balance = "80.00000"
+	record, err = s.DoIdempotent(ctx, &released, func(ctx context.Context) (*IdempotentResponse, error) {
+		_, err := transfer(ctx)
+		require.NoError(t, err)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Nil(t, record)
+	_, err = s.GetIdempotencyKey(ctx, released.Key)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+
+	accA, err := s.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "90.00000", accA.Balance.String())
+	require.NoError(t, s.CheckEntriesBalanced(ctx))
+}
+
 func setup(t *testing.T, accounts []*CreateAccountParams) {
 	ctx := context.Background()
 	s := testStore
 	for _, account := range accounts {
+		if account.Currency == "" {
+			account.Currency = "USD"
+		}
+		if account.Type == "" {
+			account.Type, account.BalanceFloor = AccountCash, &util.Money{}
+		}
 		_, err := s.CreateAccount(ctx, account)
 		require.NoError(t, err)
 	}
@@ -186,17 +1397,31 @@ func setup(t *testing.T, accounts []*CreateAccountParams) {
 func teardown(t *testing.T) {
 	ctx := context.Background()
 	s := testStore
+	require.NoError(t, s.DeleteAllScheduledTransferRuns(ctx))
+	require.NoError(t, s.DeleteAllScheduledTransfers(ctx))
+	require.NoError(t, s.DeleteAllHolds(ctx))
+	require.NoError(t, s.DeleteAllEntries(ctx))
 	require.NoError(t, s.DeleteAllTransactions(ctx))
+	require.NoError(t, s.DeleteAllFxRates(ctx))
 	require.NoError(t, s.DeleteAllAccounts(ctx))
 }
 
-func requireBalanceChange(t *testing.T, initialBalance string, finalBalance string, amountTransacted string) {
-	initialV, err := util.StringToAmount(initialBalance)
-	require.NoError(t, err)
-	finalV, err := util.StringToAmount(finalBalance)
-	require.NoError(t, err)
-	amountTransactedV, err := util.StringToAmount(amountTransacted)
+// usd fills in the currency fields of a transfer between USD accounts
+func usd(param *CreateTransactionParams) *CreateTransactionParams {
+	param.Currency, param.DestinationCurrency = "USD", "USD"
+	param.DestinationAmount = param.Amount
+	param.FxRate = "1"
+	return param
+}
+
+// money returns a pointer to amount, for optional Money fields
+func money(amount string) *util.Money {
+	m := util.MustParseMoney(amount)
+	return &m
+}
+
+func requireBalanceChange(t *testing.T, initialBalance util.Money, finalBalance util.Money, amountTransacted util.Money) {
+	expected, err := initialBalance.Add(amountTransacted)
 	require.NoError(t, err)
-	expectedV := *new(big.Rat).Add(&initialV, &amountTransactedV)
-	require.Equal(t, util.AmountToString(expectedV), util.AmountToString(finalV))
+	require.Zero(t, expected.Cmp(finalBalance), "expected balance %s, got %s", expected, finalBalance)
 }
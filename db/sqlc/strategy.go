@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/joomcode/errorx"
+
+	"transfers/util"
+)
+
+// Names of the transfer strategies that can be selected in config.yaml
+const (
+	StrategyLock       = "lock"
+	StrategySSI        = "ssi"
+	StrategyOptimistic = "optimistic"
+)
+
+// TransferStrategy moves money between accounts with a particular concurrency control mechanism
+type TransferStrategy interface {
+	Name() string
+	Transfer(ctx context.Context, param *CreateTransactionParams) (*Transaction, error)
+}
+
+// NewTransferStrategy returns the strategy called name, retrying conflicting transfers according to policy
+func NewTransferStrategy(store Store, name string, policy util.RetryPolicy) (TransferStrategy, error) {
+	var transfer CreateTransactionFunc
+	switch name {
+	case StrategyLock:
+		transfer = store.CreateTransactionWithLock
+	case StrategySSI:
+		transfer = store.CreateTransactionWithSSI
+	case StrategyOptimistic:
+		transfer = store.CreateTransactionWithVersion
+	default:
+		return nil, util.NewUnknownTransferStrategyError(name)
+	}
+	return newRetryingStrategy(name, transfer, policy), nil
+}
+
+type retryingStrategy struct {
+	name     string
+	transfer CreateTransactionFunc
+	policy   util.RetryPolicy
+	metrics  *strategyMetrics
+}
+
+func newRetryingStrategy(name string, transfer CreateTransactionFunc, policy util.RetryPolicy) *retryingStrategy {
+	metrics := metricsFor(name)
+	metrics.maxRetries.Set(int64(policy.MaxRetries))
+	metrics.initialBackoffMs.Set(policy.InitialBackoff.Milliseconds())
+	metrics.randomBackoffMs.Set(policy.RandomBackoff.Milliseconds())
+	return &retryingStrategy{
+		name:     name,
+		transfer: transfer,
+		policy:   policy,
+		metrics:  metrics,
+	}
+}
+
+func (s *retryingStrategy) Name() string {
+	return s.name
+}
+
+// Transfer runs the transfer, retrying with exponential random backoff while it fails with a temporary error
+func (s *retryingStrategy) Transfer(ctx context.Context, param *CreateTransactionParams) (*Transaction, error) {
+	for retry := 0; ; retry++ {
+		s.metrics.attempts.Add(1)
+		transaction, err := s.transfer(ctx, param)
+		if err == nil {
+			s.metrics.successes.Add(1)
+			return transaction, nil
+		}
+		if !errorx.HasTrait(err, errorx.Temporary()) {
+			s.metrics.failures.Add(1)
+			return nil, err
+		}
+		s.metrics.conflicts.Add(1)
+		if retry >= s.policy.MaxRetries {
+			s.metrics.failures.Add(1)
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			s.metrics.failures.Add(1)
+			return nil, util.NewDBError(ctx.Err())
+		case <-time.After(s.policy.Backoff(retry)):
+		}
+		s.metrics.retries.Add(1)
+	}
+}
+
+// strategyMetrics are published under the "transfer_strategies" expvar, keyed by strategy name
+type strategyMetrics struct {
+	attempts         expvar.Int
+	successes        expvar.Int
+	failures         expvar.Int
+	conflicts        expvar.Int
+	retries          expvar.Int
+	maxRetries       expvar.Int
+	initialBackoffMs expvar.Int
+	randomBackoffMs  expvar.Int
+}
+
+var (
+	strategyMetricsMu  sync.Mutex
+	strategyMetricsMap = expvar.NewMap("transfer_strategies")
+	strategyMetricsAll = map[string]*strategyMetrics{}
+)
+
+func metricsFor(name string) *strategyMetrics {
+	strategyMetricsMu.Lock()
+	defer strategyMetricsMu.Unlock()
+	if metrics, ok := strategyMetricsAll[name]; ok {
+		return metrics
+	}
+	metrics := &strategyMetrics{}
+	vars := new(expvar.Map).Init()
+	vars.Set("attempts", &metrics.attempts)
+	vars.Set("successes", &metrics.successes)
+	vars.Set("failures", &metrics.failures)
+	vars.Set("conflicts", &metrics.conflicts)
+	vars.Set("retries", &metrics.retries)
+	vars.Set("max_retries", &metrics.maxRetries)
+	vars.Set("initial_backoff_ms", &metrics.initialBackoffMs)
+	vars.Set("random_backoff_ms", &metrics.randomBackoffMs)
+	strategyMetricsMap.Set(name, vars)
+	strategyMetricsAll[name] = metrics
+	return metrics
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"transfers/util"
+)
+
+func TestNewTransferStrategy(t *testing.T) {
+	for _, name := range []string{StrategyLock, StrategySSI, StrategyOptimistic} {
+		strategy, err := NewTransferStrategy(testStore, name, util.RetryPolicy{})
+		require.NoError(t, err)
+		require.Equal(t, name, strategy.Name())
+	}
+	_, err := NewTransferStrategy(testStore, "unknown", util.RetryPolicy{})
+	require.Error(t, err)
+}
+
+func TestRetryingStrategy_Transfer(t *testing.T) {
+	conflict := util.NewTransactionConflictError(errors.New("(SQLSTATE 40001)"))
+	policy := util.RetryPolicy{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		RandomBackoff:  time.Millisecond,
+	}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "success", errs: []error{nil}, wantCalls: 1},
+		{name: "success after conflicts", errs: []error{conflict, conflict, nil}, wantCalls: 3},
+		{name: "too many conflicts", errs: []error{conflict, conflict, conflict}, wantErr: true, wantCalls: 3},
+		{name: "permanent error", errs: []error{util.NewInsufficientBalanceError()}, wantErr: true, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			transfer := func(context.Context, *CreateTransactionParams) (*Transaction, error) {
+				err := tt.errs[calls]
+				calls++
+				if err != nil {
+					return nil, err
+				}
+				return &Transaction{ID: 1}, nil
+			}
+			strategy := newRetryingStrategy("test", transfer, policy)
+			before := strategy.metrics.retries.Value()
+
+			got, err := strategy.Transfer(context.Background(), &CreateTransactionParams{})
+			require.Equal(t, tt.wantErr, err != nil)
+			require.Equal(t, tt.wantCalls, calls)
+			require.Equal(t, int64(tt.wantCalls-1), strategy.metrics.retries.Value()-before)
+			if err == nil {
+				require.Equal(t, int64(1), got.ID)
+			}
+		})
+	}
+}
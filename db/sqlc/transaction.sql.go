@@ -7,33 +7,188 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"transfers/util"
 )
 
+const createMultiLegTransaction = `-- name: CreateMultiLegTransaction :one
+INSERT INTO transactions (
+    source_account_id,
+    amount,
+    currency,
+    destination_amount,
+    destination_currency
+) VALUES (
+  $1, $2, $3, $2, $3
+) RETURNING id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata
+`
+
+type CreateMultiLegTransactionParams struct {
+	SourceAccountID int64      `json:"source_account_id"`
+	Amount          util.Money `json:"amount"`
+	Currency        string     `json:"currency"`
+}
+
+func (q *Queries) CreateMultiLegTransaction(ctx context.Context, arg *CreateMultiLegTransactionParams) (*Transaction, error) {
+	row := q.db.QueryRow(ctx, createMultiLegTransaction, arg.SourceAccountID, arg.Amount, arg.Currency)
+	var i Transaction
+	err := row.Scan(
+		&i.ID,
+		&i.SourceAccountID,
+		&i.DestinationAccountID,
+		&i.Amount,
+		&i.Currency,
+		&i.DestinationAmount,
+		&i.DestinationCurrency,
+		&i.FxRate,
+		&i.FxRateID,
+		&i.CreatedAt,
+		&i.ReversalOf,
+		&i.Description,
+		&i.ExternalReference,
+		&i.Metadata,
+	)
+	return &i, err
+}
+
+const createReversalTransaction = `-- name: CreateReversalTransaction :one
+INSERT INTO transactions (
+    source_account_id,
+    destination_account_id,
+    amount,
+    currency,
+    destination_amount,
+    destination_currency,
+    fx_rate,
+    reversal_of
+) VALUES (
+  $1,
+  $2::bigint,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8
+) RETURNING id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata
+`
+
+type CreateReversalTransactionParams struct {
+	SourceAccountID      int64       `json:"source_account_id"`
+	DestinationAccountID int64       `json:"destination_account_id"`
+	Amount               util.Money  `json:"amount"`
+	Currency             string      `json:"currency"`
+	DestinationAmount    util.Money  `json:"destination_amount"`
+	DestinationCurrency  string      `json:"destination_currency"`
+	FxRate               string      `json:"fx_rate"`
+	ReversalOf           pgtype.Int8 `json:"reversal_of"`
+}
+
+func (q *Queries) CreateReversalTransaction(ctx context.Context, arg *CreateReversalTransactionParams) (*Transaction, error) {
+	row := q.db.QueryRow(ctx, createReversalTransaction,
+		arg.SourceAccountID,
+		arg.DestinationAccountID,
+		arg.Amount,
+		arg.Currency,
+		arg.DestinationAmount,
+		arg.DestinationCurrency,
+		arg.FxRate,
+		arg.ReversalOf,
+	)
+	var i Transaction
+	err := row.Scan(
+		&i.ID,
+		&i.SourceAccountID,
+		&i.DestinationAccountID,
+		&i.Amount,
+		&i.Currency,
+		&i.DestinationAmount,
+		&i.DestinationCurrency,
+		&i.FxRate,
+		&i.FxRateID,
+		&i.CreatedAt,
+		&i.ReversalOf,
+		&i.Description,
+		&i.ExternalReference,
+		&i.Metadata,
+	)
+	return &i, err
+}
+
 const createTransaction = `-- name: CreateTransaction :one
 INSERT INTO transactions (
     source_account_id,
     destination_account_id,
-    amount
+    amount,
+    currency,
+    destination_amount,
+    destination_currency,
+    fx_rate,
+    fx_rate_id,
+    description,
+    external_reference,
+    metadata
 ) VALUES (
-  $1, $2, $3
-) RETURNING id, source_account_id, destination_account_id, amount, created_at
+  $1,
+  $2::bigint,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8,
+  $9,
+  $10,
+  $11
+) RETURNING id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata
 `
 
 type CreateTransactionParams struct {
-	SourceAccountID      int64  `json:"source_account_id"`
-	DestinationAccountID int64  `json:"destination_account_id"`
-	Amount               string `json:"amount"`
+	SourceAccountID      int64         `json:"source_account_id"`
+	DestinationAccountID int64         `json:"destination_account_id"`
+	Amount               util.Money    `json:"amount"`
+	Currency             string        `json:"currency"`
+	DestinationAmount    util.Money    `json:"destination_amount"`
+	DestinationCurrency  string        `json:"destination_currency"`
+	FxRate               string        `json:"fx_rate"`
+	FxRateID             pgtype.Int8   `json:"fx_rate_id"`
+	Description          string        `json:"description"`
+	ExternalReference    string        `json:"external_reference"`
+	Metadata             util.Metadata `json:"metadata"`
 }
 
 func (q *Queries) CreateTransaction(ctx context.Context, arg *CreateTransactionParams) (*Transaction, error) {
-	row := q.db.QueryRow(ctx, createTransaction, arg.SourceAccountID, arg.DestinationAccountID, arg.Amount)
+	row := q.db.QueryRow(ctx, createTransaction,
+		arg.SourceAccountID,
+		arg.DestinationAccountID,
+		arg.Amount,
+		arg.Currency,
+		arg.DestinationAmount,
+		arg.DestinationCurrency,
+		arg.FxRate,
+		arg.FxRateID,
+		arg.Description,
+		arg.ExternalReference,
+		arg.Metadata,
+	)
 	var i Transaction
 	err := row.Scan(
 		&i.ID,
 		&i.SourceAccountID,
 		&i.DestinationAccountID,
 		&i.Amount,
+		&i.Currency,
+		&i.DestinationAmount,
+		&i.DestinationCurrency,
+		&i.FxRate,
+		&i.FxRateID,
 		&i.CreatedAt,
+		&i.ReversalOf,
+		&i.Description,
+		&i.ExternalReference,
+		&i.Metadata,
 	)
 	return &i, err
 }
@@ -46,3 +201,262 @@ func (q *Queries) DeleteAllTransactions(ctx context.Context) error {
 	_, err := q.db.Exec(ctx, deleteAllTransactions)
 	return err
 }
+
+const getTransaction = `-- name: GetTransaction :one
+SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM transactions
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetTransaction(ctx context.Context, id int64) (*Transaction, error) {
+	row := q.db.QueryRow(ctx, getTransaction, id)
+	var i Transaction
+	err := row.Scan(
+		&i.ID,
+		&i.SourceAccountID,
+		&i.DestinationAccountID,
+		&i.Amount,
+		&i.Currency,
+		&i.DestinationAmount,
+		&i.DestinationCurrency,
+		&i.FxRate,
+		&i.FxRateID,
+		&i.CreatedAt,
+		&i.ReversalOf,
+		&i.Description,
+		&i.ExternalReference,
+		&i.Metadata,
+	)
+	return &i, err
+}
+
+const getTransactionForUpdate = `-- name: GetTransactionForUpdate :one
+SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM transactions
+WHERE id = $1 LIMIT 1
+FOR UPDATE
+`
+
+func (q *Queries) GetTransactionForUpdate(ctx context.Context, id int64) (*Transaction, error) {
+	row := q.db.QueryRow(ctx, getTransactionForUpdate, id)
+	var i Transaction
+	err := row.Scan(
+		&i.ID,
+		&i.SourceAccountID,
+		&i.DestinationAccountID,
+		&i.Amount,
+		&i.Currency,
+		&i.DestinationAmount,
+		&i.DestinationCurrency,
+		&i.FxRate,
+		&i.FxRateID,
+		&i.CreatedAt,
+		&i.ReversalOf,
+		&i.Description,
+		&i.ExternalReference,
+		&i.Metadata,
+	)
+	return &i, err
+}
+
+const listAccountTransactions = `-- name: ListAccountTransactions :many
+SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM (
+  SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM transactions
+  WHERE $1::boolean AND source_account_id = $2
+    AND id < $3
+    AND created_at >= $4
+    AND created_at < $5
+    AND amount >= $6
+    AND amount <= $7
+  UNION ALL
+  SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM transactions
+  WHERE $8::boolean AND destination_account_id = $2
+    AND NOT ($1::boolean AND source_account_id = $2)
+    AND id < $3
+    AND created_at >= $4
+    AND created_at < $5
+    AND amount >= $6
+    AND amount <= $7
+  UNION ALL
+  SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM transactions
+  WHERE $8::boolean AND destination_account_id IS NULL
+    AND NOT ($1::boolean AND source_account_id = $2)
+    AND id IN (
+      SELECT transaction_id FROM entries
+      WHERE account_id = $2 AND amount > 0
+        AND created_at >= $4
+        AND created_at < $5
+    )
+    AND id < $3
+    AND created_at >= $4
+    AND created_at < $5
+    AND amount >= $6
+    AND amount <= $7
+) AS account_transactions
+ORDER BY id DESC
+LIMIT $9
+`
+
+type ListAccountTransactionsParams struct {
+	Outgoing  bool       `json:"outgoing"`
+	AccountID int64      `json:"account_id"`
+	BeforeID  int64      `json:"before_id"`
+	FromTime  time.Time  `json:"from_time"`
+	ToTime    time.Time  `json:"to_time"`
+	MinAmount util.Money `json:"min_amount"`
+	MaxAmount util.Money `json:"max_amount"`
+	Incoming  bool       `json:"incoming"`
+	PageSize  int32      `json:"page_size"`
+}
+
+func (q *Queries) ListAccountTransactions(ctx context.Context, arg *ListAccountTransactionsParams) ([]*Transaction, error) {
+	rows, err := q.db.Query(ctx, listAccountTransactions,
+		arg.Outgoing,
+		arg.AccountID,
+		arg.BeforeID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.Incoming,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Transaction
+	for rows.Next() {
+		var i Transaction
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourceAccountID,
+			&i.DestinationAccountID,
+			&i.Amount,
+			&i.Currency,
+			&i.DestinationAmount,
+			&i.DestinationCurrency,
+			&i.FxRate,
+			&i.FxRateID,
+			&i.CreatedAt,
+			&i.ReversalOf,
+			&i.Description,
+			&i.ExternalReference,
+			&i.Metadata,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReversals = `-- name: ListReversals :many
+SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM transactions
+WHERE reversal_of = $1
+ORDER BY id
+`
+
+func (q *Queries) ListReversals(ctx context.Context, reversalOf pgtype.Int8) ([]*Transaction, error) {
+	rows, err := q.db.Query(ctx, listReversals, reversalOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Transaction
+	for rows.Next() {
+		var i Transaction
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourceAccountID,
+			&i.DestinationAccountID,
+			&i.Amount,
+			&i.Currency,
+			&i.DestinationAmount,
+			&i.DestinationCurrency,
+			&i.FxRate,
+			&i.FxRateID,
+			&i.CreatedAt,
+			&i.ReversalOf,
+			&i.Description,
+			&i.ExternalReference,
+			&i.Metadata,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTransactionsByExternalReference = `-- name: ListTransactionsByExternalReference :many
+SELECT id, source_account_id, destination_account_id, amount, currency, destination_amount, destination_currency, fx_rate, fx_rate_id, created_at, reversal_of, description, external_reference, metadata FROM transactions
+WHERE external_reference = $1
+  AND id < $2
+ORDER BY id DESC
+LIMIT $3
+`
+
+type ListTransactionsByExternalReferenceParams struct {
+	ExternalReference string `json:"external_reference"`
+	BeforeID          int64  `json:"before_id"`
+	PageSize          int32  `json:"page_size"`
+}
+
+func (q *Queries) ListTransactionsByExternalReference(ctx context.Context, arg *ListTransactionsByExternalReferenceParams) ([]*Transaction, error) {
+	rows, err := q.db.Query(ctx, listTransactionsByExternalReference, arg.ExternalReference, arg.BeforeID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*Transaction
+	for rows.Next() {
+		var i Transaction
+		if err := rows.Scan(
+			&i.ID,
+			&i.SourceAccountID,
+			&i.DestinationAccountID,
+			&i.Amount,
+			&i.Currency,
+			&i.DestinationAmount,
+			&i.DestinationCurrency,
+			&i.FxRate,
+			&i.FxRateID,
+			&i.CreatedAt,
+			&i.ReversalOf,
+			&i.Description,
+			&i.ExternalReference,
+			&i.Metadata,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sumReversals = `-- name: SumReversals :one
+SELECT COALESCE(SUM(amount), 0)::numeric AS amount,
+  COALESCE(SUM(destination_amount), 0)::numeric AS destination_amount
+FROM transactions
+WHERE reversal_of = $1
+`
+
+type SumReversalsRow struct {
+	Amount            util.Money `json:"amount"`
+	DestinationAmount util.Money `json:"destination_amount"`
+}
+
+func (q *Queries) SumReversals(ctx context.Context, reversalOf pgtype.Int8) (*SumReversalsRow, error) {
+	row := q.db.QueryRow(ctx, sumReversals, reversalOf)
+	var i SumReversalsRow
+	err := row.Scan(&i.Amount, &i.DestinationAmount)
+	return &i, err
+}
@@ -0,0 +1,240 @@
+/*
+Package iso20022 renders account activity as ISO 20022 cash management messages: camt.053 end-of-day statements and
+camt.054 debit/credit notifications, version 08 of both, for the bank-facing systems that read them.
+*/
+package iso20022
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"transfers/util"
+)
+
+// Codes of the messages
+const (
+	credit = "CRDT"
+	debit  = "DBIT"
+	booked = "BOOK"
+
+	openingBooked = "OPBD"
+	closingBooked = "CLBD"
+
+	// Bank transaction code domain and families of the transfers between accounts of the system
+	paymentsDomain          = "PMNT"
+	issuedCreditTransfers   = "ICDT"
+	receivedCreditTransfers = "RCDT"
+	bookTransfer            = "BOOK"
+)
+
+// Lengths of the text types of the schemas
+const (
+	max35Text  = 35
+	max70Text  = 70
+	max140Text = 140
+	max500Text = 500
+)
+
+// Account is the account that a message reports on
+type Account struct {
+	ID       int64
+	Currency string
+	// Name of the account, if any
+	Name string
+}
+
+// Entry is a movement of an account, made by a transaction
+type Entry struct {
+	TransactionID int64
+	// Negative for debits, positive for credits, in the currency of the account
+	Amount   util.Money
+	BookedAt time.Time
+	// Account that the money went to or came from, if there is a single one
+	CounterpartyAccountID int64
+	Description           string
+	// Reference of the transaction in the client's system, if any
+	ExternalReference string
+}
+
+type groupHeader struct {
+	MsgID   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type period struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type account struct {
+	ID  accountID `xml:"Id"`
+	Ccy string    `xml:"Ccy,omitempty"`
+	Nm  string    `xml:"Nm,omitempty"`
+}
+
+// accountID identifies accounts by their account numbers, since they have no IBAN
+type accountID struct {
+	Othr struct {
+		ID string `xml:"Id"`
+	} `xml:"Othr"`
+}
+
+type amount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type code struct {
+	Cd string `xml:"Cd"`
+}
+
+type dateTime struct {
+	DtTm string `xml:"DtTm"`
+}
+
+type entry struct {
+	NtryRef     string       `xml:"NtryRef"`
+	Amt         amount       `xml:"Amt"`
+	CdtDbtInd   string       `xml:"CdtDbtInd"`
+	Sts         code         `xml:"Sts"`
+	BookgDt     dateTime     `xml:"BookgDt"`
+	AcctSvcrRef string       `xml:"AcctSvcrRef"`
+	BkTxCd      bankTxCode   `xml:"BkTxCd"`
+	NtryDtls    entryDetails `xml:"NtryDtls"`
+}
+
+type bankTxCode struct {
+	Domn struct {
+		Cd   string `xml:"Cd"`
+		Fmly struct {
+			Cd        string `xml:"Cd"`
+			SubFmlyCd string `xml:"SubFmlyCd"`
+		} `xml:"Fmly"`
+	} `xml:"Domn"`
+}
+
+type entryDetails struct {
+	TxDtls txDetails `xml:"TxDtls"`
+}
+
+type txDetails struct {
+	Refs       txRefs          `xml:"Refs"`
+	RltdPties  *relatedParties `xml:"RltdPties"`
+	RmtInf     *remittance     `xml:"RmtInf"`
+	AddtlTxInf string          `xml:"AddtlTxInf,omitempty"`
+}
+
+type txRefs struct {
+	AcctSvcrRef string `xml:"AcctSvcrRef"`
+	EndToEndID  string `xml:"EndToEndId,omitempty"`
+}
+
+// relatedParties names the counterparty: the debtor of a credit, or the creditor of a debit
+type relatedParties struct {
+	DbtrAcct *account `xml:"DbtrAcct"`
+	CdtrAcct *account `xml:"CdtrAcct"`
+}
+
+type remittance struct {
+	Ustrd []string `xml:"Ustrd"`
+}
+
+// marshal renders a message document, with its XML declaration
+func marshal(messageID string, document any) ([]byte, error) {
+	if messageID == "" || utf8.RuneCountInString(messageID) > max35Text {
+		return nil, util.NewInvalidMessageIDError(messageID, max35Text)
+	}
+	out, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// toEntry renders an entry with amount, its amount as rounded by the message
+func toEntry(account *Account, e *Entry, amount util.Money) entry {
+	ref := strconv.FormatInt(e.TransactionID, 10)
+	indicator, family := credit, receivedCreditTransfers
+	if e.Amount.Sign() < 0 {
+		indicator, family = debit, issuedCreditTransfers
+	}
+	result := entry{
+		NtryRef:     ref,
+		Amt:         toAmount(amount, account.Currency),
+		CdtDbtInd:   indicator,
+		Sts:         code{Cd: booked},
+		BookgDt:     dateTime{DtTm: formatTime(e.BookedAt)},
+		AcctSvcrRef: ref,
+	}
+	result.BkTxCd.Domn.Cd = paymentsDomain
+	result.BkTxCd.Domn.Fmly.Cd = family
+	result.BkTxCd.Domn.Fmly.SubFmlyCd = bookTransfer
+
+	details := &result.NtryDtls.TxDtls
+	details.Refs.AcctSvcrRef = ref
+	// References too long for an end to end identification are still reported, as additional information
+	if utf8.RuneCountInString(e.ExternalReference) <= max35Text {
+		details.Refs.EndToEndID = e.ExternalReference
+	} else {
+		details.AddtlTxInf = truncate(e.ExternalReference, max500Text)
+	}
+	if e.CounterpartyAccountID != 0 {
+		counterparty := toAccount(&Account{ID: e.CounterpartyAccountID})
+		if indicator == debit {
+			details.RltdPties = &relatedParties{CdtrAcct: counterparty}
+		} else {
+			details.RltdPties = &relatedParties{DbtrAcct: counterparty}
+		}
+	}
+	if e.Description != "" {
+		details.RmtInf = &remittance{Ustrd: split(e.Description, max140Text)}
+	}
+	return result
+}
+
+func toAccount(a *Account) *account {
+	result := &account{Ccy: a.Currency, Nm: truncate(a.Name, max70Text)}
+	result.ID.Othr.ID = util.AccountNumber(a.ID)
+	return result
+}
+
+// toAmount returns the magnitude of amount in the precision of currency, since the direction goes in CdtDbtInd
+func toAmount(m util.Money, currency string) amount {
+	if m.Sign() < 0 {
+		m = m.Neg()
+	}
+	return amount{Ccy: currency, Value: util.CurrencyAmount(m, currency).String()}
+}
+
+// indicator is the credit/debit indicator of a balance, which is a debit when negative
+func indicator(m util.Money) string {
+	if m.Sign() < 0 {
+		return debit
+	}
+	return credit
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// truncate cuts text down to max characters, for the text fields of the schema
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max])
+}
+
+// split cuts text into lines of at most max characters, for repeated text fields
+func split(text string, max int) []string {
+	runes := []rune(text)
+	var lines []string
+	for len(runes) > max {
+		lines = append(lines, string(runes[:max]))
+		runes = runes[max:]
+	}
+	return append(lines, string(runes))
+}
@@ -0,0 +1,155 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"transfers/util"
+)
+
+// Statement is the activity of an account over a period, from its balance at the start of the period
+type Statement struct {
+	// Identifies the message, and the statement in it, in at most 35 characters
+	MessageID string
+	CreatedAt time.Time
+	Account   Account
+	From      time.Time
+	To        time.Time
+	// Balance before the first entry of the period
+	OpeningBalance util.Money
+	// Oldest first
+	Entries []*Entry
+}
+
+type camt053Document struct {
+	XMLName       xml.Name                `xml:"urn:iso:std:iso:20022:tech:xsd:camt.053.001.08 Document"`
+	BkToCstmrStmt bankToCustomerStatement `xml:"BkToCstmrStmt"`
+}
+
+type bankToCustomerStatement struct {
+	GrpHdr groupHeader `xml:"GrpHdr"`
+	Stmt   statement   `xml:"Stmt"`
+}
+
+type statement struct {
+	ID        string    `xml:"Id"`
+	CreDtTm   string    `xml:"CreDtTm"`
+	FrToDt    period    `xml:"FrToDt"`
+	Acct      *account  `xml:"Acct"`
+	Bal       []balance `xml:"Bal"`
+	TxsSummry summary   `xml:"TxsSummry"`
+	Ntry      []entry   `xml:"Ntry"`
+	// Residual of rounding the closing balance
+	AddtlStmtInf string `xml:"AddtlStmtInf,omitempty"`
+}
+
+type balance struct {
+	Tp struct {
+		CdOrPrtry code `xml:"CdOrPrtry"`
+	} `xml:"Tp"`
+	Amt       amount   `xml:"Amt"`
+	CdtDbtInd string   `xml:"CdtDbtInd"`
+	Dt        dateTime `xml:"Dt"`
+}
+
+type summary struct {
+	TtlNtries    totalEntries `xml:"TtlNtries"`
+	TtlCdtNtries numberAndSum `xml:"TtlCdtNtries"`
+	TtlDbtNtries numberAndSum `xml:"TtlDbtNtries"`
+}
+
+type totalEntries struct {
+	NbOfNtries string `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+	TtlNetNtry struct {
+		Amt       string `xml:"Amt"`
+		CdtDbtInd string `xml:"CdtDbtInd"`
+	} `xml:"TtlNetNtry"`
+}
+
+type numberAndSum struct {
+	NbOfNtries string `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+/*
+MarshalStatement renders a statement as a camt.053 bank to customer statement. Amounts are rounded to the decimal places
+of the currency of the account with util.BalanceRounding, so that the entries and the transaction summary add up to the
+closing balance, and the residual that rounding leaves out of the closing balance, if any, is reported in the
+additional statement information.
+*/
+func MarshalStatement(s *Statement) ([]byte, error) {
+	currency := s.Account.Currency
+	rounding, err := util.NewBalanceRounding(currency, s.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+	opening := rounding.Balance()
+	var credits, debits util.Money
+	var creditCount, debitCount int
+	stmt := statement{
+		ID:      s.MessageID,
+		CreDtTm: formatTime(s.CreatedAt),
+		FrToDt:  period{FrDtTm: formatTime(s.From), ToDtTm: formatTime(s.To)},
+		Acct:    toAccount(&s.Account),
+		Ntry:    make([]entry, 0, len(s.Entries)),
+	}
+	for _, e := range s.Entries {
+		amount, err := rounding.Add(e.Amount)
+		if err != nil {
+			return nil, err
+		}
+		// The direction follows the entry, whose amount may round to zero
+		if e.Amount.Sign() < 0 {
+			debits, err = debits.Sub(amount)
+			debitCount++
+		} else {
+			credits, err = credits.Add(amount)
+			creditCount++
+		}
+		if err != nil {
+			return nil, err
+		}
+		stmt.Ntry = append(stmt.Ntry, toEntry(&s.Account, e, amount))
+	}
+	stmt.Bal = []balance{
+		toBalance(openingBooked, opening, currency, s.From),
+		toBalance(closingBooked, rounding.Balance(), currency, s.To),
+	}
+	if residual := rounding.Residual(); !residual.IsZero() {
+		stmt.AddtlStmtInf = "Rounding residual " + currency + " " + residual.String()
+	}
+
+	total, err := credits.Add(debits)
+	if err != nil {
+		return nil, err
+	}
+	net, err := credits.Sub(debits)
+	if err != nil {
+		return nil, err
+	}
+	stmt.TxsSummry.TtlNtries.NbOfNtries = strconv.Itoa(creditCount + debitCount)
+	stmt.TxsSummry.TtlNtries.Sum = toAmount(total, currency).Value
+	stmt.TxsSummry.TtlNtries.TtlNetNtry.Amt = toAmount(net, currency).Value
+	stmt.TxsSummry.TtlNtries.TtlNetNtry.CdtDbtInd = indicator(net)
+	stmt.TxsSummry.TtlCdtNtries = numberAndSum{NbOfNtries: strconv.Itoa(creditCount), Sum: toAmount(credits, currency).Value}
+	stmt.TxsSummry.TtlDbtNtries = numberAndSum{NbOfNtries: strconv.Itoa(debitCount), Sum: toAmount(debits, currency).Value}
+
+	return marshal(s.MessageID, &camt053Document{
+		BkToCstmrStmt: bankToCustomerStatement{
+			GrpHdr: groupHeader{MsgID: s.MessageID, CreDtTm: formatTime(s.CreatedAt)},
+			Stmt:   stmt,
+		},
+	})
+}
+
+func toBalance(balanceType string, m util.Money, currency string, at time.Time) balance {
+	result := balance{
+		Amt:       toAmount(m, currency),
+		CdtDbtInd: indicator(m),
+		Dt:        dateTime{DtTm: formatTime(at)},
+	}
+	result.Tp.CdOrPrtry.Cd = balanceType
+	return result
+}
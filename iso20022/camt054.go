@@ -0,0 +1,52 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Notification tells the owner of an account about the entries that a transaction made to it
+type Notification struct {
+	// Identifies the message, and the notification in it, in at most 35 characters
+	MessageID string
+	CreatedAt time.Time
+	Account   Account
+	Entries   []*Entry
+}
+
+type camt054Document struct {
+	XMLName               xml.Name                   `xml:"urn:iso:std:iso:20022:tech:xsd:camt.054.001.08 Document"`
+	BkToCstmrDbtCdtNtfctn bankToCustomerNotification `xml:"BkToCstmrDbtCdtNtfctn"`
+}
+
+type bankToCustomerNotification struct {
+	GrpHdr groupHeader  `xml:"GrpHdr"`
+	Ntfctn notification `xml:"Ntfctn"`
+}
+
+type notification struct {
+	ID      string   `xml:"Id"`
+	CreDtTm string   `xml:"CreDtTm"`
+	Acct    *account `xml:"Acct"`
+	Ntry    []entry  `xml:"Ntry"`
+}
+
+// MarshalNotification renders a notification as a camt.054 bank to customer debit/credit notification. Having no
+// balance to add up to, each entry is rounded on its own to the decimal places of the currency of the account.
+func MarshalNotification(n *Notification) ([]byte, error) {
+	ntfctn := notification{
+		ID:      n.MessageID,
+		CreDtTm: formatTime(n.CreatedAt),
+		Acct:    toAccount(&n.Account),
+		Ntry:    make([]entry, 0, len(n.Entries)),
+	}
+	for _, e := range n.Entries {
+		ntfctn.Ntry = append(ntfctn.Ntry, toEntry(&n.Account, e, e.Amount))
+	}
+	return marshal(n.MessageID, &camt054Document{
+		BkToCstmrDbtCdtNtfctn: bankToCustomerNotification{
+			GrpHdr: groupHeader{MsgID: n.MessageID, CreDtTm: formatTime(n.CreatedAt)},
+			Ntfctn: ntfctn,
+		},
+	})
+}
@@ -0,0 +1,164 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"strings"
+
+	"transfers/util"
+)
+
+const (
+	namespacePrefix = "urn:iso:std:iso:20022:tech:xsd:"
+	pain001         = "pain.001.001."
+)
+
+// PaymentInitiation is a pain.001 customer credit transfer initiation, a file of payments for the bank to make
+type PaymentInitiation struct {
+	// Name and version of the message, such as pain.001.001.09
+	MessageNameID string
+	MessageID     string
+	CreatedAt     string
+	// Number of credit transfers and sum of their amounts claimed by the group header, the sum being optional
+	NumberOfTransactions string
+	ControlSum           string
+	Payments             []*PaymentInformation
+}
+
+// PaymentInformation is a group of credit transfers from one debtor account
+type PaymentInformation struct {
+	ID string
+	// Day, or date and time, that the debtor asked for the payments to be made on, as written in the file
+	RequestedExecutionDate string
+	DebtorAccount          AccountReference
+	Transfers              []*CreditTransfer
+}
+
+// AccountReference identifies an account by its IBAN or by another identification, which is its account number here
+type AccountReference struct {
+	IBAN  string
+	Other string
+}
+
+// CreditTransfer is an instruction to pay an amount to a creditor account
+type CreditTransfer struct {
+	InstructionID string
+	EndToEndID    string
+	// Instructed amount, as written in the file
+	Amount          string
+	Currency        string
+	CreditorAccount AccountReference
+	// Unstructured remittance information
+	RemittanceInformation []string
+}
+
+type pain001Document struct {
+	XMLName          xml.Name `xml:"Document"`
+	CstmrCdtTrfInitn struct {
+		GrpHdr struct {
+			MsgID   string `xml:"MsgId"`
+			CreDtTm string `xml:"CreDtTm"`
+			NbOfTxs string `xml:"NbOfTxs"`
+			CtrlSum string `xml:"CtrlSum"`
+		} `xml:"GrpHdr"`
+		PmtInf []struct {
+			PmtInfID    string `xml:"PmtInfId"`
+			ReqdExctnDt struct {
+				// A date before version 08, and a choice of a date or a date and time since
+				Value string `xml:",chardata"`
+				Dt    string `xml:"Dt"`
+				DtTm  string `xml:"DtTm"`
+			} `xml:"ReqdExctnDt"`
+			DbtrAcct    accountIdentity `xml:"DbtrAcct"`
+			CdtTrfTxInf []struct {
+				PmtID struct {
+					InstrID    string `xml:"InstrId"`
+					EndToEndID string `xml:"EndToEndId"`
+				} `xml:"PmtId"`
+				Amt struct {
+					InstdAmt amount `xml:"InstdAmt"`
+				} `xml:"Amt"`
+				CdtrAcct accountIdentity `xml:"CdtrAcct"`
+				RmtInf   struct {
+					Ustrd []string `xml:"Ustrd"`
+				} `xml:"RmtInf"`
+			} `xml:"CdtTrfTxInf"`
+		} `xml:"PmtInf"`
+	} `xml:"CstmrCdtTrfInitn"`
+}
+
+type accountIdentity struct {
+	ID struct {
+		IBAN string `xml:"IBAN"`
+		Othr struct {
+			ID string `xml:"Id"`
+		} `xml:"Othr"`
+	} `xml:"Id"`
+}
+
+/*
+ParsePaymentInitiation reads a pain.001 document of any version. Only the structure of the file is checked here: the
+amounts and accounts of its credit transfers are left as written, to be checked and reported on one by one.
+*/
+func ParsePaymentInitiation(data []byte) (*PaymentInitiation, error) {
+	var document pain001Document
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, util.NewInvalidPaymentFileError(err.Error())
+	}
+	messageName := strings.TrimPrefix(document.XMLName.Space, namespacePrefix)
+	if !strings.HasPrefix(messageName, pain001) {
+		return nil, util.NewInvalidPaymentFileError("not a pain.001 document: " + document.XMLName.Space)
+	}
+	initiation := document.CstmrCdtTrfInitn
+	if initiation.GrpHdr.MsgID == "" {
+		return nil, util.NewInvalidPaymentFileError("missing MsgId")
+	}
+	result := &PaymentInitiation{
+		MessageNameID:        messageName,
+		MessageID:            initiation.GrpHdr.MsgID,
+		CreatedAt:            initiation.GrpHdr.CreDtTm,
+		NumberOfTransactions: initiation.GrpHdr.NbOfTxs,
+		ControlSum:           initiation.GrpHdr.CtrlSum,
+	}
+	for _, pmtInf := range initiation.PmtInf {
+		payment := &PaymentInformation{
+			ID:            pmtInf.PmtInfID,
+			DebtorAccount: toAccountReference(pmtInf.DbtrAcct),
+		}
+		switch date := pmtInf.ReqdExctnDt; {
+		case date.Dt != "":
+			payment.RequestedExecutionDate = strings.TrimSpace(date.Dt)
+		case date.DtTm != "":
+			payment.RequestedExecutionDate = strings.TrimSpace(date.DtTm)
+		default:
+			payment.RequestedExecutionDate = strings.TrimSpace(date.Value)
+		}
+		for _, tx := range pmtInf.CdtTrfTxInf {
+			payment.Transfers = append(payment.Transfers, &CreditTransfer{
+				InstructionID:         tx.PmtID.InstrID,
+				EndToEndID:            tx.PmtID.EndToEndID,
+				Amount:                strings.TrimSpace(tx.Amt.InstdAmt.Value),
+				Currency:              tx.Amt.InstdAmt.Ccy,
+				CreditorAccount:       toAccountReference(tx.CdtrAcct),
+				RemittanceInformation: tx.RmtInf.Ustrd,
+			})
+		}
+		result.Payments = append(result.Payments, payment)
+	}
+	return result, nil
+}
+
+// Transfers counts the credit transfers of the file
+func (p *PaymentInitiation) Transfers() int {
+	count := 0
+	for _, payment := range p.Payments {
+		count += len(payment.Transfers)
+	}
+	return count
+}
+
+func toAccountReference(identity accountIdentity) AccountReference {
+	return AccountReference{
+		IBAN:  strings.TrimSpace(identity.ID.IBAN),
+		Other: strings.TrimSpace(identity.ID.Othr.ID),
+	}
+}
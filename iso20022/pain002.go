@@ -0,0 +1,222 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"github.com/joomcode/errorx"
+
+	"transfers/util"
+)
+
+// Statuses of payments, and of the groups and files that they are in
+const (
+	StatusAccepted          = "ACSC"
+	StatusRejected          = "RJCT"
+	StatusPartiallyAccepted = "PART"
+)
+
+// Reasons that payments, or whole files, are rejected for
+const (
+	ReasonIncorrectAccountNumber      = "AC01"
+	ReasonBlockedAccount              = "AC06"
+	ReasonTransactionForbidden        = "AG01"
+	ReasonInsufficientFunds           = "AM04"
+	ReasonInvalidControlSum           = "AM10"
+	ReasonInvalidCurrency             = "AM11"
+	ReasonInvalidAmount               = "AM12"
+	ReasonInvalidNumberOfTransactions = "AM18"
+	ReasonExecutionDateInFuture       = "CH03"
+	ReasonInvalidDate                 = "DT01"
+	ReasonDuplicateMessageID          = "DU01"
+	ReasonNotSpecified                = "MS03"
+	ReasonNarrative                   = "NARR"
+)
+
+const max105Text = 105
+
+// StatusReport is a pain.002 customer payment status report, which answers a pain.001 file
+type StatusReport struct {
+	MessageID string
+	CreatedAt time.Time
+	// The file reported on
+	Original *PaymentInitiation
+	// Why the whole file was rejected, in which case none of its payments were made or are reported
+	Reason   *StatusReason
+	Payments []*PaymentStatus
+}
+
+// PaymentStatus reports on the credit transfers of a payment information block, in the order of the file
+type PaymentStatus struct {
+	OriginalPaymentInformationID string
+	Transfers                    []*TransferStatus
+}
+
+type TransferStatus struct {
+	OriginalInstructionID string
+	OriginalEndToEndID    string
+	Status                string
+	// Why the transfer was rejected
+	Reason *StatusReason
+	// Transaction that made an accepted transfer
+	TransactionID int64
+}
+
+type StatusReason struct {
+	Code                  string
+	AdditionalInformation string
+}
+
+type pain002Document struct {
+	XMLName        xml.Name             `xml:"urn:iso:std:iso:20022:tech:xsd:pain.002.001.10 Document"`
+	CstmrPmtStsRpt customerStatusReport `xml:"CstmrPmtStsRpt"`
+}
+
+type customerStatusReport struct {
+	GrpHdr            groupHeader           `xml:"GrpHdr"`
+	OrgnlGrpInfAndSts originalGroupStatus   `xml:"OrgnlGrpInfAndSts"`
+	OrgnlPmtInfAndSts []originalPaymentInfo `xml:"OrgnlPmtInfAndSts"`
+}
+
+type originalGroupStatus struct {
+	OrgnlMsgID    string            `xml:"OrgnlMsgId"`
+	OrgnlMsgNmID  string            `xml:"OrgnlMsgNmId"`
+	OrgnlNbOfTxs  string            `xml:"OrgnlNbOfTxs,omitempty"`
+	OrgnlCtrlSum  string            `xml:"OrgnlCtrlSum,omitempty"`
+	GrpSts        string            `xml:"GrpSts"`
+	StsRsnInf     *statusReasonInfo `xml:"StsRsnInf"`
+	NbOfTxsPerSts []countPerStatus  `xml:"NbOfTxsPerSts"`
+}
+
+type originalPaymentInfo struct {
+	OrgnlPmtInfID string              `xml:"OrgnlPmtInfId"`
+	OrgnlNbOfTxs  string              `xml:"OrgnlNbOfTxs"`
+	PmtInfSts     string              `xml:"PmtInfSts"`
+	NbOfTxsPerSts []countPerStatus    `xml:"NbOfTxsPerSts"`
+	TxInfAndSts   []transactionStatus `xml:"TxInfAndSts"`
+}
+
+type transactionStatus struct {
+	OrgnlInstrID    string            `xml:"OrgnlInstrId,omitempty"`
+	OrgnlEndToEndID string            `xml:"OrgnlEndToEndId,omitempty"`
+	TxSts           string            `xml:"TxSts"`
+	StsRsnInf       *statusReasonInfo `xml:"StsRsnInf"`
+	AcctSvcrRef     string            `xml:"AcctSvcrRef,omitempty"`
+}
+
+type statusReasonInfo struct {
+	Rsn      code     `xml:"Rsn"`
+	AddtlInf []string `xml:"AddtlInf"`
+}
+
+type countPerStatus struct {
+	DtldNbOfTxs string `xml:"DtldNbOfTxs"`
+	DtldSts     string `xml:"DtldSts"`
+}
+
+/*
+MarshalStatusReport renders a status report as a pain.002 document. The status of each payment information block and
+of the file follow from the statuses of their transfers: accepted or rejected when they all are, partially accepted
+otherwise, with the number of transfers in each status.
+*/
+func MarshalStatusReport(r *StatusReport) ([]byte, error) {
+	group := originalGroupStatus{
+		OrgnlMsgID:   r.Original.MessageID,
+		OrgnlMsgNmID: r.Original.MessageNameID,
+		OrgnlNbOfTxs: r.Original.NumberOfTransactions,
+		OrgnlCtrlSum: r.Original.ControlSum,
+	}
+	report := customerStatusReport{
+		GrpHdr: groupHeader{MsgID: r.MessageID, CreDtTm: formatTime(r.CreatedAt)},
+	}
+	if r.Reason != nil {
+		group.GrpSts = StatusRejected
+		group.StsRsnInf = toStatusReasonInfo(r.Reason)
+		report.OrgnlGrpInfAndSts = group
+		return marshal(r.MessageID, &pain002Document{CstmrPmtStsRpt: report})
+	}
+
+	counts := map[string]int{}
+	for _, payment := range r.Payments {
+		info := originalPaymentInfo{
+			OrgnlPmtInfID: payment.OriginalPaymentInformationID,
+			OrgnlNbOfTxs:  strconv.Itoa(len(payment.Transfers)),
+		}
+		paymentCounts := map[string]int{}
+		for _, transfer := range payment.Transfers {
+			status := transactionStatus{
+				OrgnlInstrID:    transfer.OriginalInstructionID,
+				OrgnlEndToEndID: transfer.OriginalEndToEndID,
+				TxSts:           transfer.Status,
+			}
+			if transfer.Reason != nil {
+				status.StsRsnInf = toStatusReasonInfo(transfer.Reason)
+			}
+			if transfer.TransactionID != 0 {
+				status.AcctSvcrRef = strconv.FormatInt(transfer.TransactionID, 10)
+			}
+			info.TxInfAndSts = append(info.TxInfAndSts, status)
+			paymentCounts[transfer.Status]++
+			counts[transfer.Status]++
+		}
+		info.PmtInfSts, info.NbOfTxsPerSts = summarize(paymentCounts)
+		report.OrgnlPmtInfAndSts = append(report.OrgnlPmtInfAndSts, info)
+	}
+	group.GrpSts, group.NbOfTxsPerSts = summarize(counts)
+	report.OrgnlGrpInfAndSts = group
+	return marshal(r.MessageID, &pain002Document{CstmrPmtStsRpt: report})
+}
+
+/*
+ReasonFor maps the error that a transfer was rejected with to the reason of its status. Errors without a reason code of
+their own are given as narrative, and server errors as not specified, with the error in the additional information.
+*/
+func ReasonFor(err error) *StatusReason {
+	var reason string
+	switch {
+	case errorx.IsOfType(err, util.ErrAccountNotFound), errorx.IsOfType(err, util.ErrInvalidAccountNumber):
+		reason = ReasonIncorrectAccountNumber
+	case errorx.IsOfType(err, util.ErrAccountNotActive):
+		reason = ReasonBlockedAccount
+	case errorx.IsOfType(err, util.ErrSameAccount):
+		reason = ReasonTransactionForbidden
+	case errorx.IsOfType(err, util.ErrInsufficientBalance):
+		reason = ReasonInsufficientFunds
+	case errorx.IsOfType(err, util.ErrCurrencyMismatch):
+		reason = ReasonInvalidCurrency
+	case errorx.IsOfType(err, util.ErrInvalidAmount):
+		reason = ReasonInvalidAmount
+	case errorx.IsOfType(err, errorx.ExternalError), errorx.HasTrait(err, errorx.Temporary()):
+		reason = ReasonNotSpecified
+	default:
+		reason = ReasonNarrative
+	}
+	return &StatusReason{Code: reason, AdditionalInformation: err.Error()}
+}
+
+func toStatusReasonInfo(reason *StatusReason) *statusReasonInfo {
+	info := &statusReasonInfo{Rsn: code{Cd: reason.Code}}
+	if reason.AdditionalInformation != "" {
+		info.AddtlInf = split(reason.AdditionalInformation, max105Text)
+	}
+	return info
+}
+
+// summarize gives the status of a group of transfers from the number of its transfers in each status
+func summarize(counts map[string]int) (string, []countPerStatus) {
+	var perStatus []countPerStatus
+	for _, status := range []string{StatusAccepted, StatusRejected} {
+		if counts[status] > 0 {
+			perStatus = append(perStatus, countPerStatus{DtldNbOfTxs: strconv.Itoa(counts[status]), DtldSts: status})
+		}
+	}
+	switch {
+	case counts[StatusRejected] == 0:
+		return StatusAccepted, perStatus
+	case counts[StatusAccepted] == 0:
+		return StatusRejected, perStatus
+	default:
+		return StatusPartiallyAccepted, perStatus
+	}
+}
@@ -0,0 +1,130 @@
+package iso20022
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+
+	"transfers/util"
+)
+
+func TestParsePaymentInitiation(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "pain001.xml"))
+	require.NoError(t, err)
+	file, err := ParsePaymentInitiation(data)
+	require.NoError(t, err)
+	require.Equal(t, "pain.001.001.09", file.MessageNameID)
+	require.Equal(t, "TREASURY-2024-03-01", file.MessageID)
+	require.Equal(t, "4", file.NumberOfTransactions)
+	require.Equal(t, "1035.50", file.ControlSum)
+	require.Equal(t, 4, file.Transfers())
+	require.Len(t, file.Payments, 2)
+
+	payroll := file.Payments[0]
+	require.Equal(t, "PAYROLL", payroll.ID)
+	require.Equal(t, "2024-03-01", payroll.RequestedExecutionDate)
+	require.Equal(t, AccountReference{Other: "00000000018"}, payroll.DebtorAccount)
+	require.Equal(t, &CreditTransfer{
+		InstructionID:         "1",
+		EndToEndID:            "salary-2024-03-alice",
+		Amount:                "1000.00",
+		Currency:              "USD",
+		CreditorAccount:       AccountReference{Other: "00000000026"},
+		RemittanceInformation: []string{"Salary March", "2024"},
+	}, payroll.Transfers[0])
+	require.Equal(t, AccountReference{IBAN: "DE89370400440532013000"}, file.Payments[1].DebtorAccount)
+
+	// Before version 08, the requested execution date is a date of its own
+	file, err = ParsePaymentInitiation([]byte(`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"><CstmrCdtTrfInitn>
+		<GrpHdr><MsgId>M</MsgId></GrpHdr><PmtInf><ReqdExctnDt>2024-03-05</ReqdExctnDt></PmtInf>
+	</CstmrCdtTrfInitn></Document>`))
+	require.NoError(t, err)
+	require.Equal(t, "2024-03-05", file.Payments[0].RequestedExecutionDate)
+
+	for _, invalid := range []string{
+		"",
+		"<Document>",
+		`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"><BkToCstmrStmt/></Document>`,
+		`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"><CstmrCdtTrfInitn/></Document>`,
+	} {
+		_, err = ParsePaymentInitiation([]byte(invalid))
+		require.True(t, errorx.IsOfType(err, errorx.IllegalArgument), "%q: %v", invalid, err)
+	}
+}
+
+func TestMarshalStatusReport(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "pain001.xml"))
+	require.NoError(t, err)
+	file, err := ParsePaymentInitiation(data)
+	require.NoError(t, err)
+
+	out, err := MarshalStatusReport(&StatusReport{
+		MessageID: "PSR1709280000",
+		CreatedAt: createdAt,
+		Original:  file,
+		Payments: []*PaymentStatus{
+			{
+				OriginalPaymentInformationID: "PAYROLL",
+				Transfers: []*TransferStatus{
+					{OriginalInstructionID: "1", OriginalEndToEndID: "salary-2024-03-alice", Status: StatusAccepted, TransactionID: 41},
+					{OriginalInstructionID: "2", OriginalEndToEndID: "NOTPROVIDED", Status: StatusRejected, Reason: ReasonFor(util.NewInvalidAccountNumberError("00000000019"))},
+					{OriginalInstructionID: "3", OriginalEndToEndID: "bonus-2024-03-carol", Status: StatusRejected, Reason: ReasonFor(util.NewInsufficientBalanceError())},
+				},
+			},
+			{
+				OriginalPaymentInformationID: "SUPPLIERS",
+				Transfers: []*TransferStatus{
+					{OriginalEndToEndID: "inv-881", Status: StatusRejected, Reason: ReasonFor(util.NewInvalidAccountNumberError("DE89370400440532013000"))},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	requireGolden(t, "pain002.xml", out)
+
+	out, err = MarshalStatusReport(&StatusReport{
+		MessageID: "PSR1709280001",
+		CreatedAt: createdAt,
+		Original:  file,
+		Reason:    &StatusReason{Code: ReasonInvalidControlSum, AdditionalInformation: "CtrlSum is \"1035.50\", but the amounts of the file add up to 1035.5"},
+	})
+	require.NoError(t, err)
+	requireGolden(t, "pain002_rejected.xml", out)
+}
+
+func TestReasonFor(t *testing.T) {
+	testCases := []struct {
+		err  error
+		code string
+	}{
+		{util.NewAccountNotFoundError(1), ReasonIncorrectAccountNumber},
+		{util.NewInvalidAccountNumberError("1"), ReasonIncorrectAccountNumber},
+		{util.NewAccountNotActiveError(1, "frozen"), ReasonBlockedAccount},
+		{util.NewTransactionToSameAccountError(1), ReasonTransactionForbidden},
+		{util.NewInsufficientBalanceError(), ReasonInsufficientFunds},
+		{util.NewAccountCurrencyMismatchError(1, "EUR", "USD"), ReasonInvalidCurrency},
+		{util.NewCurrencyMismatchError("USD", "JPY"), ReasonInvalidCurrency},
+		{util.NewInvalidAmountError("0"), ReasonInvalidAmount},
+		{util.NewInvalidPrecisionError("1.001", "USD", 2), ReasonInvalidAmount},
+		{util.NewBatchTransferError(2, util.NewInsufficientBalanceError()), ReasonInsufficientFunds},
+		{util.NewDBError(errorx.IllegalState.New("connection lost")), ReasonNotSpecified},
+		{util.NewTransactionConflictError(errorx.IllegalState.New("deadlock")), ReasonNotSpecified},
+		{util.NewInvalidMetadataError(), ReasonNarrative},
+	}
+	for _, tc := range testCases {
+		reason := ReasonFor(tc.err)
+		require.Equal(t, tc.code, reason.Code, tc.err.Error())
+		require.Equal(t, tc.err.Error(), reason.AdditionalInformation)
+	}
+}
+
+func TestStatusReasonAdditionalInformation(t *testing.T) {
+	info := toStatusReasonInfo(&StatusReason{Code: ReasonNarrative, AdditionalInformation: strings.Repeat("a", 200)})
+	require.Len(t, info.AddtlInf, 2)
+	require.Len(t, info.AddtlInf[0], max105Text)
+	require.Empty(t, toStatusReasonInfo(&StatusReason{Code: ReasonNotSpecified}).AddtlInf)
+}
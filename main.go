@@ -4,26 +4,23 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/spf13/viper"
 
 	"transfers/api"
 	db "transfers/db/sqlc"
+	"transfers/service"
+	"transfers/util"
 )
 
 func main() {
-	viper.AddConfigPath(".")
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	err := viper.ReadInConfig()
+	config, err := util.LoadConfig(".")
 	if err != nil {
 		panic(fmt.Errorf("fatal error config file: %s", err))
 	}
-	dbSource := viper.GetString("dbSource")
-	serverAddress := viper.GetString("serverAddress")
-	
-	poolConfig, err := pgxpool.ParseConfig(dbSource)
+
+	poolConfig, err := pgxpool.ParseConfig(config.DBSource)
 	if err != nil {
 		log.Fatalln("Unable to parse dbSource:", err)
 	}
@@ -33,8 +30,40 @@ func main() {
 	}
 	defer pool.Close()
 	store := db.NewPgxStore(pool)
-	server := api.NewServer(store)
-	err = server.Run(serverAddress)
+	if len(os.Args) > 1 {
+		if err = runCommand(context.Background(), config, store, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if config.FxRatesFile != "" {
+		count, err := service.LoadFxRates(context.Background(), store, config.FxRatesFile)
+		if err != nil {
+			log.Fatalln("Unable to load fx rates:", err)
+		}
+		log.Printf("Published %d new fx rates from %s", count, config.FxRatesFile)
+	}
+	go service.ExpireHolds(context.Background(), store, config.HoldExpiryInterval)
+	rounding, err := util.ParseRoundingMode(config.FxRounding)
+	if err != nil {
+		log.Fatalln("Unable to parse fxRounding:", err)
+	}
+	scheduler := &service.TransferScheduler{
+		Store:    store,
+		Rounding: rounding,
+		Policy:   config.ScheduledTransferRetryPolicy,
+	}
+	go scheduler.Run(context.Background(), config.ScheduledTransferInterval)
+	if config.AdminAddress != "" {
+		go func() {
+			log.Fatalln("Err when running admin server:", api.RunAdmin(config.AdminAddress))
+		}()
+	}
+	server, err := api.NewServer(config, store)
+	if err != nil {
+		log.Fatalln("Unable to create server:", err)
+	}
+	err = server.Run(config.ServerAddress)
 	if err != nil {
 		log.Fatal("Err when running server:", err)
 	}
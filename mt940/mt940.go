@@ -0,0 +1,237 @@
+/*
+Package mt940 renders account statements as SWIFT MT940 customer statements, for the accounting tools that only import
+them. A statement is the text block of the message: its fields in the SWIFT x character set, one line each with CRLF
+line endings, and a line of "-" at the end.
+*/
+package mt940
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"transfers/util"
+)
+
+const (
+	credit = "C"
+	debit  = "D"
+	// Transaction type of the transfers between accounts of the system: a non-SWIFT transfer
+	transfer = "NTRF"
+	// Given in place of the reference of the account owner by entries that have none
+	noReference = "NONREF"
+
+	maxReference = 16
+	// Most characters of an amount, including its decimal comma
+	maxAmount = 15
+	// Lines and line length of the information to account owner
+	maxInformationLines = 6
+	maxLine             = 65
+
+	lineEnd = "\r\n"
+)
+
+// Account is the account that a statement reports on
+type Account struct {
+	ID       int64
+	Currency string
+}
+
+// Entry is a movement of an account, made by a transaction
+type Entry struct {
+	TransactionID int64
+	// Negative for debits, positive for credits, in the currency of the account
+	Amount   util.Money
+	BookedAt time.Time
+	// Account that the money went to or came from, if there is a single one
+	CounterpartyAccountID int64
+	Description           string
+	// Reference of the transaction in the client's system, if any
+	ExternalReference string
+}
+
+// Statement is the activity of an account over a period, from its balance at the start of the period
+type Statement struct {
+	// Identifies the statement in at most 16 characters
+	Reference string
+	Account   Account
+	From      time.Time
+	To        time.Time
+	// Balance before the first entry of the period
+	OpeningBalance util.Money
+	// Oldest first
+	Entries []*Entry
+}
+
+/*
+MarshalStatement renders a statement as an MT940 message. Amounts are rounded to the decimal places of the currency of
+the account with util.BalanceRounding, so that the entries add up to the closing balance, and the residual that
+rounding leaves out of the closing balance, if any, is reported in the information to account owner of the statement.
+Balances are dated the last day they cover, and the statement is numbered with the day of the year of its closing
+balance. Text that MT940 cannot carry is replaced with spaces.
+*/
+func MarshalStatement(s *Statement) ([]byte, error) {
+	if s.Reference == "" || len(s.Reference) > maxReference || text(s.Reference) != s.Reference {
+		return nil, util.NewInvalidMessageIDError(s.Reference, maxReference)
+	}
+	currency := s.Account.Currency
+	rounding, err := util.NewBalanceRounding(currency, s.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+	closingDate := balanceDate(s.To)
+
+	var b strings.Builder
+	field(&b, "20", s.Reference)
+	field(&b, "25", util.AccountNumber(s.Account.ID))
+	field(&b, "28C", fmt.Sprintf("%05d/001", closingDate.YearDay()))
+	opening, err := toBalance(rounding.Balance(), balanceDate(s.From), currency)
+	if err != nil {
+		return nil, err
+	}
+	field(&b, "60F", opening)
+	for _, e := range s.Entries {
+		amount, err := rounding.Add(e.Amount)
+		if err != nil {
+			return nil, err
+		}
+		line, err := toStatementLine(e, amount)
+		if err != nil {
+			return nil, err
+		}
+		field(&b, "61", line)
+		if information := toInformation(e); information != "" {
+			field(&b, "86", information)
+		}
+	}
+	closing, err := toBalance(rounding.Balance(), closingDate, currency)
+	if err != nil {
+		return nil, err
+	}
+	field(&b, "62F", closing)
+	if residual := rounding.Residual(); !residual.IsZero() {
+		field(&b, "86", "ROUNDING RESIDUAL "+currency+" "+strings.Replace(residual.String(), ".", ",", 1))
+	}
+	b.WriteString("-" + lineEnd)
+	return []byte(b.String()), nil
+}
+
+// toStatementLine renders the statement line of an entry, with its rounded amount
+func toStatementLine(e *Entry, amount util.Money) (string, error) {
+	// The mark follows the entry, whose amount may round to zero
+	mark := credit
+	if e.Amount.Sign() < 0 {
+		mark, amount = debit, amount.Neg()
+	}
+	value, err := toAmount(amount)
+	if err != nil {
+		return "", err
+	}
+	date := e.BookedAt.UTC()
+	line := date.Format("060102") + date.Format("0102") + mark + value + transfer + ownerReference(e.ExternalReference)
+	if ref := strconv.FormatInt(e.TransactionID, 10); len(ref) <= maxReference {
+		line += "//" + ref
+	}
+	return line, nil
+}
+
+// toInformation renders the information to account owner of an entry: its description, counterparty and a reference
+// too long for the statement line
+func toInformation(e *Entry) string {
+	var parts []string
+	if e.Description != "" {
+		parts = append(parts, e.Description)
+	}
+	if e.CounterpartyAccountID != 0 {
+		parts = append(parts, "ACCOUNT "+util.AccountNumber(e.CounterpartyAccountID))
+	}
+	if ownerReference(e.ExternalReference) == noReference && e.ExternalReference != "" {
+		parts = append(parts, "REF "+e.ExternalReference)
+	}
+	var lines []string
+	for _, part := range parts {
+		lines = append(lines, wrap(strings.TrimSpace(text(part)), maxLine)...)
+	}
+	if len(lines) > maxInformationLines {
+		lines = lines[:maxInformationLines]
+	}
+	return strings.Join(lines, lineEnd)
+}
+
+// ownerReference is the external reference of an entry, if the statement line can carry it as it is
+func ownerReference(ref string) string {
+	if ref == "" || len(ref) > maxReference || text(ref) != ref {
+		return noReference
+	}
+	return ref
+}
+
+// toBalance renders a balance with its debit/credit mark, date and currency
+func toBalance(m util.Money, date time.Time, currency string) (string, error) {
+	mark := credit
+	if m.Sign() < 0 {
+		mark, m = debit, m.Neg()
+	}
+	value, err := toAmount(m)
+	if err != nil {
+		return "", err
+	}
+	return mark + date.Format("060102") + currency + value, nil
+}
+
+// toAmount renders the magnitude of a rounded amount with a decimal comma, which is kept even without decimal places
+func toAmount(m util.Money) (string, error) {
+	value := strings.Replace(m.String(), ".", ",", 1)
+	if !strings.Contains(value, ",") {
+		value += ","
+	}
+	if len(value) > maxAmount {
+		return "", util.NewAmountOverflowError(m.String())
+	}
+	return value, nil
+}
+
+// balanceDate is the last day that a balance at t covers, since a balance at midnight closes the day before
+func balanceDate(t time.Time) time.Time {
+	return t.UTC().Add(-time.Nanosecond)
+}
+
+func field(b *strings.Builder, tag string, value string) {
+	b.WriteString(":" + tag + ":" + value + lineEnd)
+}
+
+// text replaces the characters outside the SWIFT x character set with spaces
+func text(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			return r
+		default:
+			return ' '
+		}
+	}, s)
+}
+
+// wrap cuts x character set text into lines of at most max characters. A line that would start with ':' or '-'
+// starts with a space instead, so that it cannot be read as the start of a field or the end of the message.
+func wrap(s string, max int) []string {
+	var lines []string
+	var line strings.Builder
+	for _, r := range s {
+		if line.Len() == 0 && (r == ':' || r == '-') {
+			line.WriteRune(' ')
+		}
+		line.WriteRune(r)
+		if line.Len() == max {
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+	}
+	if line.Len() > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
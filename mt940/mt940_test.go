@@ -0,0 +1,90 @@
+package mt940
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+
+	"transfers/util"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+	from    = time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)
+	to      = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	payroll = Account{ID: 1, Currency: "USD"}
+	entries = []*Entry{
+		{
+			TransactionID:         7,
+			Amount:                util.MustParseMoney("-2.50000"),
+			BookedAt:              time.Date(2024, 2, 29, 9, 30, 0, 0, time.UTC),
+			CounterpartyAccountID: 2,
+			Description:           "March rent & <utilities>",
+			ExternalReference:     "inv-2024-03",
+		},
+		{
+			TransactionID:         8,
+			Amount:                util.MustParseMoney("1.00400"),
+			BookedAt:              time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC),
+			CounterpartyAccountID: 3,
+			Description:           "-" + strings.Repeat("x", 150),
+			ExternalReference:     strings.Repeat("r", 20),
+		},
+		{
+			TransactionID: 9,
+			Amount:        util.MustParseMoney("-0.00300"),
+			BookedAt:      time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC),
+		},
+	}
+)
+
+func TestMarshalStatement(t *testing.T) {
+	// 10.00400 - 2.5 + 1.004 - 0.003 closes on 8.50500, which rounds half to even to 8.50
+	out, err := MarshalStatement(&Statement{
+		Reference:      "STMT240301000000",
+		Account:        payroll,
+		From:           from,
+		To:             to,
+		OpeningBalance: util.MustParseMoney("10.00400"),
+		Entries:        entries,
+	})
+	require.NoError(t, err)
+	requireGolden(t, "statement.sta", out)
+
+	out, err = MarshalStatement(&Statement{
+		Reference:      "STMT240301000000",
+		Account:        Account{ID: 4, Currency: "JPY"},
+		From:           from,
+		To:             to,
+		OpeningBalance: util.MustParseMoney("-1000.00000"),
+	})
+	require.NoError(t, err)
+	requireGolden(t, "statement_empty.sta", out)
+
+	for _, reference := range []string{"", strings.Repeat("S", 17), "STMT_1"} {
+		_, err = MarshalStatement(&Statement{Reference: reference, Account: payroll})
+		require.True(t, errorx.IsOfType(err, errorx.IllegalArgument), err)
+	}
+	_, err = MarshalStatement(&Statement{Reference: "STMT1", Account: Account{ID: 1, Currency: "XYZ"}})
+	require.True(t, errorx.IsOfType(err, errorx.IllegalArgument), err)
+	_, err = MarshalStatement(&Statement{Reference: "STMT1", Account: payroll, OpeningBalance: util.MustParseMoney("1000000000000")})
+	require.True(t, errorx.IsOfType(err, util.ErrInvalidAmount), err)
+}
+
+// requireGolden compares out with the golden file of name, which -update rewrites instead
+func requireGolden(t *testing.T, name string, out []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.WriteFile(path, out, 0o644))
+	}
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(golden), string(out))
+}
@@ -0,0 +1,240 @@
+/*
+Package ofx renders account statements as OFX 2.2 bank statement responses, for the accounting tools that only import
+them. Accounts are identified by their account numbers, at the bank BankID.
+*/
+package ofx
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"transfers/util"
+)
+
+// BankID identifies the system as the bank of its accounts
+const BankID = "TRANSFERS"
+
+const header = `<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n"
+
+const (
+	checking   = "CHECKING"
+	creditLine = "CREDITLINE"
+	credit     = "CREDIT"
+	debit      = "DEBIT"
+	// Type of the balances in a balance list that are amounts of money
+	dollar = "DOLLAR"
+
+	maxTransactionUID = 36
+	maxRefNum         = 32
+	maxMemo           = 255
+)
+
+// Account is the account that a statement reports on
+type Account struct {
+	ID       int64
+	Currency string
+	// Whether the account is a credit line rather than a checking account
+	CreditLine bool
+}
+
+// Entry is a movement of an account, made by a transaction
+type Entry struct {
+	TransactionID int64
+	// Negative for debits, positive for credits, in the currency of the account
+	Amount   util.Money
+	BookedAt time.Time
+	// Account that the money went to or came from, if there is a single one
+	CounterpartyAccountID int64
+	Description           string
+	// Reference of the transaction in the client's system, if any
+	ExternalReference string
+}
+
+// Statement is the activity of an account over a period, from its balance at the start of the period
+type Statement struct {
+	// Identifies the statement response in at most 36 characters
+	ID        string
+	CreatedAt time.Time
+	Account   Account
+	From      time.Time
+	To        time.Time
+	// Balance before the first entry of the period
+	OpeningBalance util.Money
+	// Oldest first
+	Entries []*Entry
+}
+
+type document struct {
+	XMLName      xml.Name     `xml:"OFX"`
+	SignOn       signOn       `xml:"SIGNONMSGSRSV1>SONRS"`
+	Transactions transactions `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type status struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+// ok is the status of a successful response
+var ok = status{Code: 0, Severity: "INFO"}
+
+type signOn struct {
+	Status   status `xml:"STATUS"`
+	DTServer string `xml:"DTSERVER"`
+	Language string `xml:"LANGUAGE"`
+}
+
+type transactions struct {
+	TrnUID    string            `xml:"TRNUID"`
+	Status    status            `xml:"STATUS"`
+	Statement statementResponse `xml:"STMTRS"`
+}
+
+type statementResponse struct {
+	CurDef       string          `xml:"CURDEF"`
+	BankAcctFrom bankAccount     `xml:"BANKACCTFROM"`
+	BankTranList transactionList `xml:"BANKTRANLIST"`
+	LedgerBal    balance         `xml:"LEDGERBAL"`
+	BalList      *balanceList    `xml:"BALLIST"`
+}
+
+type bankAccount struct {
+	BankID   string `xml:"BANKID"`
+	AcctID   string `xml:"ACCTID"`
+	AcctType string `xml:"ACCTTYPE"`
+}
+
+type transactionList struct {
+	DTStart string        `xml:"DTSTART"`
+	DTEnd   string        `xml:"DTEND"`
+	StmtTrn []transaction `xml:"STMTTRN"`
+}
+
+type transaction struct {
+	TrnType  string `xml:"TRNTYPE"`
+	DTPosted string `xml:"DTPOSTED"`
+	TrnAmt   string `xml:"TRNAMT"`
+	FITID    string `xml:"FITID"`
+	RefNum   string `xml:"REFNUM,omitempty"`
+	Name     string `xml:"NAME,omitempty"`
+	Memo     string `xml:"MEMO,omitempty"`
+}
+
+type balance struct {
+	BalAmt string `xml:"BALAMT"`
+	DTAsOf string `xml:"DTASOF"`
+}
+
+type balanceList struct {
+	Bal []namedBalance `xml:"BAL"`
+}
+
+type namedBalance struct {
+	Name    string `xml:"NAME"`
+	Desc    string `xml:"DESC"`
+	BalType string `xml:"BALTYPE"`
+	Value   string `xml:"VALUE"`
+	DTAsOf  string `xml:"DTASOF"`
+}
+
+/*
+MarshalStatement renders a statement as an OFX bank statement response. Amounts are rounded to the decimal places of
+the currency of the account with util.BalanceRounding, so that the transactions add up to the ledger balance, and the
+residual that rounding leaves out of the ledger balance, if any, is reported as a balance of the balance list.
+*/
+func MarshalStatement(s *Statement) ([]byte, error) {
+	if s.ID == "" || utf8.RuneCountInString(s.ID) > maxTransactionUID {
+		return nil, util.NewInvalidMessageIDError(s.ID, maxTransactionUID)
+	}
+	rounding, err := util.NewBalanceRounding(s.Account.Currency, s.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+	list := transactionList{
+		DTStart: formatTime(s.From),
+		DTEnd:   formatTime(s.To),
+		StmtTrn: make([]transaction, 0, len(s.Entries)),
+	}
+	for _, e := range s.Entries {
+		amount, err := rounding.Add(e.Amount)
+		if err != nil {
+			return nil, err
+		}
+		list.StmtTrn = append(list.StmtTrn, toTransaction(e, amount))
+	}
+
+	account := bankAccount{BankID: BankID, AcctID: util.AccountNumber(s.Account.ID), AcctType: checking}
+	if s.Account.CreditLine {
+		account.AcctType = creditLine
+	}
+	stmt := statementResponse{
+		CurDef:       s.Account.Currency,
+		BankAcctFrom: account,
+		BankTranList: list,
+		LedgerBal:    balance{BalAmt: rounding.Balance().String(), DTAsOf: formatTime(s.To)},
+	}
+	if residual := rounding.Residual(); !residual.IsZero() {
+		stmt.BalList = &balanceList{Bal: []namedBalance{{
+			Name:    "Rounding residual",
+			Desc:    "Part of the ledger balance left out by rounding",
+			BalType: dollar,
+			Value:   residual.String(),
+			DTAsOf:  formatTime(s.To),
+		}}}
+	}
+
+	out, err := xml.MarshalIndent(&document{
+		SignOn: signOn{Status: ok, DTServer: formatTime(s.CreatedAt), Language: "ENG"},
+		Transactions: transactions{
+			TrnUID:    s.ID,
+			Status:    ok,
+			Statement: stmt,
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header+header), append(out, '\n')...), nil
+}
+
+// toTransaction renders an entry as a statement transaction, with its rounded amount
+func toTransaction(e *Entry, amount util.Money) transaction {
+	id := strconv.FormatInt(e.TransactionID, 10)
+	result := transaction{
+		TrnType:  credit,
+		DTPosted: formatTime(e.BookedAt),
+		TrnAmt:   amount.String(),
+		FITID:    id,
+		Memo:     truncate(e.Description, maxMemo),
+	}
+	// The type follows the entry, whose amount may round to zero
+	if e.Amount.Sign() < 0 {
+		result.TrnType = debit
+	}
+	if e.CounterpartyAccountID != 0 {
+		result.Name = util.AccountNumber(e.CounterpartyAccountID)
+	}
+	// References too long for a reference number are still reported, in the memo
+	if utf8.RuneCountInString(e.ExternalReference) <= maxRefNum {
+		result.RefNum = e.ExternalReference
+	} else {
+		result.Memo = truncate(strings.TrimSpace(e.Description+" "+e.ExternalReference), maxMemo)
+	}
+	return result
+}
+
+// formatTime renders t in UTC, with milliseconds and the time zone as OFX dates have them
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+// truncate cuts text down to max characters
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max])
+}
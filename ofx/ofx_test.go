@@ -0,0 +1,89 @@
+package ofx
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+
+	"transfers/util"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+	createdAt = time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC)
+	from      = time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)
+	to        = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	payroll   = Account{ID: 1, Currency: "USD"}
+	entries   = []*Entry{
+		{
+			TransactionID:         7,
+			Amount:                util.MustParseMoney("-2.50000"),
+			BookedAt:              time.Date(2024, 2, 29, 9, 30, 0, 123456000, time.UTC),
+			CounterpartyAccountID: 2,
+			Description:           "March rent & <utilities>",
+			ExternalReference:     "inv-2024-03",
+		},
+		{
+			TransactionID:         8,
+			Amount:                util.MustParseMoney("1.00400"),
+			BookedAt:              time.Date(2024, 2, 29, 17, 0, 0, 0, time.UTC),
+			CounterpartyAccountID: 3,
+			Description:           "Refund",
+			ExternalReference:     strings.Repeat("r", 40),
+		},
+		{
+			TransactionID: 9,
+			Amount:        util.MustParseMoney("-0.00300"),
+			BookedAt:      time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC),
+		},
+	}
+)
+
+func TestMarshalStatement(t *testing.T) {
+	// 10.00400 - 2.5 + 1.004 - 0.003 closes on 8.50500, which rounds half to even to 8.50
+	out, err := MarshalStatement(&Statement{
+		ID:             "STMT1-1709251200",
+		CreatedAt:      createdAt,
+		Account:        payroll,
+		From:           from,
+		To:             to,
+		OpeningBalance: util.MustParseMoney("10.00400"),
+		Entries:        entries,
+	})
+	require.NoError(t, err)
+	requireGolden(t, "statement.ofx", out)
+
+	out, err = MarshalStatement(&Statement{
+		ID:             "STMT4-1709251200",
+		CreatedAt:      createdAt,
+		Account:        Account{ID: 4, Currency: "JPY", CreditLine: true},
+		From:           from,
+		To:             to,
+		OpeningBalance: util.MustParseMoney("-1000.00000"),
+	})
+	require.NoError(t, err)
+	requireGolden(t, "statement_empty.ofx", out)
+
+	_, err = MarshalStatement(&Statement{ID: strings.Repeat("S", 37), Account: payroll})
+	require.True(t, errorx.IsOfType(err, errorx.IllegalArgument), err)
+	_, err = MarshalStatement(&Statement{ID: "STMT1", Account: Account{ID: 1, Currency: "XYZ"}})
+	require.True(t, errorx.IsOfType(err, errorx.IllegalArgument), err)
+}
+
+// requireGolden compares out with the golden file of name, which -update rewrites instead
+func requireGolden(t *testing.T, name string, out []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.WriteFile(path, out, 0o644))
+	}
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(golden), string(out))
+}
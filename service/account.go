@@ -2,10 +2,15 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"log"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 
 	db "transfers/db/sqlc"
 	"transfers/util"
@@ -29,9 +34,239 @@ func (s *GetAccountService) Do(ctx context.Context, request *models.GetAccountRe
 		}
 		return nil, util.NewDBError(err)
 	}
+	return toGetAccountResponse(account)
+}
+
+type GetAccountByNumberService struct {
+	db.Store
+}
+
+func (s *GetAccountByNumberService) Validate(ctx context.Context, request *models.GetAccountByNumberRequest) error {
+	_, err := util.ParseAccountNumber(request.AccountNumber)
+	return err
+}
+
+func (s *GetAccountByNumberService) Do(ctx context.Context, request *models.GetAccountByNumberRequest) (*models.GetAccountResponse, error) {
+	id, err := util.ParseAccountNumber(request.AccountNumber)
+	if err != nil {
+		return nil, err
+	}
+	return (&GetAccountService{Store: s.Store}).Do(ctx, &models.GetAccountRequest{AccountID: id})
+}
+
+type UpdateAccountService struct {
+	db.Store
+}
+
+func (s *UpdateAccountService) Validate(ctx context.Context, request *models.UpdateAccountRequest) error {
+	for key, value := range request.Labels {
+		if value == nil {
+			continue // removed
+		}
+		if err := util.ValidateLabel(key, *value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Do changes the account in a single statement, so that concurrent updates of different fields or labels are all kept.
+Labels are merged into the existing ones, and those set to null are removed. With If-Match, the account is only changed
+if its version is one the header names, so that a change based on a stale read fails with 412 instead of overwriting
+a later change.
+*/
+func (s *UpdateAccountService) Do(ctx context.Context, request *models.UpdateAccountRequest) (*models.GetAccountResponse, error) {
+	labels := request.Labels
+	if labels == nil {
+		labels = map[string]*string{}
+	}
+	patch, err := json.Marshal(labels)
+	if err != nil {
+		return nil, err
+	}
+	param := &db.UpdateAccountMetadataParams{
+		ID:        request.AccountID,
+		Labels:    patch,
+		Versions:  ifMatchVersions(request.IfMatch),
+		MaxLabels: util.MaxLabels,
+	}
+	if request.DisplayName != nil {
+		param.DisplayName = pgtype.Text{String: *request.DisplayName, Valid: true}
+	}
+	if request.OwnerReference != nil {
+		param.OwnerReference = pgtype.Text{String: *request.OwnerReference, Valid: true}
+	}
+	account, err := s.UpdateAccountMetadata(ctx, param)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, s.notUpdated(ctx, param)
+		}
+		return nil, util.NewDBError(err)
+	}
+	return toGetAccountResponse(account)
+}
+
+// notUpdated finds out why an update changed no account: it does not exist, it has changed since the version that
+// If-Match names, or the update would leave it with too many labels
+func (s *UpdateAccountService) notUpdated(ctx context.Context, param *db.UpdateAccountMetadataParams) error {
+	account, err := s.GetAccount(ctx, param.ID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return util.NewAccountNotFoundError(param.ID)
+		}
+		return util.NewDBError(err)
+	}
+	if param.Versions != nil && !containsVersion(param.Versions, account.Version) {
+		current, err := toGetAccountResponse(account)
+		if err != nil {
+			return err
+		}
+		return util.NewPreconditionFailedError(current.ETag())
+	}
+	return util.NewTooManyLabelsError()
+}
+
+func containsVersion(versions []int64, version int64) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersions returns the account versions that an If-Match header names, or nil when it names any version. Weak
+// and malformed ETags never match, as If-Match uses strong comparison.
+func ifMatchVersions(header string) []int64 {
+	if header == "" {
+		return nil
+	}
+	versions := []int64{}
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" {
+			return nil
+		}
+		value, err := strconv.Unquote(etag)
+		if err != nil || !strings.HasPrefix(etag, `"`) {
+			continue
+		}
+		if version, err := strconv.ParseInt(value, 10, 64); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+type ListAccountsService struct {
+	db.Store
+}
+
+func (s *ListAccountsService) Validate(ctx context.Context, request *models.ListAccountsRequest) error {
+	if request.Cursor != "" {
+		if _, err := util.DecodeCursor(request.Cursor); err != nil {
+			return err
+		}
+	}
+	_, err := labelSelectors(request.Labels)
+	return err
+}
+
+// Do returns a page of the accounts matching the owner and all the labels, newest first
+func (s *ListAccountsService) Do(ctx context.Context, request *models.ListAccountsRequest) (*models.ListAccountsResponse, error) {
+	labels, err := labelSelectors(request.Labels)
+	if err != nil {
+		return nil, err
+	}
+	param := &db.ListAccountsParams{
+		OwnerReference: request.Owner,
+		Labels:         labels,
+		BeforeID:       math.MaxInt64,
+		PageSize:       defaultPageSize,
+	}
+	if request.Cursor != "" {
+		param.BeforeID, _ = util.DecodeCursor(request.Cursor)
+	}
+	if request.Limit > 0 {
+		param.PageSize = request.Limit
+	}
+	pageSize := param.PageSize
+	param.PageSize++ // fetch one extra row to know whether there is a next page
+
+	accounts, err := s.ListAccounts(ctx, param)
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	resp := &models.ListAccountsResponse{
+		Accounts: make([]*models.GetAccountResponse, 0, len(accounts)),
+	}
+	if len(accounts) > int(pageSize) {
+		accounts = accounts[:pageSize]
+		resp.NextCursor = util.EncodeCursor(accounts[pageSize-1].ID)
+	}
+	for _, account := range accounts {
+		account, err := toGetAccountResponse(account)
+		if err != nil {
+			return nil, err
+		}
+		resp.Accounts = append(resp.Accounts, account)
+	}
+	return resp, nil
+}
+
+// labelSelectors returns the labels that accounts must have to match all the key:value selectors
+func labelSelectors(selectors []string) (util.Labels, error) {
+	labels := util.Labels{}
+	for _, selector := range selectors {
+		key, value, err := util.ParseLabelSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := labels[key]; ok && other != value {
+			return nil, util.NewInvalidLabelSelectorError(selector) // no account has both values
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// UpdateAccountStatusService freezes, unfreezes or closes an account, depending on Status
+type UpdateAccountStatusService struct {
+	db.Store
+	Status string
+}
+
+func (s *UpdateAccountStatusService) Validate(ctx context.Context, request *models.UpdateAccountStatusRequest) error {
+	return nil
+}
+
+func (s *UpdateAccountStatusService) Do(ctx context.Context, request *models.UpdateAccountStatusRequest) (*models.GetAccountResponse, error) {
+	account, err := s.SetAccountStatus(ctx, request.AccountID, s.Status)
+	if err != nil {
+		return nil, err
+	}
+	return toGetAccountResponse(account)
+}
+
+func toGetAccountResponse(account *db.Account) (*models.GetAccountResponse, error) {
+	available, err := account.AvailableBalance()
+	if err != nil {
+		return nil, err
+	}
 	return &models.GetAccountResponse{
-		AccountID: account.ID,
-		Balance:   account.Balance,
+		AccountID:        account.ID,
+		AccountNumber:    util.AccountNumber(account.ID),
+		Balance:          util.CurrencyAmount(account.Balance, account.Currency),
+		AvailableBalance: util.CurrencyAmount(available, account.Currency),
+		Currency:         account.Currency,
+		Status:           account.Status,
+		Type:             account.Type,
+		BalanceFloor:     currencyFloor(account),
+		DisplayName:      account.DisplayName,
+		OwnerReference:   account.OwnerReference,
+		Labels:           account.Labels,
+		Version:          account.Version,
 	}, nil
 }
 
@@ -43,36 +278,114 @@ func (s *CreateAccountService) Validate(ctx context.Context, request *models.Cre
 	if request.AccountID < 0 {
 		return util.NewInvalidIDError(request.AccountID)
 	}
-	balance, err := util.StringToAmount(request.InitialBalance)
+	log.Printf("balance: %v", request.InitialBalance)
+	if request.Type == "" {
+		request.Type = db.AccountCash
+	}
+	if (request.Type == db.AccountCredit) != (request.CreditLimit != nil) {
+		return util.NewInvalidCreditLimitError(request.Type)
+	}
+	if request.Currency == "" {
+		request.Currency = util.DefaultCurrency
+	}
+	currency, err := util.LookupCurrency(request.Currency)
 	if err != nil {
 		return err
 	}
-	log.Printf("balance: %v", balance.FloatString(5))
-	if balance.Sign() == -1 {
-		return util.NewNegativeBalanceError(request.InitialBalance)
+	if err = currency.ValidateAmount(*request.InitialBalance); err != nil {
+		return err
 	}
-	request.InitialBalance = util.AmountToString(balance)
-	_, err = s.GetAccount(ctx, request.AccountID)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil // no existing account
+	balance := request.InitialBalance.Rescale(util.MoneyScale, util.RoundDown)
+	request.InitialBalance = &balance
+	if request.CreditLimit != nil {
+		if request.CreditLimit.Sign() < 0 {
+			return util.NewInvalidAmountError(request.CreditLimit.String())
+		}
+		if err = currency.ValidateAmount(*request.CreditLimit); err != nil {
+			return err
+		}
+		limit := request.CreditLimit.Rescale(util.MoneyScale, util.RoundDown)
+		request.CreditLimit = &limit
 	}
-	if err != nil {
-		return util.NewDBError(err)
+	if floor := balanceFloor(request); floor != nil && balance.Cmp(*floor) < 0 {
+		if floor.IsZero() {
+			return util.NewNegativeBalanceError(balance.String())
+		}
+		return util.NewBalanceBelowFloorError(balance.String(), floor.String())
 	}
-	return util.NewAccountAlreadyExistsError(request.AccountID)
+	for key, value := range request.Labels {
+		if err = util.ValidateLabel(key, value); err != nil {
+			return err
+		}
+	}
+	// An existing account is only detected when creating it, as a concurrent request could create it after a check
+	return nil
 }
 
 func (s *CreateAccountService) Do(ctx context.Context, request *models.CreateAccountRequest) (*models.CreateAccountResponse, error) {
+	if request.AccountID == 0 {
+		account, err := s.AllocateAccount(ctx, &db.CreateAccountWithNextIDParams{
+			Balance:        *request.InitialBalance,
+			Currency:       request.Currency,
+			Type:           request.Type,
+			BalanceFloor:   balanceFloor(request),
+			DisplayName:    request.DisplayName,
+			OwnerReference: request.OwnerReference,
+			Labels:         request.Labels,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return toCreateAccountResponse(account), nil
+	}
 	account, err := s.CreateAccount(ctx, &db.CreateAccountParams{
-		ID:      request.AccountID,
-		Balance: request.InitialBalance,
+		ID:             request.AccountID,
+		Balance:        *request.InitialBalance,
+		Currency:       request.Currency,
+		Type:           request.Type,
+		BalanceFloor:   balanceFloor(request),
+		DisplayName:    request.DisplayName,
+		OwnerReference: request.OwnerReference,
+		Labels:         request.Labels,
 	})
 	if err != nil {
-		return nil, util.NewDBError(err)
+		return nil, err
 	}
+	return toCreateAccountResponse(account), nil
+}
+
+func toCreateAccountResponse(account *db.Account) *models.CreateAccountResponse {
 	return &models.CreateAccountResponse{
 		AccountID:      account.ID,
-		InitialBalance: account.Balance,
-	}, nil
+		AccountNumber:  util.AccountNumber(account.ID),
+		InitialBalance: util.CurrencyAmount(account.Balance, account.Currency),
+		Currency:       account.Currency,
+		Type:           account.Type,
+		BalanceFloor:   currencyFloor(account),
+		DisplayName:    account.DisplayName,
+		OwnerReference: account.OwnerReference,
+		Labels:         account.Labels,
+	}
+}
 
+// balanceFloor returns the floor of the account to create: zero for cash accounts, the negated credit limit
+// for credit accounts and none for system accounts
+func balanceFloor(request *models.CreateAccountRequest) *util.Money {
+	switch request.Type {
+	case db.AccountCash:
+		return &util.Money{}
+	case db.AccountCredit:
+		floor := request.CreditLimit.Neg()
+		return &floor
+	default:
+		return nil
+	}
+}
+
+func currencyFloor(account *db.Account) *util.Money {
+	if account.BalanceFloor == nil {
+		return nil
+	}
+	floor := util.CurrencyAmount(*account.BalanceFloor, account.Currency)
+	return &floor
 }
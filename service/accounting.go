@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/mt940"
+	"transfers/ofx"
+)
+
+// ExportMT940Service renders statements as MT940 customer statements, for accounting tools
+type ExportMT940Service struct {
+	db.Store
+}
+
+func (s *ExportMT940Service) Validate(ctx context.Context, request *models.GetAccountStatementRequest) error {
+	return validateStatementPeriod(request)
+}
+
+// Do renders the statement of the account for the period as an MT940 statement
+func (s *ExportMT940Service) Do(ctx context.Context, request *models.GetAccountStatementRequest) ([]byte, error) {
+	params := toAccountStatementParams(request)
+	statement, err := s.GetAccountStatement(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*mt940.Entry, 0, len(statement.Entries))
+	for _, entry := range statement.Entries {
+		entries = append(entries, &mt940.Entry{
+			TransactionID:         entry.TransactionID,
+			Amount:                entry.Amount,
+			BookedAt:              entry.CreatedAt,
+			CounterpartyAccountID: counterparty(entry),
+			Description:           entry.Description,
+			ExternalReference:     entry.ExternalReference,
+		})
+	}
+	return mt940.MarshalStatement(&mt940.Statement{
+		// The account is given with the statement, so its end identifies it in 16 characters
+		Reference:      "STMT" + params.To.UTC().Format("060102150405"),
+		Account:        mt940.Account{ID: statement.Account.ID, Currency: statement.Account.Currency},
+		From:           statementStart(params, statement.Account),
+		To:             params.To,
+		OpeningBalance: statement.OpeningBalance,
+		Entries:        entries,
+	})
+}
+
+// ExportOFXService renders statements as OFX bank statement responses, for accounting tools
+type ExportOFXService struct {
+	db.Store
+}
+
+func (s *ExportOFXService) Validate(ctx context.Context, request *models.GetAccountStatementRequest) error {
+	return validateStatementPeriod(request)
+}
+
+// Do renders the statement of the account for the period as an OFX statement
+func (s *ExportOFXService) Do(ctx context.Context, request *models.GetAccountStatementRequest) ([]byte, error) {
+	params := toAccountStatementParams(request)
+	statement, err := s.GetAccountStatement(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	account := statement.Account
+	entries := make([]*ofx.Entry, 0, len(statement.Entries))
+	for _, entry := range statement.Entries {
+		entries = append(entries, &ofx.Entry{
+			TransactionID:         entry.TransactionID,
+			Amount:                entry.Amount,
+			BookedAt:              entry.CreatedAt,
+			CounterpartyAccountID: counterparty(entry),
+			Description:           entry.Description,
+			ExternalReference:     entry.ExternalReference,
+		})
+	}
+	return ofx.MarshalStatement(&ofx.Statement{
+		ID:        fmt.Sprintf("STMT%d-%d", account.ID, params.To.Unix()),
+		CreatedAt: time.Now(),
+		Account: ofx.Account{
+			ID:         account.ID,
+			Currency:   account.Currency,
+			CreditLine: account.Type == db.AccountCredit,
+		},
+		From:           statementStart(params, account),
+		To:             params.To,
+		OpeningBalance: statement.OpeningBalance,
+		Entries:        entries,
+	})
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+type CreateTransferBatchService struct {
+	db.Store
+	// Rounding of amounts converted into the destination currency
+	Rounding util.RoundingMode
+}
+
+func (s *CreateTransferBatchService) Validate(ctx context.Context, request *models.CreateTransferBatchRequest) error {
+	if request.BestEffort {
+		return nil // transfers that fail validation are reported with the results
+	}
+	transfers := &CreateTransactionService{Store: s.Store}
+	for i, transfer := range request.Transfers {
+		if err := validateTransfer(ctx, transfers, transfer); err != nil {
+			return util.NewBatchTransferError(i, err)
+		}
+	}
+	return nil
+}
+
+// validateTransfer checks the binding of a transfer of the batch, which the binding of the batch leaves out, and then
+// checks it like a single transfer
+func validateTransfer(ctx context.Context, transfers *CreateTransactionService, transfer *models.CreateTransactionRequest) error {
+	if transfer == nil {
+		return util.NewMissingTransferError()
+	}
+	if err := binding.Validator.ValidateStruct(transfer); err != nil {
+		return util.NewInvalidTransferError(err)
+	}
+	return transfers.Validate(ctx, transfer)
+}
+
+/*
+Do makes the transfers of the batch in a single DB transaction. A failed transfer rolls back the whole batch, unless
+request.BestEffort, in which case the other transfers are still made and each failure is reported with its result.
+*/
+func (s *CreateTransferBatchService) Do(ctx context.Context, request *models.CreateTransferBatchRequest) (*models.CreateTransferBatchResponse, error) {
+	results, err := s.makeTransfers(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.CreateTransferBatchResponse{
+		Results: make([]*models.TransferBatchResult, len(results)),
+	}
+	for i, result := range results {
+		resp.Results[i] = &models.TransferBatchResult{Index: i}
+		if result.Err != nil {
+			resp.Results[i].Error = result.Err.Error()
+			resp.Failed++
+			continue
+		}
+		resp.Results[i].Transaction = toCreateTransactionResponse(result.Transaction)
+		resp.Succeeded++
+	}
+	return resp, nil
+}
+
+// makeTransfers makes the transfers of the batch, returning the result of each of them in the order of the request
+func (s *CreateTransferBatchService) makeTransfers(ctx context.Context, request *models.CreateTransferBatchRequest) ([]*db.TransferBatchResult, error) {
+	transfers := &CreateTransactionService{Store: s.Store}
+	results := make([]*db.TransferBatchResult, len(request.Transfers))
+	param := &db.CreateTransactionBatchParams{BestEffort: request.BestEffort}
+	var indexes []int // index in the request of each transfer in param
+	for i, transfer := range request.Transfers {
+		var err error
+		if request.BestEffort {
+			err = validateTransfer(ctx, transfers, transfer)
+		}
+		var transferParam *db.CreateTransactionParams
+		if err == nil {
+			transferParam, err = toCreateTransactionParams(ctx, s.Store, s.Rounding, transfer)
+		}
+		if err != nil {
+			if !request.BestEffort {
+				return nil, util.NewBatchTransferError(i, err)
+			}
+			results[i] = &db.TransferBatchResult{Err: err}
+			continue
+		}
+		param.Transfers = append(param.Transfers, transferParam)
+		indexes = append(indexes, i)
+	}
+
+	if len(param.Transfers) > 0 {
+		made, err := s.CreateTransactionBatch(ctx, param)
+		if err != nil {
+			return nil, err
+		}
+		for j, result := range made {
+			results[indexes[j]] = result
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+/*
+LoadFxRates publishes the rates in the CSV file at path, returning how many were not published before. Rates are never
+changed once published, so rows that were already loaded are skipped, and a row that gives another rate for a
+published one fails the load, leaving the rows before it published; publish a later effective_from to change a rate.
+*/
+func LoadFxRates(ctx context.Context, store db.Store, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	records, err := util.ReadFxRatesCSV(file)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for _, record := range records {
+		param := &db.CreateFxRateParams{
+			BaseCurrency:  record.BaseCurrency,
+			QuoteCurrency: record.QuoteCurrency,
+			Rate:          record.Rate,
+			EffectiveFrom: record.EffectiveFrom,
+		}
+		rows, err := store.CreateFxRate(ctx, param)
+		if err != nil {
+			return published, util.NewDBError(err)
+		}
+		if rows == 0 {
+			if err = requireSameFxRate(ctx, store, param); err != nil {
+				return published, err
+			}
+			continue
+		}
+		published++
+	}
+	return published, nil
+}
+
+// requireSameFxRate checks that the rate already published for the currencies and time of param is the rate of param
+func requireSameFxRate(ctx context.Context, store db.Store, param *db.CreateFxRateParams) error {
+	existing, err := store.GetFxRate(ctx, &db.GetFxRateParams{
+		BaseCurrency:  param.BaseCurrency,
+		QuoteCurrency: param.QuoteCurrency,
+		At:            param.EffectiveFrom,
+	})
+	if err != nil {
+		return util.NewDBError(err)
+	}
+	current, err := util.ParseFxRate(existing.Rate)
+	if err != nil {
+		return err
+	}
+	given, err := util.ParseFxRate(param.Rate)
+	if err != nil {
+		return err
+	}
+	if current.Cmp(&given) != 0 {
+		return util.NewFxRatePublishedError(param.BaseCurrency, param.QuoteCurrency, param.EffectiveFrom, existing.Rate, param.Rate)
+	}
+	return nil
+}
+
+/*
+publishedFxRate returns the rate in effect at the given time for converting base into quote, and its ID.
+When only the opposite direction is published, its inverse is used. found is false if neither is published.
+*/
+func publishedFxRate(ctx context.Context, store db.Store, base string, quote string, at time.Time) (rate big.Rat, id pgtype.Int8, found bool, err error) {
+	fxRate, err := store.GetFxRate(ctx, &db.GetFxRateParams{BaseCurrency: base, QuoteCurrency: quote, At: at})
+	inverse := false
+	if errors.Is(err, pgx.ErrNoRows) {
+		fxRate, err = store.GetFxRate(ctx, &db.GetFxRateParams{BaseCurrency: quote, QuoteCurrency: base, At: at})
+		inverse = true
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rate, id, false, nil
+	}
+	if err != nil {
+		return rate, id, false, util.NewDBError(err)
+	}
+	rate, err = util.ParseFxRate(fxRate.Rate)
+	if err != nil {
+		return rate, id, false, err
+	}
+	if inverse {
+		rate = util.InvertFxRate(rate)
+	}
+	return rate, pgtype.Int8{Int64: fxRate.ID, Valid: true}, true, nil
+}
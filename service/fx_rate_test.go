@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	mockdb "transfers/db/mock"
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+func TestLoadFxRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fx_rates.csv")
+	require.NoError(t, os.WriteFile(path, []byte(`base_currency,quote_currency,rate,effective_from
+USD,JPY,150.25,2024-01-01T00:00:00Z
+USD,EUR,0.92,2024-01-01T00:00:00Z
+EUR,JPY,163,2024-01-01T00:00:00Z
+`), 0o644))
+	published := func(base string, quote string, rate string) *db.FxRate {
+		return &db.FxRate{ID: 1, BaseCurrency: base, QuoteCurrency: quote, Rate: rate}
+	}
+
+	testCases := []struct {
+		name       string
+		buildStubs func(store *mockdb.MockStore)
+		check      func(count int, err error)
+	}{
+		{
+			name: "New",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateFxRate(gomock.Any(), gomock.Any()).Times(3).Return(int64(1), nil)
+			},
+			check: func(count int, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 3, count)
+			},
+		},
+		{
+			name: "SomePublished",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateFxRate(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+				store.EXPECT().CreateFxRate(gomock.Any(), gomock.Any()).Times(2).Return(int64(1), nil)
+				store.EXPECT().
+					GetFxRate(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(published("USD", "JPY", "150.2500000000"), nil)
+			},
+			check: func(count int, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, count)
+			},
+		},
+		{
+			name: "PublishedWithAnotherRate",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateFxRate(gomock.Any(), gomock.Any()).Times(1).Return(int64(1), nil)
+				store.EXPECT().CreateFxRate(gomock.Any(), gomock.Any()).Times(1).Return(int64(0), nil)
+				store.EXPECT().
+					GetFxRate(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(published("USD", "EUR", "0.9100000000"), nil)
+			},
+			check: func(count int, err error) {
+				require.True(t, errorx.IsOfType(err, util.ErrFxRateChanged), err)
+				require.Equal(t, 1, count)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			tc.check(LoadFxRates(context.Background(), store, path))
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+type CreateHoldService struct {
+	db.Store
+	// Lifetime of holds created without an expiry
+	TTL time.Duration
+}
+
+func (s *CreateHoldService) Validate(ctx context.Context, request *models.CreateHoldRequest) error {
+	var err error
+	request.AccountID, err = util.ResolveAccountID("account", request.AccountID, request.AccountNumber)
+	if err != nil {
+		return err
+	}
+	request.DestinationAccountID, err = util.ResolveAccountID("destination_account", request.DestinationAccountID, request.DestinationAccountNumber)
+	if err != nil {
+		return err
+	}
+	if request.Amount.Sign() <= 0 {
+		return util.NewInvalidAmountError(request.Amount.String())
+	}
+	if request.AccountID == request.DestinationAccountID {
+		return util.NewTransactionToSameAccountError(request.AccountID)
+	}
+	if request.ExpiresAt.IsZero() {
+		request.ExpiresAt = time.Now().Add(s.TTL)
+	} else if !request.ExpiresAt.After(time.Now()) {
+		return util.NewInvalidHoldExpiryError(request.ExpiresAt)
+	}
+	account, err := s.GetAccount(ctx, request.AccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return util.NewAccountNotFoundError(request.AccountID)
+		}
+		return util.NewDBError(err)
+	}
+	destination, err := s.GetAccount(ctx, request.DestinationAccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return util.NewAccountNotFoundError(request.DestinationAccountID)
+		}
+		return util.NewDBError(err)
+	}
+	if err = account.RequireActive(); err != nil {
+		return err
+	}
+	if err = destination.RequireActive(); err != nil {
+		return err
+	}
+
+	// Holds are in the currency of the held account
+	if request.Currency != "" && request.Currency != account.Currency {
+		return util.NewAccountCurrencyMismatchError(account.ID, request.Currency, account.Currency)
+	}
+	request.Currency = account.Currency
+	currency, err := util.LookupCurrency(request.Currency)
+	if err != nil {
+		return err
+	}
+	if err = currency.ValidateAmount(*request.Amount); err != nil {
+		return err
+	}
+	amount := request.Amount.Rescale(util.MoneyScale, util.RoundDown)
+	request.Amount = &amount
+
+	// A hold into another currency can only be captured at a published rate
+	if destination.Currency != account.Currency {
+		_, _, found, err := publishedFxRate(ctx, s.Store, account.Currency, destination.Currency, time.Now())
+		if err != nil {
+			return err
+		}
+		if !found {
+			return util.NewCurrencyMismatchError(account.Currency, destination.Currency)
+		}
+	}
+	return nil
+}
+
+func (s *CreateHoldService) Do(ctx context.Context, request *models.CreateHoldRequest) (*models.GetHoldResponse, error) {
+	hold, err := s.PlaceHold(ctx, &db.CreateHoldParams{
+		AccountID:            request.AccountID,
+		DestinationAccountID: request.DestinationAccountID,
+		Amount:               *request.Amount,
+		Currency:             request.Currency,
+		ExpiresAt:            request.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toGetHoldResponse(hold), nil
+}
+
+type GetHoldService struct {
+	db.Store
+}
+
+func (s *GetHoldService) Validate(ctx context.Context, request *models.GetHoldRequest) error {
+	return nil
+}
+
+func (s *GetHoldService) Do(ctx context.Context, request *models.GetHoldRequest) (*models.GetHoldResponse, error) {
+	hold, err := s.GetHold(ctx, request.HoldID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewHoldNotFoundError(request.HoldID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	return toGetHoldResponse(hold), nil
+}
+
+type CaptureHoldService struct {
+	db.Store
+	// Rounding of captured amounts converted into the destination currency
+	Rounding util.RoundingMode
+}
+
+func (s *CaptureHoldService) Validate(ctx context.Context, request *models.CaptureHoldRequest) error {
+	if request.Amount == nil {
+		return nil // capture the whole hold
+	}
+	if request.Amount.Sign() <= 0 {
+		return util.NewInvalidAmountError(request.Amount.String())
+	}
+	amount := request.Amount.Rescale(util.MoneyScale, util.RoundDown)
+	request.Amount = &amount
+	return nil
+}
+
+/*
+Do captures the hold into a transfer to its destination account, converted at the rate published at the time of
+capture. Whether the hold is still active, and covers the amount, is checked again when it is locked for the capture.
+*/
+func (s *CaptureHoldService) Do(ctx context.Context, request *models.CaptureHoldRequest) (*models.GetHoldResponse, error) {
+	hold, err := s.GetHold(ctx, request.HoldID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewHoldNotFoundError(request.HoldID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	amount := hold.Amount
+	if request.Amount != nil {
+		amount = *request.Amount
+	}
+	currency, err := util.LookupCurrency(hold.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err = currency.ValidateAmount(amount); err != nil {
+		return nil, err
+	}
+	destination, err := s.GetAccount(ctx, hold.DestinationAccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewAccountNotFoundError(hold.DestinationAccountID)
+		}
+		return nil, util.NewDBError(err)
+	}
+
+	param := &db.CreateTransactionParams{
+		SourceAccountID:      hold.AccountID,
+		DestinationAccountID: hold.DestinationAccountID,
+		Amount:               amount,
+		Currency:             hold.Currency,
+		DestinationAmount:    amount,
+		DestinationCurrency:  destination.Currency,
+		FxRate:               "1",
+	}
+	if param.Currency != param.DestinationCurrency {
+		err = convert(ctx, s.Store, s.Rounding, "", param)
+		if err != nil {
+			return nil, err
+		}
+	}
+	captured, err := s.CaptureHold(ctx, &db.CaptureHoldParams{
+		HoldID:   hold.ID,
+		Transfer: param,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toGetHoldResponse(captured), nil
+}
+
+type VoidHoldService struct {
+	db.Store
+}
+
+func (s *VoidHoldService) Validate(ctx context.Context, request *models.VoidHoldRequest) error {
+	return nil
+}
+
+func (s *VoidHoldService) Do(ctx context.Context, request *models.VoidHoldRequest) (*models.GetHoldResponse, error) {
+	hold, err := s.VoidHold(ctx, request.HoldID)
+	if err != nil {
+		return nil, err
+	}
+	return toGetHoldResponse(hold), nil
+}
+
+func toGetHoldResponse(hold *db.Hold) *models.GetHoldResponse {
+	resp := &models.GetHoldResponse{
+		HoldID:               hold.ID,
+		AccountID:            hold.AccountID,
+		DestinationAccountID: hold.DestinationAccountID,
+		Amount:               util.CurrencyAmount(hold.Amount, hold.Currency),
+		Currency:             hold.Currency,
+		Status:               hold.Status,
+		TransactionID:        hold.TransactionID.Int64,
+		ExpiresAt:            hold.ExpiresAt,
+		CreatedAt:            hold.CreatedAt,
+	}
+	if hold.Status == db.HoldCaptured {
+		captured := util.CurrencyAmount(hold.CapturedAmount, hold.Currency)
+		resp.CapturedAmount = &captured
+	}
+	return resp
+}
+
+// ExpireHolds releases the holds that have expired every interval, until ctx is done
+func ExpireHolds(ctx context.Context, store db.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			count, err := store.ReleaseExpiredHolds(ctx, now)
+			if err != nil {
+				log.Println("error releasing expired holds:", err)
+				continue
+			}
+			if count > 0 {
+				log.Printf("Released %d expired holds", count)
+			}
+		}
+	}
+}
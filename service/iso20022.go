@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/iso20022"
+	"transfers/util"
+)
+
+type ExportCamt053Service struct {
+	db.Store
+}
+
+func (s *ExportCamt053Service) Validate(ctx context.Context, request *models.GetAccountStatementRequest) error {
+	return validateStatementPeriod(request)
+}
+
+// Do renders the statement of the account for the period as a camt.053 statement
+func (s *ExportCamt053Service) Do(ctx context.Context, request *models.GetAccountStatementRequest) ([]byte, error) {
+	params := toAccountStatementParams(request)
+	statement, err := s.GetAccountStatement(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	account := statement.Account
+	entries := make([]*iso20022.Entry, 0, len(statement.Entries))
+	for _, entry := range statement.Entries {
+		entries = append(entries, toISO20022Entry(entry))
+	}
+	return iso20022.MarshalStatement(&iso20022.Statement{
+		MessageID:      fmt.Sprintf("STMT%d-%d", account.ID, params.To.Unix()),
+		CreatedAt:      time.Now(),
+		Account:        toISO20022Account(account),
+		From:           statementStart(params, account),
+		To:             params.To,
+		OpeningBalance: statement.OpeningBalance,
+		Entries:        entries,
+	})
+}
+
+type ExportCamt054Service struct {
+	db.Store
+}
+
+func (s *ExportCamt054Service) Validate(ctx context.Context, request *models.GetTransactionNotificationRequest) error {
+	return nil
+}
+
+// Do renders the entries that a transaction made to the account as a camt.054 notification
+func (s *ExportCamt054Service) Do(ctx context.Context, request *models.GetTransactionNotificationRequest) ([]byte, error) {
+	account, err := s.GetAccount(ctx, request.AccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewAccountNotFoundError(request.AccountID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	transaction, err := s.GetTransaction(ctx, request.TransactionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewTransactionNotFoundError(request.TransactionID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	entries, err := s.ListEntriesByTransaction(ctx, transaction.ID)
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	var notified []*iso20022.Entry
+	for _, entry := range entries {
+		if entry.AccountID.Valid && entry.AccountID.Int64 == account.ID {
+			notified = append(notified, toISO20022Entry(toStatementEntry(entry, transaction)))
+		}
+	}
+	if len(notified) == 0 {
+		return nil, util.NewTransactionNotOfAccountError(transaction.ID, account.ID)
+	}
+	return iso20022.MarshalNotification(&iso20022.Notification{
+		MessageID: fmt.Sprintf("NTFN%d-%d", account.ID, transaction.ID),
+		CreatedAt: time.Now(),
+		Account:   toISO20022Account(account),
+		Entries:   notified,
+	})
+}
+
+func toISO20022Account(account *db.Account) iso20022.Account {
+	return iso20022.Account{
+		ID:       account.ID,
+		Currency: account.Currency,
+		Name:     account.DisplayName,
+	}
+}
+
+func toISO20022Entry(entry *db.ListAccountStatementEntriesRow) *iso20022.Entry {
+	return &iso20022.Entry{
+		TransactionID:         entry.TransactionID,
+		Amount:                entry.Amount,
+		BookedAt:              entry.CreatedAt,
+		CounterpartyAccountID: counterparty(entry),
+		Description:           entry.Description,
+		ExternalReference:     entry.ExternalReference,
+	}
+}
+
+// toStatementEntry joins an entry with its transaction, as statements read them
+func toStatementEntry(entry *db.Entry, transaction *db.Transaction) *db.ListAccountStatementEntriesRow {
+	return &db.ListAccountStatementEntriesRow{
+		ID:                   entry.ID,
+		TransactionID:        entry.TransactionID,
+		Amount:               entry.Amount,
+		Currency:             entry.Currency,
+		CreatedAt:            entry.CreatedAt,
+		SourceAccountID:      transaction.SourceAccountID,
+		DestinationAccountID: transaction.DestinationAccountID,
+		Description:          transaction.Description,
+		ExternalReference:    transaction.ExternalReference,
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/iso20022"
+	"transfers/util"
+)
+
+const (
+	// Payment files are made as a single batch, so they are limited like batches
+	maxPaymentFileTransfers = 1000
+	// Claims the message ID of a payment file in the idempotency keys, so that a file sent again is not paid twice
+	paymentFileKeyPrefix = "pain.001:"
+	// Given in place of the end to end identification by debtors that have none
+	notProvided   = "NOTPROVIDED"
+	maxTextLength = 255
+)
+
+// Layouts of ISO dates, and of ISO date and times with or without a time zone, which is UTC when left out
+var executionDateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05"}
+
+type IngestPaymentFileService struct {
+	db.Store
+	// Rounding of amounts converted into the destination currency
+	Rounding util.RoundingMode
+	// How long the message ID of a file is remembered for
+	TTL time.Duration
+}
+
+func (s *IngestPaymentFileService) Validate(ctx context.Context, request *models.IngestPaymentFileRequest) error {
+	if len(request.Document) == 0 {
+		return util.NewInvalidPaymentFileError("empty document")
+	}
+	return nil
+}
+
+/*
+Do makes the credit transfers of a pain.001 file and reports on each of them in a pain.002 status report. The transfers
+are checked like single transfers and made as a best effort batch, so each one is accepted or rejected on its own.
+Payments requested for a later day are rejected, as they would otherwise be made before the day that was asked for.
+A file whose transfer count or control sum does not add up is rejected as a whole, as is a different file with the
+message ID of one received before. The same file sent again gets the report of the first one, without paying twice.
+*/
+func (s *IngestPaymentFileService) Do(ctx context.Context, request *models.IngestPaymentFileRequest) ([]byte, error) {
+	file, err := iso20022.ParsePaymentInitiation(request.Document)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	report := &iso20022.StatusReport{
+		MessageID: fmt.Sprintf("PSR%d", now.UnixNano()),
+		CreatedAt: now,
+		Original:  file,
+	}
+	if report.Reason = checkPaymentFile(file); report.Reason != nil {
+		return iso20022.MarshalStatusReport(report)
+	}
+
+	// The message ID is recorded in the transaction of the batch, so a file is never paid without it being recorded
+	key := paymentFileKeyPrefix + file.MessageID
+	hash := sha256.Sum256(request.Document)
+	requestHash := hex.EncodeToString(hash[:])
+	var document []byte
+	record, err := s.DoIdempotent(ctx, &db.CreateIdempotencyKeyParams{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(s.TTL),
+	}, func(ctx context.Context) (*db.IdempotentResponse, error) {
+		if document, err = s.makePayments(ctx, file, report); err != nil {
+			return nil, err
+		}
+		return &db.IdempotentResponse{Status: http.StatusOK, Body: document}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		return replay(record, requestHash, report)
+	}
+	return document, nil
+}
+
+func (s *IngestPaymentFileService) makePayments(ctx context.Context, file *iso20022.PaymentInitiation, report *iso20022.StatusReport) ([]byte, error) {
+	batch := &models.CreateTransferBatchRequest{BestEffort: true}
+	var pending []*iso20022.TransferStatus // status of each transfer in batch
+	for _, payment := range file.Payments {
+		paymentStatus := &iso20022.PaymentStatus{OriginalPaymentInformationID: payment.ID}
+		reason := checkExecutionDate(payment, report.CreatedAt)
+		for _, transfer := range payment.Transfers {
+			status := &iso20022.TransferStatus{
+				OriginalInstructionID: transfer.InstructionID,
+				OriginalEndToEndID:    transfer.EndToEndID,
+			}
+			paymentStatus.Transfers = append(paymentStatus.Transfers, status)
+			if reason != nil {
+				status.Status, status.Reason = iso20022.StatusRejected, reason
+				continue
+			}
+			transferRequest, err := toPaymentTransferRequest(file, payment, transfer)
+			if err != nil {
+				status.Status, status.Reason = iso20022.StatusRejected, iso20022.ReasonFor(err)
+				continue
+			}
+			batch.Transfers = append(batch.Transfers, transferRequest)
+			pending = append(pending, status)
+		}
+		report.Payments = append(report.Payments, paymentStatus)
+	}
+
+	if len(batch.Transfers) > 0 {
+		transfers := &CreateTransferBatchService{Store: s.Store, Rounding: s.Rounding}
+		results, err := transfers.makeTransfers(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, result := range results {
+			if result.Err != nil {
+				pending[i].Status, pending[i].Reason = iso20022.StatusRejected, iso20022.ReasonFor(result.Err)
+				continue
+			}
+			pending[i].Status, pending[i].TransactionID = iso20022.StatusAccepted, result.Transaction.ID
+		}
+	}
+	return iso20022.MarshalStatusReport(report)
+}
+
+// replay answers a file whose message ID was received before with the report of the first file, if it is the same file
+func replay(record *db.IdempotencyKey, requestHash string, report *iso20022.StatusReport) ([]byte, error) {
+	if record.RequestHash != requestHash {
+		report.Reason = &iso20022.StatusReason{
+			Code:                  iso20022.ReasonDuplicateMessageID,
+			AdditionalInformation: fmt.Sprintf("a different file with message ID %s was received at %s", report.Original.MessageID, record.CreatedAt.UTC().Format(time.RFC3339)),
+		}
+		return iso20022.MarshalStatusReport(report)
+	}
+	return record.ResponseBody, nil
+}
+
+// checkPaymentFile checks the transfer count and control sum of the group header against the transfers of the file
+func checkPaymentFile(file *iso20022.PaymentInitiation) *iso20022.StatusReason {
+	count := file.Transfers()
+	if count == 0 || count > maxPaymentFileTransfers {
+		return &iso20022.StatusReason{
+			Code:                  iso20022.ReasonInvalidNumberOfTransactions,
+			AdditionalInformation: fmt.Sprintf("a file has 1 to %d credit transfers, not %d", maxPaymentFileTransfers, count),
+		}
+	}
+	if claimed, err := strconv.Atoi(file.NumberOfTransactions); err != nil || claimed != count {
+		return &iso20022.StatusReason{
+			Code:                  iso20022.ReasonInvalidNumberOfTransactions,
+			AdditionalInformation: fmt.Sprintf("NbOfTxs is %q, but the file has %d credit transfers", file.NumberOfTransactions, count),
+		}
+	}
+	if file.ControlSum == "" {
+		return nil
+	}
+	var sum util.Money
+	for _, payment := range file.Payments {
+		for _, transfer := range payment.Transfers {
+			// Amounts that cannot be read are rejected with their transfers, and leave the sum short
+			if amount, err := util.ParseMoney(transfer.Amount); err == nil {
+				if sum, err = sum.Add(amount); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if claimed, err := util.ParseMoney(file.ControlSum); err != nil || claimed.Cmp(sum) != 0 {
+		return &iso20022.StatusReason{
+			Code:                  iso20022.ReasonInvalidControlSum,
+			AdditionalInformation: fmt.Sprintf("CtrlSum is %q, but the amounts of the file add up to %s", file.ControlSum, sum),
+		}
+	}
+	return nil
+}
+
+/*
+checkExecutionDate turns down the payments of a block that the debtor asked to be made on a later day than now, since
+payments are made as soon as their file is received. A date in the past is taken to mean as soon as possible.
+*/
+func checkExecutionDate(payment *iso20022.PaymentInformation, now time.Time) *iso20022.StatusReason {
+	if payment.RequestedExecutionDate == "" {
+		return nil
+	}
+	var executeAt time.Time
+	var err error
+	for _, layout := range executionDateLayouts {
+		if executeAt, err = time.Parse(layout, payment.RequestedExecutionDate); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return &iso20022.StatusReason{
+			Code:                  iso20022.ReasonInvalidDate,
+			AdditionalInformation: fmt.Sprintf("ReqdExctnDt %q is not a date", payment.RequestedExecutionDate),
+		}
+	}
+	if executeAt.After(now) {
+		return &iso20022.StatusReason{
+			Code:                  iso20022.ReasonExecutionDateInFuture,
+			AdditionalInformation: fmt.Sprintf("ReqdExctnDt is %s, but payments are made on the day they are received", payment.RequestedExecutionDate),
+		}
+	}
+	return nil
+}
+
+// toPaymentTransferRequest turns a credit transfer of a payment file into a transfer between accounts of the system
+func toPaymentTransferRequest(file *iso20022.PaymentInitiation, payment *iso20022.PaymentInformation, transfer *iso20022.CreditTransfer) (*models.CreateTransactionRequest, error) {
+	source, err := paymentAccountID(payment.DebtorAccount)
+	if err != nil {
+		return nil, err
+	}
+	destination, err := paymentAccountID(transfer.CreditorAccount)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := util.ParseMoney(transfer.Amount)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(map[string]map[string]string{
+		"pain001": {
+			"message_id":             file.MessageID,
+			"payment_information_id": payment.ID,
+			"instruction_id":         transfer.InstructionID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	request := &models.CreateTransactionRequest{
+		SourceAccountID:      source,
+		DestinationAccountID: destination,
+		Amount:               &amount,
+		Currency:             transfer.Currency,
+		Description:          truncateText(strings.Join(transfer.RemittanceInformation, " ")),
+		Metadata:             metadata,
+	}
+	if transfer.EndToEndID != notProvided {
+		request.ExternalReference = truncateText(transfer.EndToEndID)
+	}
+	return request, nil
+}
+
+// paymentAccountID reads the account number that identifies an account of the system, which has no IBAN
+func paymentAccountID(account iso20022.AccountReference) (int64, error) {
+	if account.Other == "" {
+		return 0, util.NewInvalidAccountNumberError(account.IBAN)
+	}
+	return util.ParseAccountNumber(account.Other)
+}
+
+func truncateText(text string) string {
+	if utf8.RuneCountInString(text) <= maxTextLength {
+		return text
+	}
+	return string([]rune(text)[:maxTextLength])
+}
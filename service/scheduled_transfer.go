@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+type CreateScheduledTransferService struct {
+	db.Store
+}
+
+func (s *CreateScheduledTransferService) Validate(ctx context.Context, request *models.CreateScheduledTransferRequest) error {
+	if request.Recurrence == "" {
+		request.Recurrence = db.RecurrenceOnce
+	}
+	if !request.ExecuteAt.After(time.Now()) {
+		return util.NewInvalidScheduleError("execute_at must be in the future")
+	}
+	if request.Recurrence == db.RecurrenceOnce && (!request.EndAt.IsZero() || request.MaxOccurrences != 0) {
+		return util.NewInvalidScheduleError("end_at and max_occurrences only apply to recurring transfers")
+	}
+	if !request.EndAt.IsZero() && request.EndAt.Before(request.ExecuteAt) {
+		return util.NewInvalidScheduleError("end_at must not be before execute_at")
+	}
+
+	// Every occurrence is a transfer, so it is validated like one
+	transfer := &models.CreateTransactionRequest{
+		SourceAccountID:          request.SourceAccountID,
+		SourceAccountNumber:      request.SourceAccountNumber,
+		DestinationAccountID:     request.DestinationAccountID,
+		DestinationAccountNumber: request.DestinationAccountNumber,
+		Amount:                   request.Amount,
+		Currency:                 request.Currency,
+	}
+	if err := (&CreateTransactionService{Store: s.Store}).Validate(ctx, transfer); err != nil {
+		return err
+	}
+	request.SourceAccountID, request.DestinationAccountID = transfer.SourceAccountID, transfer.DestinationAccountID
+	request.Amount, request.Currency = transfer.Amount, transfer.Currency
+
+	// Occurrences into another currency are converted at the rate published when they are made
+	if transfer.DestinationCurrency != transfer.Currency {
+		_, _, found, err := publishedFxRate(ctx, s.Store, transfer.Currency, transfer.DestinationCurrency, time.Now())
+		if err != nil {
+			return err
+		}
+		if !found {
+			return util.NewCurrencyMismatchError(transfer.Currency, transfer.DestinationCurrency)
+		}
+	}
+	return nil
+}
+
+func (s *CreateScheduledTransferService) Do(ctx context.Context, request *models.CreateScheduledTransferRequest) (*models.GetScheduledTransferResponse, error) {
+	param := &db.CreateScheduledTransferParams{
+		SourceAccountID:      request.SourceAccountID,
+		DestinationAccountID: request.DestinationAccountID,
+		Amount:               *request.Amount,
+		Currency:             request.Currency,
+		Recurrence:           request.Recurrence,
+		StartAt:              request.ExecuteAt,
+	}
+	if !request.EndAt.IsZero() {
+		param.EndAt = pgtype.Timestamptz{Time: request.EndAt, Valid: true}
+	}
+	if request.MaxOccurrences != 0 {
+		param.MaxOccurrences = pgtype.Int4{Int32: request.MaxOccurrences, Valid: true}
+	}
+	scheduled, err := s.CreateScheduledTransfer(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+	return toGetScheduledTransferResponse(scheduled), nil
+}
+
+type GetScheduledTransferService struct {
+	db.Store
+}
+
+func (s *GetScheduledTransferService) Validate(ctx context.Context, request *models.GetScheduledTransferRequest) error {
+	return nil
+}
+
+func (s *GetScheduledTransferService) Do(ctx context.Context, request *models.GetScheduledTransferRequest) (*models.GetScheduledTransferResponse, error) {
+	scheduled, err := s.GetScheduledTransfer(ctx, request.ScheduledTransferID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewScheduledTransferNotFoundError(request.ScheduledTransferID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	return toGetScheduledTransferResponse(scheduled), nil
+}
+
+type ListScheduledTransferRunsService struct {
+	db.Store
+}
+
+func (s *ListScheduledTransferRunsService) Validate(ctx context.Context, request *models.ListScheduledTransferRunsRequest) error {
+	return nil
+}
+
+func (s *ListScheduledTransferRunsService) Do(ctx context.Context, request *models.ListScheduledTransferRunsRequest) (*models.ListScheduledTransferRunsResponse, error) {
+	_, err := s.GetScheduledTransfer(ctx, request.ScheduledTransferID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewScheduledTransferNotFoundError(request.ScheduledTransferID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	runs, err := s.ListScheduledTransferRuns(ctx, request.ScheduledTransferID)
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	resp := &models.ListScheduledTransferRunsResponse{
+		Runs: make([]*models.ScheduledTransferRunResponse, len(runs)),
+	}
+	for i, run := range runs {
+		resp.Runs[i] = &models.ScheduledTransferRunResponse{
+			RunID:         run.ID,
+			Occurrence:    run.Occurrence,
+			Attempt:       run.Attempt,
+			Status:        run.Status,
+			TransactionID: run.TransactionID.Int64,
+			Error:         run.Error,
+			CreatedAt:     run.CreatedAt,
+		}
+	}
+	return resp, nil
+}
+
+func toGetScheduledTransferResponse(scheduled *db.ScheduledTransfer) *models.GetScheduledTransferResponse {
+	resp := &models.GetScheduledTransferResponse{
+		ScheduledTransferID:  scheduled.ID,
+		SourceAccountID:      scheduled.SourceAccountID,
+		DestinationAccountID: scheduled.DestinationAccountID,
+		Amount:               util.CurrencyAmount(scheduled.Amount, scheduled.Currency),
+		Currency:             scheduled.Currency,
+		Recurrence:           scheduled.Recurrence,
+		ExecuteAt:            scheduled.StartAt,
+		MaxOccurrences:       scheduled.MaxOccurrences.Int32,
+		Occurrences:          scheduled.Occurrences,
+		Status:               scheduled.Status,
+		CreatedAt:            scheduled.CreatedAt,
+	}
+	if scheduled.EndAt.Valid {
+		resp.EndAt = &scheduled.EndAt.Time
+	}
+	if scheduled.NextRunAt.Valid {
+		resp.NextRunAt = &scheduled.NextRunAt.Time
+	}
+	return resp
+}
+
+// TransferScheduler makes scheduled transfers as they fall due
+type TransferScheduler struct {
+	db.Store
+	// Rounding of amounts converted into the destination currency
+	Rounding util.RoundingMode
+	// How a failed occurrence is retried before moving on to the next one
+	Policy util.RetryPolicy
+}
+
+// Run makes the scheduled transfers that are due every interval, until ctx is done
+func (s *TransferScheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for {
+				found, err := s.RunDueScheduledTransfer(ctx, now, s.attempt)
+				if err != nil {
+					log.Println("error running scheduled transfers:", err)
+				}
+				if err != nil || !found {
+					break
+				}
+			}
+		}
+	}
+}
+
+/*
+attempt makes the transfer for the next occurrence of scheduled at now. A failed attempt is retried after the policy's
+backoff from now, and once the retries run out the occurrence is given up on. After the last occurrence the schedule is
+completed, or failed if that occurrence failed.
+*/
+func (s *TransferScheduler) attempt(ctx context.Context, now time.Time, scheduled *db.ScheduledTransfer, transfer db.CreateTransactionFunc) (*db.CreateScheduledTransferRunParams, *db.UpdateScheduledTransferParams) {
+	run := &db.CreateScheduledTransferRunParams{
+		ScheduledTransferID: scheduled.ID,
+		Occurrence:          scheduled.Occurrences + 1,
+		Attempt:             scheduled.Attempt + 1,
+		Status:              db.RunSucceeded,
+	}
+	update := &db.UpdateScheduledTransferParams{
+		ID:          scheduled.ID,
+		Occurrences: scheduled.Occurrences,
+		Attempt:     run.Attempt,
+		NextRunAt:   scheduled.NextRunAt,
+		Status:      db.ScheduleActive,
+	}
+
+	transaction, err := s.transfer(ctx, scheduled, transfer)
+	if err != nil {
+		run.Status, run.Error = db.RunFailed, err.Error()
+		if int(scheduled.Attempt) < s.Policy.MaxRetries {
+			update.NextRunAt = pgtype.Timestamptz{Time: now.Add(s.Policy.Backoff(int(scheduled.Attempt))), Valid: true}
+			return run, update
+		}
+	} else {
+		run.TransactionID = pgtype.Int8{Int64: transaction.ID, Valid: true}
+	}
+
+	update.Occurrences, update.Attempt = run.Occurrence, 0
+	next, ok := nextOccurrence(scheduled, update.Occurrences)
+	switch {
+	case ok:
+		update.NextRunAt = pgtype.Timestamptz{Time: next, Valid: true}
+	case err != nil:
+		update.NextRunAt, update.Status = pgtype.Timestamptz{}, db.ScheduleFailed
+	default:
+		update.NextRunAt, update.Status = pgtype.Timestamptz{}, db.ScheduleCompleted
+	}
+	return run, update
+}
+
+// transfer makes the transfer of an occurrence of scheduled with createTransaction
+func (s *TransferScheduler) transfer(ctx context.Context, scheduled *db.ScheduledTransfer, createTransaction db.CreateTransactionFunc) (*db.Transaction, error) {
+	destination, err := s.GetAccount(ctx, scheduled.DestinationAccountID)
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	param := &db.CreateTransactionParams{
+		SourceAccountID:      scheduled.SourceAccountID,
+		DestinationAccountID: scheduled.DestinationAccountID,
+		Amount:               scheduled.Amount,
+		Currency:             scheduled.Currency,
+		DestinationAmount:    scheduled.Amount,
+		DestinationCurrency:  destination.Currency,
+		FxRate:               "1",
+	}
+	if param.Currency != param.DestinationCurrency {
+		err = convert(ctx, s.Store, s.Rounding, "", param)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return createTransaction(ctx, param)
+}
+
+// nextOccurrence returns the time of the occurrence after the first n of scheduled, and false when there is none
+func nextOccurrence(scheduled *db.ScheduledTransfer, n int32) (time.Time, bool) {
+	if scheduled.MaxOccurrences.Valid && n >= scheduled.MaxOccurrences.Int32 {
+		return time.Time{}, false
+	}
+	var next time.Time
+	switch scheduled.Recurrence {
+	case db.RecurrenceDaily:
+		next = scheduled.StartAt.AddDate(0, 0, int(n))
+	case db.RecurrenceWeekly:
+		next = scheduled.StartAt.AddDate(0, 0, 7*int(n))
+	case db.RecurrenceMonthly:
+		next = util.AddMonths(scheduled.StartAt, int(n))
+	default:
+		return time.Time{}, false
+	}
+	if scheduled.EndAt.Valid && next.After(scheduled.EndAt.Time) {
+		return time.Time{}, false
+	}
+	return next, true
+}
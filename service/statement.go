@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"transfers/api/models"
+	db "transfers/db/sqlc"
+	"transfers/util"
+)
+
+type GetAccountBalanceService struct {
+	db.Store
+}
+
+func (s *GetAccountBalanceService) Validate(ctx context.Context, request *models.GetAccountBalanceRequest) error {
+	return nil
+}
+
+// Do adds up the initial balance of the account and its entries before the time asked for
+func (s *GetAccountBalanceService) Do(ctx context.Context, request *models.GetAccountBalanceRequest) (*models.GetAccountBalanceResponse, error) {
+	at := request.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	account, err := s.GetAccount(ctx, request.AccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewAccountNotFoundError(request.AccountID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	total, err := s.SumAccountEntries(ctx, &db.SumAccountEntriesParams{
+		AccountID: request.AccountID,
+		Before:    at,
+	})
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	balance, err := account.InitialBalance.Add(total)
+	if err != nil {
+		return nil, err
+	}
+	return &models.GetAccountBalanceResponse{
+		AccountID: account.ID,
+		Balance:   util.CurrencyAmount(balance, account.Currency),
+		Currency:  account.Currency,
+		At:        at,
+	}, nil
+}
+
+type GetAccountStatementService struct {
+	db.Store
+}
+
+func (s *GetAccountStatementService) Validate(ctx context.Context, request *models.GetAccountStatementRequest) error {
+	return validateStatementPeriod(request)
+}
+
+// Do returns the movements of the account in the period, with the balance after each of them
+func (s *GetAccountStatementService) Do(ctx context.Context, request *models.GetAccountStatementRequest) (*models.GetAccountStatementResponse, error) {
+	statement, err := s.GetAccountStatement(ctx, toAccountStatementParams(request))
+	if err != nil {
+		return nil, err
+	}
+	account := statement.Account
+	resp := &models.GetAccountStatementResponse{
+		AccountID:      account.ID,
+		Currency:       account.Currency,
+		From:           request.From,
+		To:             request.To,
+		OpeningBalance: util.CurrencyAmount(statement.OpeningBalance, account.Currency),
+		Movements:      make([]*models.StatementMovementResponse, 0, len(statement.Entries)),
+	}
+	if resp.From.IsZero() {
+		resp.From = account.CreatedAt
+	}
+	balance := statement.OpeningBalance
+	for _, entry := range statement.Entries {
+		balance, err = balance.Add(entry.Amount)
+		if err != nil {
+			return nil, err
+		}
+		resp.Movements = append(resp.Movements, toStatementMovementResponse(account, entry, balance))
+	}
+	resp.ClosingBalance = util.CurrencyAmount(balance, account.Currency)
+	return resp, nil
+}
+
+// toAccountStatementParams fills in the period of the statement, which runs until now unless it is given
+func toAccountStatementParams(request *models.GetAccountStatementRequest) *db.AccountStatementParams {
+	if request.To.IsZero() {
+		request.To = time.Now()
+	}
+	return &db.AccountStatementParams{
+		AccountID: request.AccountID,
+		From:      request.From,
+		To:        request.To,
+	}
+}
+
+// statementStart is the start of the period of a statement, which is when the account was created if not given
+func statementStart(params *db.AccountStatementParams, account *db.Account) time.Time {
+	if params.From.IsZero() {
+		return account.CreatedAt
+	}
+	return params.From
+}
+
+func toStatementMovementResponse(account *db.Account, entry *db.ListAccountStatementEntriesRow, balance util.Money) *models.StatementMovementResponse {
+	return &models.StatementMovementResponse{
+		TransactionID:         entry.TransactionID,
+		CounterpartyAccountID: counterparty(entry),
+		Amount:                util.CurrencyAmount(entry.Amount, account.Currency),
+		Balance:               util.CurrencyAmount(balance, account.Currency),
+		Description:           entry.Description,
+		ExternalReference:     entry.ExternalReference,
+		CreatedAt:             entry.CreatedAt,
+	}
+}
+
+// Types of the records of an exported statement
+const (
+	StatementOpening  = "opening"
+	StatementMovement = "movement"
+	StatementClosing  = "closing"
+	// Ends a statement cut short by an error, in place of the closing record, with the balance it got to
+	StatementError = "error"
+)
+
+// StatementRecordWriter writes the records of an exported statement in some format
+type StatementRecordWriter interface {
+	Write(record *models.StatementRecord) error
+}
+
+type ExportAccountStatementService struct {
+	db.Store
+}
+
+func (s *ExportAccountStatementService) Validate(ctx context.Context, request *models.GetAccountStatementRequest) error {
+	return validateStatementPeriod(request)
+}
+
+/*
+Do writes the statement to w as it is read: an opening record, a record for each movement, and a closing record once
+every movement has been written. A statement cut short by an error after its opening record ends with an error record
+instead, so that it cannot be taken for a complete one. The error is returned either way.
+*/
+func (s *ExportAccountStatementService) Do(ctx context.Context, request *models.GetAccountStatementRequest, w StatementRecordWriter) error {
+	exporter := &statementExporter{request: request, w: w}
+	if err := s.StreamAccountStatement(ctx, toAccountStatementParams(request), exporter); err != nil {
+		if exporter.account != nil {
+			record := exporter.record(StatementError, time.Now())
+			record.Error = err.Error()
+			// The error of the statement is the one returned, whether or not its record could be written
+			_ = w.Write(record)
+		}
+		return err
+	}
+	return exporter.close()
+}
+
+// statementExporter turns the entries of a statement into records, keeping the running balance
+type statementExporter struct {
+	request *models.GetAccountStatementRequest
+	w       StatementRecordWriter
+	account *db.Account
+	balance util.Money
+}
+
+func (e *statementExporter) Open(account *db.Account, openingBalance util.Money) error {
+	e.account, e.balance = account, openingBalance
+	from := e.request.From
+	if from.IsZero() {
+		from = account.CreatedAt
+	}
+	return e.w.Write(e.record(StatementOpening, from))
+}
+
+func (e *statementExporter) Entry(entry *db.ListAccountStatementEntriesRow) error {
+	var err error
+	e.balance, err = e.balance.Add(entry.Amount)
+	if err != nil {
+		return err
+	}
+	record := e.record(StatementMovement, entry.CreatedAt)
+	amount := util.CurrencyAmount(entry.Amount, e.account.Currency)
+	record.TransactionID = entry.TransactionID
+	record.CounterpartyAccountID = counterparty(entry)
+	record.Amount = &amount
+	record.Description = entry.Description
+	record.ExternalReference = entry.ExternalReference
+	return e.w.Write(record)
+}
+
+func (e *statementExporter) close() error {
+	return e.w.Write(e.record(StatementClosing, e.request.To))
+}
+
+func (e *statementExporter) record(recordType string, at time.Time) *models.StatementRecord {
+	return &models.StatementRecord{
+		Type:      recordType,
+		AccountID: e.account.ID,
+		Currency:  e.account.Currency,
+		Time:      at,
+		Balance:   util.CurrencyAmount(e.balance, e.account.Currency),
+	}
+}
+
+func validateStatementPeriod(request *models.GetAccountStatementRequest) error {
+	if !request.From.IsZero() && !request.To.IsZero() && !request.From.Before(request.To) {
+		return util.NewInvalidTimeRangeError()
+	}
+	return nil
+}
+
+// counterparty is the account that a debit went to, which is the destination of its transaction, or that a credit came from
+func counterparty(entry *db.ListAccountStatementEntriesRow) int64 {
+	if entry.Amount.Sign() < 0 {
+		return entry.DestinationAccountID.Int64
+	}
+	return entry.SourceAccountID
+}
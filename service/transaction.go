@@ -3,8 +3,11 @@ package service
 import (
 	"context"
 	"errors"
+	"math"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 
 	"transfers/api/models"
 	db "transfers/db/sqlc"
@@ -13,49 +16,551 @@ import (
 
 type CreateTransactionService struct {
 	db.Store
+	Strategy db.TransferStrategy
+	// Rounding of amounts converted into the destination currency
+	Rounding util.RoundingMode
 }
 
 func (s *CreateTransactionService) Validate(ctx context.Context, request *models.CreateTransactionRequest) error {
-	amount, err := util.StringToAmount(request.Amount)
+	var err error
+	request.SourceAccountID, err = util.ResolveAccountID("source_account", request.SourceAccountID, request.SourceAccountNumber)
 	if err != nil {
 		return err
 	}
-	if amount.Sign() <= 0 { // include 0 value as invalid
-		return util.NewInvalidAmountError(request.Amount)
+	request.DestinationAccountID, err = util.ResolveAccountID("destination_account", request.DestinationAccountID, request.DestinationAccountNumber)
+	if err != nil {
+		return err
+	}
+	if request.Amount.Sign() <= 0 { // include 0 value as invalid
+		return util.NewInvalidAmountError(request.Amount.String())
 	}
-	request.Amount = util.AmountToString(amount)
 	if request.SourceAccountID == request.DestinationAccountID {
 		return util.NewTransactionToSameAccountError(request.SourceAccountID)
 	}
-	_, err = s.GetAccount(ctx, request.SourceAccountID)
+	if err := request.Metadata.Validate(); err != nil {
+		return err
+	}
+	source, err := s.GetAccount(ctx, request.SourceAccountID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return util.NewAccountNotFoundError(request.SourceAccountID)
 		}
 		return util.NewDBError(err)
 	}
-	_, err = s.GetAccount(ctx, request.DestinationAccountID)
+	destination, err := s.GetAccount(ctx, request.DestinationAccountID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return util.NewAccountNotFoundError(request.DestinationAccountID)
 		}
 		return util.NewDBError(err)
 	}
+	if err = source.RequireActive(); err != nil {
+		return err
+	}
+	if err = destination.RequireActive(); err != nil {
+		return err
+	}
+
+	// Amounts are in the currency of the source account
+	if request.Currency != "" && request.Currency != source.Currency {
+		return util.NewAccountCurrencyMismatchError(source.ID, request.Currency, source.Currency)
+	}
+	if request.DestinationCurrency != "" && request.DestinationCurrency != destination.Currency {
+		return util.NewAccountCurrencyMismatchError(destination.ID, request.DestinationCurrency, destination.Currency)
+	}
+	request.Currency, request.DestinationCurrency = source.Currency, destination.Currency
+	currency, err := util.LookupCurrency(request.Currency)
+	if err != nil {
+		return err
+	}
+	if err = currency.ValidateAmount(*request.Amount); err != nil {
+		return err
+	}
+	amount := request.Amount.Rescale(util.MoneyScale, util.RoundDown)
+	request.Amount = &amount
+
+	if request.FxRate == "" {
+		return nil
+	}
+	if request.Currency == request.DestinationCurrency {
+		return util.NewUnexpectedFxRateError(request.Currency)
+	}
+	rate, err := util.ParseFxRate(request.FxRate)
+	if err != nil {
+		return err
+	}
+	request.FxRate = util.FxRateToString(rate)
 	return nil
 }
 
 func (s *CreateTransactionService) Do(ctx context.Context, request *models.CreateTransactionRequest) (*models.CreateTransactionResponse, error) {
-	transaction, err := s.CreateTransactionWithSSI(ctx, &db.CreateTransactionParams{
+	param, err := toCreateTransactionParams(ctx, s.Store, s.Rounding, request)
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := s.Strategy.Transfer(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+	return toCreateTransactionResponse(transaction), nil
+}
+
+// toCreateTransactionParams builds the transfer of a validated request, converted into the destination currency if needed
+func toCreateTransactionParams(ctx context.Context, store db.Store, rounding util.RoundingMode, request *models.CreateTransactionRequest) (*db.CreateTransactionParams, error) {
+	param := &db.CreateTransactionParams{
 		SourceAccountID:      request.SourceAccountID,
 		DestinationAccountID: request.DestinationAccountID,
-		Amount:               request.Amount,
-	})
+		Amount:               *request.Amount,
+		Currency:             request.Currency,
+		DestinationAmount:    *request.Amount,
+		DestinationCurrency:  request.DestinationCurrency,
+		FxRate:               "1",
+		Description:          request.Description,
+		ExternalReference:    request.ExternalReference,
+		Metadata:             request.Metadata,
+	}
+	if request.Currency != request.DestinationCurrency {
+		err := convert(ctx, store, rounding, request.FxRate, param)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return param, nil
+}
+
+func toCreateTransactionResponse(transaction *db.Transaction) *models.CreateTransactionResponse {
+	resp := &models.CreateTransactionResponse{
+		TransactionID:        transaction.ID,
+		SourceAccountID:      transaction.SourceAccountID,
+		DestinationAccountID: transaction.DestinationAccountID.Int64,
+		Amount:               util.CurrencyAmount(transaction.Amount, transaction.Currency),
+		Currency:             transaction.Currency,
+		Description:          transaction.Description,
+		ExternalReference:    transaction.ExternalReference,
+		Metadata:             clientMetadata(transaction.Metadata),
+		CreatedAt:            transaction.CreatedAt,
+	}
+	if transaction.Currency != transaction.DestinationCurrency {
+		destinationAmount := util.CurrencyAmount(transaction.DestinationAmount, transaction.DestinationCurrency)
+		resp.DestinationAmount = &destinationAmount
+		resp.DestinationCurrency = transaction.DestinationCurrency
+		resp.FxRate = transaction.FxRate
+	}
+	return resp
+}
+
+type CreateMultiLegTransactionService struct {
+	db.Store
+}
+
+func (s *CreateMultiLegTransactionService) Validate(ctx context.Context, request *models.CreateMultiLegTransactionRequest) error {
+	var err error
+	request.SourceAccountID, err = util.ResolveAccountID("source_account", request.SourceAccountID, request.SourceAccountNumber)
+	if err != nil {
+		return err
+	}
+	if request.Amount.Sign() <= 0 {
+		return util.NewInvalidAmountError(request.Amount.String())
+	}
+	source, err := s.GetAccount(ctx, request.SourceAccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return util.NewAccountNotFoundError(request.SourceAccountID)
+		}
+		return util.NewDBError(err)
+	}
+	if err = source.RequireActive(); err != nil {
+		return err
+	}
+	if request.Currency != "" && request.Currency != source.Currency {
+		return util.NewAccountCurrencyMismatchError(source.ID, request.Currency, source.Currency)
+	}
+	request.Currency = source.Currency
+	currency, err := util.LookupCurrency(request.Currency)
+	if err != nil {
+		return err
+	}
+	if err = currency.ValidateAmount(*request.Amount); err != nil {
+		return err
+	}
+	amount := request.Amount.Rescale(util.MoneyScale, util.RoundDown)
+	request.Amount = &amount
+
+	// Legs are credited in the currency of the source account, and must add up to the debit
+	var credits util.Money
+	for _, leg := range request.Legs {
+		leg.AccountID, err = util.ResolveAccountID("account", leg.AccountID, leg.AccountNumber)
+		if err != nil {
+			return err
+		}
+		if leg.Amount.Sign() <= 0 {
+			return util.NewInvalidAmountError(leg.Amount.String())
+		}
+		if leg.AccountID == request.SourceAccountID {
+			return util.NewTransactionToSameAccountError(leg.AccountID)
+		}
+		account, err := s.GetAccount(ctx, leg.AccountID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return util.NewAccountNotFoundError(leg.AccountID)
+			}
+			return util.NewDBError(err)
+		}
+		if err = account.RequireActive(); err != nil {
+			return err
+		}
+		if account.Currency != request.Currency {
+			return util.NewAccountCurrencyMismatchError(account.ID, request.Currency, account.Currency)
+		}
+		if err = currency.ValidateAmount(*leg.Amount); err != nil {
+			return err
+		}
+		legAmount := leg.Amount.Rescale(util.MoneyScale, util.RoundDown)
+		leg.Amount = &legAmount
+		credits, err = credits.Add(legAmount)
+		if err != nil {
+			return err
+		}
+	}
+	if credits.Cmp(amount) != 0 {
+		return util.NewUnbalancedLegsError(amount.String(), credits.String())
+	}
+	return nil
+}
+
+func (s *CreateMultiLegTransactionService) Do(ctx context.Context, request *models.CreateMultiLegTransactionRequest) (*models.GetTransactionResponse, error) {
+	param := &db.MultiLegTransferParams{
+		SourceAccountID: request.SourceAccountID,
+		Amount:          *request.Amount,
+		Currency:        request.Currency,
+	}
+	for _, leg := range request.Legs {
+		param.Legs = append(param.Legs, &db.TransactionLeg{
+			AccountID: leg.AccountID,
+			Amount:    *leg.Amount,
+		})
+	}
+	transaction, err := s.CreateMultiLegTransfer(ctx, param)
 	if err != nil {
 		return nil, err
 	}
-	return &models.CreateTransactionResponse{
+	resp := toGetTransactionResponse(transaction)
+	resp.Legs = append(resp.Legs, &models.TransactionLegResponse{
+		AccountID: transaction.SourceAccountID,
+		Amount:    util.CurrencyAmount(transaction.Amount.Neg(), transaction.Currency),
+		Currency:  transaction.Currency,
+	})
+	for _, leg := range param.Legs {
+		resp.Legs = append(resp.Legs, &models.TransactionLegResponse{
+			AccountID: leg.AccountID,
+			Amount:    util.CurrencyAmount(leg.Amount, transaction.Currency),
+			Currency:  transaction.Currency,
+		})
+	}
+	return resp, nil
+}
+
+/*
+convert locks param to the FX rate published at this moment, or quotedRate when none is published, and sets the
+destination amount of param rounded to the destination currency with rounding.
+A quoted rate that no longer matches the published rate is rejected, so the client can get a new quote.
+*/
+func convert(ctx context.Context, store db.Store, rounding util.RoundingMode, quotedRate string, param *db.CreateTransactionParams) error {
+	rate, rateID, found, err := publishedFxRate(ctx, store, param.Currency, param.DestinationCurrency, time.Now())
+	if err != nil {
+		return err
+	}
+	switch {
+	case !found && quotedRate == "":
+		return util.NewCurrencyMismatchError(param.Currency, param.DestinationCurrency)
+	case !found:
+		rate, err = util.ParseFxRate(quotedRate)
+		if err != nil {
+			return err
+		}
+	case quotedRate != "" && quotedRate != util.FxRateToString(rate):
+		return util.NewFxRateChangedError(quotedRate, util.FxRateToString(rate))
+	}
+
+	currency, err := util.LookupCurrency(param.DestinationCurrency)
+	if err != nil {
+		return err
+	}
+	converted, err := currency.Convert(param.Amount, rate, rounding)
+	if err != nil {
+		return err
+	}
+	if converted.Sign() <= 0 {
+		return util.NewInvalidAmountError(param.Amount.String())
+	}
+	param.DestinationAmount = converted.Rescale(util.MoneyScale, util.RoundDown)
+	param.FxRate = util.FxRateToString(rate)
+	param.FxRateID = rateID
+	return nil
+}
+
+type GetTransactionService struct {
+	db.Store
+}
+
+func (s *GetTransactionService) Validate(ctx context.Context, request *models.GetTransactionRequest) error {
+	return nil
+}
+
+func (s *GetTransactionService) Do(ctx context.Context, request *models.GetTransactionRequest) (*models.GetTransactionResponse, error) {
+	transaction, err := s.GetTransaction(ctx, request.TransactionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, util.NewTransactionNotFoundError(request.TransactionID)
+		}
+		return nil, util.NewDBError(err)
+	}
+	resp := toGetTransactionResponse(transaction)
+	if !transaction.DestinationAccountID.Valid {
+		// Multi-leg transactions are made of their entries, and cannot be reversed
+		entries, err := s.ListEntriesByTransaction(ctx, transaction.ID)
+		if err != nil {
+			return nil, util.NewDBError(err)
+		}
+		for _, entry := range entries {
+			resp.Legs = append(resp.Legs, &models.TransactionLegResponse{
+				AccountID: entry.AccountID.Int64,
+				Amount:    util.CurrencyAmount(entry.Amount, entry.Currency),
+				Currency:  entry.Currency,
+			})
+		}
+		return resp, nil
+	}
+	if transaction.ReversalOf.Valid {
+		return resp, nil
+	}
+
+	// Only original transactions can have reversals
+	reversals, err := s.ListReversals(ctx, pgtype.Int8{Int64: transaction.ID, Valid: true})
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	// Reversals credit the original source account, so their destination amounts are in its currency
+	var reversed util.Money
+	for _, reversal := range reversals {
+		reversed, err = reversed.Add(reversal.DestinationAmount)
+		if err != nil {
+			return nil, err
+		}
+		resp.Reversals = append(resp.Reversals, toGetTransactionResponse(reversal))
+	}
+	reversed = util.CurrencyAmount(reversed, transaction.Currency)
+	resp.ReversedAmount = &reversed
+	return resp, nil
+}
+
+func toGetTransactionResponse(transaction *db.Transaction) *models.GetTransactionResponse {
+	resp := &models.GetTransactionResponse{
+		TransactionID:        transaction.ID,
 		SourceAccountID:      transaction.SourceAccountID,
-		DestinationAccountID: transaction.DestinationAccountID,
-		Amount:               transaction.Amount,
-	}, nil
+		DestinationAccountID: transaction.DestinationAccountID.Int64,
+		Amount:               util.CurrencyAmount(transaction.Amount, transaction.Currency),
+		Currency:             transaction.Currency,
+		Description:          transaction.Description,
+		ExternalReference:    transaction.ExternalReference,
+		Metadata:             clientMetadata(transaction.Metadata),
+		CreatedAt:            transaction.CreatedAt,
+		ReversalOf:           transaction.ReversalOf.Int64,
+	}
+	if transaction.Currency != transaction.DestinationCurrency {
+		destinationAmount := util.CurrencyAmount(transaction.DestinationAmount, transaction.DestinationCurrency)
+		resp.DestinationAmount = &destinationAmount
+		resp.DestinationCurrency = transaction.DestinationCurrency
+		resp.FxRate = transaction.FxRate
+	}
+	return resp
+}
+
+// clientMetadata returns the metadata given by the client, leaving out the empty object stored when none was given
+func clientMetadata(metadata util.Metadata) util.Metadata {
+	if string(metadata) == "{}" {
+		return nil
+	}
+	return metadata
+}
+
+type CreateReversalService struct {
+	db.Store
+	// Rounding of the share of the destination amount taken back by partial reversals
+	Rounding util.RoundingMode
+}
+
+func (s *CreateReversalService) Validate(ctx context.Context, request *models.CreateReversalRequest) error {
+	if request.Amount == nil {
+		return nil // reverse the remaining amount
+	}
+	if request.Amount.Sign() <= 0 {
+		return util.NewInvalidAmountError(request.Amount.String())
+	}
+	amount := request.Amount.Rescale(util.MoneyScale, util.RoundDown)
+	request.Amount = &amount
+	return nil
+}
+
+func (s *CreateReversalService) Do(ctx context.Context, request *models.CreateReversalRequest) (*models.CreateReversalResponse, error) {
+	reversal, err := s.ReverseTransaction(ctx, &db.ReverseTransactionParams{
+		TransactionID: request.TransactionID,
+		Amount:        request.Amount,
+		Rounding:      s.Rounding,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.CreateReversalResponse{
+		TransactionID:        reversal.ID,
+		ReversalOf:           reversal.ReversalOf.Int64,
+		SourceAccountID:      reversal.SourceAccountID,
+		DestinationAccountID: reversal.DestinationAccountID.Int64,
+		Amount:               util.CurrencyAmount(reversal.Amount, reversal.Currency),
+		Currency:             reversal.Currency,
+		CreatedAt:            reversal.CreatedAt,
+	}
+	if reversal.Currency != reversal.DestinationCurrency {
+		destinationAmount := util.CurrencyAmount(reversal.DestinationAmount, reversal.DestinationCurrency)
+		resp.DestinationAmount = &destinationAmount
+		resp.DestinationCurrency = reversal.DestinationCurrency
+		resp.FxRate = reversal.FxRate
+	}
+	return resp, nil
+}
+
+type ListTransactionsService struct {
+	db.Store
+}
+
+func (s *ListTransactionsService) Validate(ctx context.Context, request *models.ListTransactionsRequest) error {
+	if request.Cursor != "" {
+		if _, err := util.DecodeCursor(request.Cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Do returns a page of the transactions with the external reference, newest first
+func (s *ListTransactionsService) Do(ctx context.Context, request *models.ListTransactionsRequest) (*models.ListTransactionsResponse, error) {
+	param := &db.ListTransactionsByExternalReferenceParams{
+		ExternalReference: request.ExternalReference,
+		BeforeID:          math.MaxInt64,
+		PageSize:          defaultPageSize,
+	}
+	if request.Cursor != "" {
+		param.BeforeID, _ = util.DecodeCursor(request.Cursor)
+	}
+	if request.Limit > 0 {
+		param.PageSize = request.Limit
+	}
+	pageSize := param.PageSize
+	param.PageSize++ // fetch one extra row to know whether there is a next page
+
+	transactions, err := s.ListTransactionsByExternalReference(ctx, param)
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	resp := &models.ListTransactionsResponse{
+		Transactions: make([]*models.GetTransactionResponse, 0, len(transactions)),
+	}
+	if len(transactions) > int(pageSize) {
+		transactions = transactions[:pageSize]
+		resp.NextCursor = util.EncodeCursor(transactions[pageSize-1].ID)
+	}
+	for _, transaction := range transactions {
+		resp.Transactions = append(resp.Transactions, toGetTransactionResponse(transaction))
+	}
+	return resp, nil
+}
+
+const defaultPageSize = 20
+
+var maxTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+type ListAccountTransactionsService struct {
+	db.Store
+}
+
+func (s *ListAccountTransactionsService) Validate(ctx context.Context, request *models.ListAccountTransactionsRequest) error {
+	if request.Cursor != "" {
+		if _, err := util.DecodeCursor(request.Cursor); err != nil {
+			return err
+		}
+	}
+	if !request.From.IsZero() && !request.To.IsZero() && !request.From.Before(request.To) {
+		return util.NewInvalidTimeRangeError()
+	}
+	lower, upper := util.Money{}, util.MaxMoney
+	if request.MinAmount != nil {
+		lower = request.MinAmount.Rescale(util.MoneyScale, util.RoundDown)
+		request.MinAmount = &lower
+	}
+	if request.MaxAmount != nil {
+		upper = request.MaxAmount.Rescale(util.MoneyScale, util.RoundDown)
+		request.MaxAmount = &upper
+	}
+	if lower.Sign() < 0 || upper.Cmp(lower) < 0 {
+		return util.NewInvalidAmountRangeError(lower.String(), upper.String())
+	}
+	_, err := s.GetAccount(ctx, request.AccountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return util.NewAccountNotFoundError(request.AccountID)
+		}
+		return util.NewDBError(err)
+	}
+	return nil
+}
+
+/*
+Do returns a page of an account's transactions, newest first. The cursor is the last transaction ID of the previous
+page, so pages stay stable while new transactions are created.
+*/
+func (s *ListAccountTransactionsService) Do(ctx context.Context, request *models.ListAccountTransactionsRequest) (*models.ListAccountTransactionsResponse, error) {
+	param := &db.ListAccountTransactionsParams{
+		Incoming:  request.Direction != "outgoing",
+		AccountID: request.AccountID,
+		Outgoing:  request.Direction != "incoming",
+		BeforeID:  math.MaxInt64,
+		FromTime:  request.From,
+		ToTime:    maxTime,
+		MinAmount: util.Money{},
+		MaxAmount: util.MaxMoney,
+		PageSize:  defaultPageSize,
+	}
+	if request.Cursor != "" {
+		param.BeforeID, _ = util.DecodeCursor(request.Cursor)
+	}
+	if !request.To.IsZero() {
+		param.ToTime = request.To
+	}
+	if request.MinAmount != nil {
+		param.MinAmount = *request.MinAmount
+	}
+	if request.MaxAmount != nil {
+		param.MaxAmount = *request.MaxAmount
+	}
+	if request.Limit > 0 {
+		param.PageSize = request.Limit
+	}
+	pageSize := param.PageSize
+	param.PageSize++ // fetch one extra row to know whether there is a next page
+
+	transactions, err := s.ListAccountTransactions(ctx, param)
+	if err != nil {
+		return nil, util.NewDBError(err)
+	}
+	resp := &models.ListAccountTransactionsResponse{
+		Transactions: make([]*models.GetTransactionResponse, 0, len(transactions)),
+	}
+	if len(transactions) > int(pageSize) {
+		transactions = transactions[:pageSize]
+		resp.NextCursor = util.EncodeCursor(transactions[pageSize-1].ID)
+	}
+	for _, transaction := range transactions {
+		resp.Transactions = append(resp.Transactions, toGetTransactionResponse(transaction))
+	}
+	return resp, nil
 }
@@ -7,17 +7,71 @@ import (
 	"math/big"
 	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/require"
 
 	"transfers/db/sqlc"
+	"transfers/util"
 )
 
 func GenerateAccount() *db.Account {
-	balance := big.NewRat(int64(rand.Intn(1000000000)), 10000)
+	balance := big.NewRat(int64(rand.Intn(1000000000)), 100)
 	return &db.Account{
-		ID:      int64(rand.Intn(1000)),
-		Balance: balance.FloatString(5),
+		ID:           int64(rand.Intn(1000) + 1),
+		Balance:      util.MustParseMoney(balance.FloatString(5)),
+		Currency:     "USD",
+		Version:      int64(rand.Intn(100)),
+		Status:       db.AccountActive,
+		Type:         db.AccountCash,
+		BalanceFloor: &util.Money{},
+	}
+}
+
+func GenerateTransaction() *db.Transaction {
+	amount := big.NewRat(int64(rand.Intn(1000000)+1), 100)
+	return &db.Transaction{
+		ID:                   int64(rand.Intn(1000) + 1),
+		SourceAccountID:      int64(rand.Intn(1000) + 1),
+		DestinationAccountID: pgtype.Int8{Int64: int64(rand.Intn(1000) + 1001), Valid: true},
+		Amount:               util.MustParseMoney(amount.FloatString(5)),
+		Currency:             "USD",
+		DestinationAmount:    util.MustParseMoney(amount.FloatString(5)),
+		DestinationCurrency:  "USD",
+		FxRate:               "1",
+		CreatedAt:            time.Now(),
+	}
+}
+
+func GenerateHold() *db.Hold {
+	amount := big.NewRat(int64(rand.Intn(1000000)+1), 100)
+	return &db.Hold{
+		ID:                   int64(rand.Intn(1000) + 1),
+		AccountID:            int64(rand.Intn(1000) + 1),
+		DestinationAccountID: int64(rand.Intn(1000) + 1001),
+		Amount:               util.MustParseMoney(amount.FloatString(5)),
+		Currency:             "USD",
+		Status:               db.HoldActive,
+		ExpiresAt:            time.Now().Add(time.Hour),
+		CreatedAt:            time.Now(),
+	}
+}
+
+func GenerateScheduledTransfer() *db.ScheduledTransfer {
+	amount := big.NewRat(int64(rand.Intn(1000000)+1), 100)
+	startAt := time.Now().Add(time.Hour)
+	return &db.ScheduledTransfer{
+		ID:                   int64(rand.Intn(1000) + 1),
+		SourceAccountID:      int64(rand.Intn(1000) + 1),
+		DestinationAccountID: int64(rand.Intn(1000) + 1001),
+		Amount:               util.MustParseMoney(amount.FloatString(5)),
+		Currency:             "USD",
+		Recurrence:           db.RecurrenceOnce,
+		StartAt:              startAt,
+		NextRunAt:            pgtype.Timestamptz{Time: startAt, Valid: true},
+		Status:               db.ScheduleActive,
+		CreatedAt:            time.Now(),
 	}
 }
 
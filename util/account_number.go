@@ -0,0 +1,75 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Account numbers are the account ID, zero-padded to at least accountNumberDigits digits, followed by a Luhn check digit
+const accountNumberDigits = 10
+
+// AccountNumber returns the human-facing number of the account with id
+func AccountNumber(id int64) string {
+	payload := fmt.Sprintf("%0*d", accountNumberDigits, id)
+	return payload + string(luhnCheckDigit(payload))
+}
+
+// ParseAccountNumber returns the account ID of number, checking its check digit to catch mistyped numbers
+func ParseAccountNumber(number string) (int64, error) {
+	// At most the 19 digits of an int64 and the check digit
+	if len(number) <= accountNumberDigits || len(number) > 20 {
+		return 0, NewInvalidAccountNumberError(number)
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return 0, NewInvalidAccountNumberError(number)
+		}
+	}
+	payload, check := number[:len(number)-1], number[len(number)-1]
+	if luhnCheckDigit(payload) != check {
+		return 0, NewInvalidAccountNumberError(number)
+	}
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil || id <= 0 || AccountNumber(id) != number {
+		return 0, NewInvalidAccountNumberError(number)
+	}
+	return id, nil
+}
+
+/*
+ResolveAccountID returns the account that a request names by its ID, by its account number, or by both when they
+agree. field is the name of the account in the request, such as "source_account", whose _id or _number is required.
+*/
+func ResolveAccountID(field string, id int64, number string) (int64, error) {
+	if number == "" {
+		if id == 0 {
+			return 0, NewAccountRequiredError(field)
+		}
+		return id, nil
+	}
+	numbered, err := ParseAccountNumber(number)
+	if err != nil {
+		return 0, err
+	}
+	if id != 0 && id != numbered {
+		return 0, NewAccountNumberMismatchError(field, id, number)
+	}
+	return numbered, nil
+}
+
+// luhnCheckDigit returns the digit that makes payload followed by it pass the Luhn check
+func luhnCheckDigit(payload string) byte {
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		digit := int(payload[i] - '0')
+		// Every second digit from the right is doubled, starting with the one next to the check digit
+		if (len(payload)-i)%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
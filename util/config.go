@@ -0,0 +1,78 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type Config struct {
+	DBSource              string                 `mapstructure:"dbSource"`
+	ServerAddress         string                 `mapstructure:"serverAddress"`
+	AdminAddress          string                 `mapstructure:"adminAddress"`
+	IdempotencyKeyTTL     time.Duration          `mapstructure:"idempotencyKeyTTL"`
+	TransferStrategy      string                 `mapstructure:"transferStrategy"`
+	TransferRetryPolicies map[string]RetryPolicy `mapstructure:"transferRetryPolicies"`
+	FxRatesFile           string                 `mapstructure:"fxRatesFile"`
+	FxRounding            string                 `mapstructure:"fxRounding"`
+	HoldTTL               time.Duration          `mapstructure:"holdTTL"`
+	HoldExpiryInterval    time.Duration          `mapstructure:"holdExpiryInterval"`
+
+	ScheduledTransferInterval    time.Duration `mapstructure:"scheduledTransferInterval"`
+	ScheduledTransferRetryPolicy RetryPolicy   `mapstructure:"scheduledTransferRetryPolicy"`
+}
+
+// RetryPolicy controls how transfers that conflict with concurrent transfers are retried.
+// The nth retry waits InitialBackoff * 2^n, up to MaxBackoff when set, plus a random duration of up to RandomBackoff.
+type RetryPolicy struct {
+	MaxRetries     int           `mapstructure:"maxRetries"`
+	InitialBackoff time.Duration `mapstructure:"initialBackoff"`
+	MaxBackoff     time.Duration `mapstructure:"maxBackoff"`
+	RandomBackoff  time.Duration `mapstructure:"randomBackoff"`
+}
+
+// Backoff returns how long to wait before the nth retry, counting from 0. The doubling stops at MaxBackoff, or before
+// the wait would overflow.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	limit := p.MaxBackoff
+	if limit <= 0 {
+		limit = math.MaxInt64 - p.RandomBackoff
+	}
+	wait := p.InitialBackoff
+	for i := 0; i < retry && wait > 0 && wait < limit; i++ {
+		if wait > limit/2 {
+			wait = limit
+		} else {
+			wait *= 2
+		}
+	}
+	if wait > limit {
+		wait = limit
+	}
+	if p.RandomBackoff > 0 {
+		wait += time.Duration(rand.Int63n(int64(p.RandomBackoff)))
+	}
+	return wait
+}
+
+// LoadConfig reads config.yaml from path, falling back to defaults for optional settings
+func LoadConfig(path string) (config Config, err error) {
+	viper.AddConfigPath(path)
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.SetDefault("idempotencyKeyTTL", "24h")
+	viper.SetDefault("transferStrategy", "ssi")
+	viper.SetDefault("fxRounding", string(RoundHalfEven))
+	viper.SetDefault("holdTTL", "168h")
+	viper.SetDefault("holdExpiryInterval", "1m")
+	viper.SetDefault("scheduledTransferInterval", "1m")
+
+	err = viper.ReadInConfig()
+	if err != nil {
+		return
+	}
+	err = viper.Unmarshal(&config)
+	return
+}
@@ -0,0 +1,192 @@
+package util
+
+import (
+	"math/big"
+)
+
+// DefaultCurrency is used for accounts created without a currency
+const DefaultCurrency = "USD"
+
+// FxRateScale is the number of decimal places kept for FX rates, matching the numeric(20,10) column
+const FxRateScale = 10
+
+// Currency is an ISO 4217 currency, with the number of decimal places its amounts can have
+type Currency struct {
+	Code       string
+	MinorUnits int
+}
+
+// currencies supported by the system, keyed by ISO 4217 code
+var currencies = map[string]Currency{}
+
+func init() {
+	for minorUnits, codes := range map[int][]string{
+		0: {"CLP", "ISK", "JPY", "KRW", "PYG", "RWF", "UGX", "VND", "XAF", "XOF"},
+		2: {"AED", "AUD", "BRL", "CAD", "CHF", "CNY", "DKK", "EUR", "GBP", "HKD", "IDR", "INR", "MXN", "MYR",
+			"NOK", "NZD", "PHP", "SAR", "SEK", "SGD", "THB", "TWD", "USD", "ZAR"},
+		3: {"BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND"},
+	} {
+		for _, code := range codes {
+			currencies[code] = Currency{Code: code, MinorUnits: minorUnits}
+		}
+	}
+}
+
+func LookupCurrency(code string) (Currency, error) {
+	currency, ok := currencies[code]
+	if !ok {
+		return Currency{}, NewUnknownCurrencyError(code)
+	}
+	return currency, nil
+}
+
+// ValidateAmount rejects amounts with more decimal places than the currency has
+func (c Currency) ValidateAmount(amount Money) error {
+	if amount.Rescale(c.MinorUnits, RoundDown).Cmp(amount) != 0 {
+		return NewInvalidPrecisionError(amount.String(), c.Code, c.MinorUnits)
+	}
+	return nil
+}
+
+// Round rounds amount half to even to the number of decimal places of the currency
+func (c Currency) Round(amount Money) Money {
+	return amount.Rescale(c.MinorUnits, RoundHalfEven)
+}
+
+// RoundWith rounds amount to the number of decimal places of the currency with mode
+func (c Currency) RoundWith(amount big.Rat, mode RoundingMode) (Money, error) {
+	return MoneyFromRat(&amount, c.MinorUnits, mode)
+}
+
+// Convert converts amount at rate into the currency, rounding to its decimal places with mode
+func (c Currency) Convert(amount Money, rate big.Rat, mode RoundingMode) (Money, error) {
+	return amount.Mul(&rate, c.MinorUnits, mode)
+}
+
+// CurrencyAmount returns a stored amount with the decimal places of currency.
+// Amounts in an unknown currency are returned as they are.
+func CurrencyAmount(amount Money, currency string) Money {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return amount
+	}
+	return c.Round(amount)
+}
+
+/*
+BalanceRounding rounds a running balance and its movements to the decimal places of a currency, for statement formats
+that cannot carry the MoneyScale decimal places of stored amounts. A movement is rounded as the difference between
+the rounded balances around it, not on its own, so that rounded movements add up to the rounded balance and a balance
+is rounded the same at the end of a statement and at the start of the next one. The sub-unit part of the balance left
+out by rounding is its residual.
+*/
+type BalanceRounding struct {
+	currency Currency
+	balance  Money
+	rounded  Money
+}
+
+func NewBalanceRounding(currency string, opening Money) (*BalanceRounding, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	return &BalanceRounding{currency: c, balance: opening, rounded: c.Round(opening)}, nil
+}
+
+// Balance returns the balance rounded to the decimal places of the currency
+func (r *BalanceRounding) Balance() Money {
+	return r.rounded
+}
+
+// Add moves the balance by amount, returning the movement of the rounded balance
+func (r *BalanceRounding) Add(amount Money) (Money, error) {
+	balance, err := r.balance.Add(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	rounded := r.currency.Round(balance)
+	movement, err := rounded.Sub(r.rounded)
+	if err != nil {
+		return Money{}, err
+	}
+	r.balance, r.rounded = balance, rounded
+	return movement, nil
+}
+
+// Residual returns the balance less the rounded balance, with MoneyScale decimal places
+func (r *BalanceRounding) Residual() Money {
+	residual, _ := r.balance.Sub(r.rounded) // cannot overflow, the difference is less than a unit of the currency
+	return residual.Rescale(MoneyScale, RoundHalfEven)
+}
+
+// ParseFxRate parses a positive FX rate with at most FxRateScale decimal places
+func ParseFxRate(val string) (big.Rat, error) {
+	rate, ok := parseRat(val)
+	if !ok || rate.Sign() <= 0 || !hasScale(rate, FxRateScale) {
+		return rate, NewInvalidFxRateError(val)
+	}
+	return rate, nil
+}
+
+func FxRateToString(rate big.Rat) string {
+	return rate.FloatString(FxRateScale)
+}
+
+// hasScale reports whether amount has at most scale decimal places
+func hasScale(amount big.Rat, scale int) bool {
+	scaled := new(big.Rat).Mul(&amount, new(big.Rat).SetInt(pow10(scale)))
+	return scaled.IsInt()
+}
+
+// RoundingMode decides which way amounts that fall between two representable values are rounded
+type RoundingMode string
+
+const (
+	RoundHalfEven RoundingMode = "half_even" // to the nearest value, ties to the even one
+	RoundHalfUp   RoundingMode = "half_up"   // to the nearest value, ties away from zero
+	RoundDown     RoundingMode = "down"      // towards zero
+	RoundUp       RoundingMode = "up"        // away from zero
+)
+
+func ParseRoundingMode(val string) (RoundingMode, error) {
+	switch mode := RoundingMode(val); mode {
+	case RoundHalfEven, RoundHalfUp, RoundDown, RoundUp:
+		return mode, nil
+	default:
+		return "", NewUnknownRoundingModeError(val)
+	}
+}
+
+func round(amount big.Rat, scale int, mode RoundingMode) big.Rat {
+	factor := pow10(scale)
+	numerator := new(big.Int).Mul(amount.Num(), factor)
+	quotient, remainder := new(big.Int).QuoRem(numerator, amount.Denom(), new(big.Int))
+
+	// Compare the dropped fraction with one half
+	twiceRemainder := new(big.Int).Lsh(new(big.Int).Abs(remainder), 1)
+	cmp := twiceRemainder.Cmp(amount.Denom())
+	var away bool
+	switch mode {
+	case RoundDown:
+		away = false
+	case RoundUp:
+		away = remainder.Sign() != 0
+	case RoundHalfUp:
+		away = cmp >= 0
+	default:
+		away = cmp > 0 || (cmp == 0 && quotient.Bit(0) == 1)
+	}
+	if away {
+		if amount.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return *new(big.Rat).SetFrac(quotient, factor)
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
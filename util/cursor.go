@@ -0,0 +1,24 @@
+package util
+
+import (
+	"encoding/base64"
+	"strconv"
+)
+
+// EncodeCursor returns an opaque page cursor for listings ordered by descending id, resuming after id
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// DecodeCursor returns the id encoded by EncodeCursor
+func DecodeCursor(cursor string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, NewInvalidCursorError(cursor)
+	}
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, NewInvalidCursorError(cursor)
+	}
+	return id, nil
+}
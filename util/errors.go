@@ -1,6 +1,8 @@
 package util
 
 import (
+	"time"
+
 	"github.com/joomcode/errorx"
 )
 
@@ -9,11 +11,35 @@ var (
 
 	// Traits
 	PaymentRequired = errorx.RegisterTrait("payment_required")
+	Conflict        = errorx.RegisterTrait("conflict")
+	Unprocessable   = errorx.RegisterTrait("unprocessable")
+	Precondition    = errorx.RegisterTrait("precondition")
 
 	// Types
 	ErrAccountNotFound     = TransfersSystemErrors.NewType("account_not_found", errorx.NotFound())
 	ErrDuplicateAccount    = TransfersSystemErrors.NewType("duplicate_account", errorx.Duplicate())
+	ErrAccountNotActive    = TransfersSystemErrors.NewType("account_not_active", Unprocessable)
+	ErrInvalidStatusChange = TransfersSystemErrors.NewType("invalid_status_change", Unprocessable)
 	ErrInsufficientBalance = TransfersSystemErrors.NewType("insufficient_balance", PaymentRequired)
+	ErrUnbalancedEntries   = TransfersSystemErrors.NewType("unbalanced_entries")
+	ErrTransactionNotFound = TransfersSystemErrors.NewType("transaction_not_found", errorx.NotFound())
+	ErrInvalidReversal     = TransfersSystemErrors.NewType("invalid_reversal", Unprocessable)
+	ErrTransactionConflict = TransfersSystemErrors.NewType("transaction_conflict", Conflict, errorx.Temporary())
+	ErrPreconditionFailed  = TransfersSystemErrors.NewType("precondition_failed", Precondition)
+	ErrCurrencyMismatch    = TransfersSystemErrors.NewType("currency_mismatch", Unprocessable)
+	ErrFxRateChanged       = TransfersSystemErrors.NewType("fx_rate_changed", Conflict)
+	ErrHoldNotFound        = TransfersSystemErrors.NewType("hold_not_found", errorx.NotFound())
+	ErrInvalidHold         = TransfersSystemErrors.NewType("invalid_hold", Unprocessable)
+
+	ErrScheduledTransferNotFound = TransfersSystemErrors.NewType("scheduled_transfer_not_found", errorx.NotFound())
+
+	ErrIdempotencyKeyInProgress = TransfersSystemErrors.NewType("idempotency_key_in_progress", Conflict)
+	ErrIdempotencyKeyMismatch   = TransfersSystemErrors.NewType("idempotency_key_mismatch", Unprocessable)
+
+	// Invalid arguments that callers such as payment status reports tell apart
+	ErrInvalidAmount        = errorx.IllegalArgument.NewSubtype("invalid_amount")
+	ErrInvalidAccountNumber = errorx.IllegalArgument.NewSubtype("invalid_account_number")
+	ErrSameAccount          = errorx.IllegalArgument.NewSubtype("same_account")
 )
 
 func NewDBError(err error) *errorx.Error {
@@ -21,29 +47,248 @@ func NewDBError(err error) *errorx.Error {
 }
 
 func NewInvalidAmountError(val string) *errorx.Error {
-	return errorx.IllegalArgument.New("invalid amount: %s", val)
+	return ErrInvalidAmount.New("invalid amount: %s", val)
+}
+
+func NewAmountOverflowError(val string) *errorx.Error {
+	return ErrInvalidAmount.New("amount out of range: %s", val)
 }
 
 func NewNegativeBalanceError(val string) *errorx.Error {
 	return errorx.IllegalArgument.New("negative balance: %s", val)
 }
 
+func NewBalanceBelowFloorError(val string, floor string) *errorx.Error {
+	return errorx.IllegalArgument.New("balance %s is below the floor of the account: %s", val, floor)
+}
+
+func NewInvalidCreditLimitError(accountType string) *errorx.Error {
+	return errorx.IllegalArgument.New("credit_limit is required for credit accounts, and only allowed for them: %s", accountType)
+}
+
 func NewAccountAlreadyExistsError(id int64) *errorx.Error {
 	return ErrDuplicateAccount.New("account already exists: %d", id)
 }
 
+func NewAccountIDUnavailableError(attempts int) *errorx.Error {
+	return ErrTransactionConflict.New("no free account ID after %d attempts, try again", attempts)
+}
+
 func NewAccountNotFoundError(id int64) *errorx.Error {
 	return ErrAccountNotFound.New("account not found: %d", id)
 }
 
+func NewAccountNotActiveError(id int64, status string) *errorx.Error {
+	return ErrAccountNotActive.New("account %d is %s and cannot be debited or credited", id, status)
+}
+
+func NewAccountClosedError(id int64) *errorx.Error {
+	return ErrInvalidStatusChange.New("account %d is closed and can no longer be changed", id)
+}
+
+func NewAccountNotEmptyError(id int64, balance string, held string) *errorx.Error {
+	return ErrInvalidStatusChange.New("account %d can only be closed at zero balance, has %s with %s held", id, balance, held)
+}
+
+func NewInvalidAccountNumberError(number string) *errorx.Error {
+	return ErrInvalidAccountNumber.New("invalid account number: %q", number)
+}
+
+func NewAccountRequiredError(field string) *errorx.Error {
+	return errorx.IllegalArgument.New("%s_id or %s_number is required", field, field)
+}
+
+func NewAccountNumberMismatchError(field string, id int64, number string) *errorx.Error {
+	return ErrInvalidAccountNumber.New("%s_number %q is not the number of %s_id %d", field, number, field, id)
+}
+
 func NewInvalidIDError(id int64) *errorx.Error {
 	return errorx.IllegalArgument.New("invalid ID: %d", id)
 }
 
 func NewTransactionToSameAccountError(accountId int64) *errorx.Error {
-	return errorx.IllegalArgument.New("invalid transaction with same source and destination account: %d", accountId)
+	return ErrSameAccount.New("invalid transaction with same source and destination account: %d", accountId)
 }
 
 func NewInsufficientBalanceError() *errorx.Error {
 	return ErrInsufficientBalance.New("insufficient balance in debiting account")
 }
+
+func NewUnbalancedEntriesError(currency string, total string) *errorx.Error {
+	return ErrUnbalancedEntries.New("journal entries in %s sum to %s instead of zero", currency, total)
+}
+
+func NewTransactionConflictError(err error) *errorx.Error {
+	return ErrTransactionConflict.Wrap(err, "transaction conflicted with a concurrent transaction")
+}
+
+func NewStaleAccountVersionError(id int64, version int64) *errorx.Error {
+	return ErrTransactionConflict.New("account %d was modified after version %d was read", id, version)
+}
+
+func NewPreconditionFailedError(etag string) *errorx.Error {
+	return ErrPreconditionFailed.New("resource does not match If-Match, current ETag is %s", etag)
+}
+
+func NewUnknownTransferStrategyError(name string) *errorx.Error {
+	return errorx.IllegalArgument.New("unknown transfer strategy: %s", name)
+}
+
+func NewInvalidCursorError(cursor string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid cursor: %s", cursor)
+}
+
+func NewInvalidTimeRangeError() *errorx.Error {
+	return errorx.IllegalArgument.New("invalid time range: from must be before to")
+}
+
+func NewInvalidAmountRangeError(min string, max string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid amount range: %s to %s", min, max)
+}
+
+func NewTransactionNotFoundError(id int64) *errorx.Error {
+	return ErrTransactionNotFound.New("transaction not found: %d", id)
+}
+
+func NewReversalOfReversalError(id int64) *errorx.Error {
+	return ErrInvalidReversal.New("transaction is itself a reversal and cannot be reversed: %d", id)
+}
+
+func NewReversalOfMultiLegError(id int64) *errorx.Error {
+	return ErrInvalidReversal.New("multi-leg transaction cannot be reversed: %d", id)
+}
+
+func NewUnbalancedLegsError(debit string, credits string) *errorx.Error {
+	return errorx.IllegalArgument.New("legs do not net to zero: debit %s, credits %s", debit, credits)
+}
+
+func NewReversalExceedsRemainingError(amount string, remaining string) *errorx.Error {
+	return ErrInvalidReversal.New("reversal amount %s must be positive and at most the unreversed amount %s", amount, remaining)
+}
+
+func NewInvalidIdempotencyKeyError(key string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid idempotency key: %q", key)
+}
+
+func NewIdempotencyKeyInProgressError(key string) *errorx.Error {
+	return ErrIdempotencyKeyInProgress.New("request with idempotency key is still in progress: %s", key)
+}
+
+func NewIdempotencyKeyMismatchError(key string) *errorx.Error {
+	return ErrIdempotencyKeyMismatch.New("idempotency key was used with a different request: %s", key)
+}
+
+func NewUnknownCurrencyError(code string) *errorx.Error {
+	return errorx.IllegalArgument.New("unknown currency: %q", code)
+}
+
+func NewInvalidPrecisionError(amount string, currency string, minorUnits int) *errorx.Error {
+	return ErrInvalidAmount.New("invalid amount %s: %s allows at most %d decimal places", amount, currency, minorUnits)
+}
+
+func NewInvalidFxRateError(val string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid fx rate: %s", val)
+}
+
+func NewUnexpectedFxRateError(currency string) *errorx.Error {
+	return errorx.IllegalArgument.New("fx rate given for transaction between accounts of the same currency: %s", currency)
+}
+
+func NewCurrencyMismatchError(source string, destination string) *errorx.Error {
+	return ErrCurrencyMismatch.New("no fx rate from %s to %s is published or given", source, destination)
+}
+
+func NewAccountCurrencyMismatchError(accountId int64, want string, got string) *errorx.Error {
+	return ErrCurrencyMismatch.New("account %d is in %s, not %s", accountId, got, want)
+}
+
+func NewFxRateChangedError(given string, current string) *errorx.Error {
+	return ErrFxRateChanged.New("fx rate %s no longer matches the current rate %s", given, current)
+}
+
+func NewFxRatePublishedError(base string, quote string, effectiveFrom time.Time, published string, given string) *errorx.Error {
+	return ErrFxRateChanged.New("fx rate %s/%s from %s is already published as %s, not %s",
+		base, quote, effectiveFrom.Format(time.RFC3339), published, given)
+}
+
+func NewUnknownRoundingModeError(mode string) *errorx.Error {
+	return errorx.IllegalArgument.New("unknown rounding mode: %q", mode)
+}
+
+func NewInvalidFxRateRecordError(line int, err error) *errorx.Error {
+	return errorx.IllegalArgument.Wrap(err, "invalid fx rate on line %d", line)
+}
+
+func NewHoldNotFoundError(id int64) *errorx.Error {
+	return ErrHoldNotFound.New("hold not found: %d", id)
+}
+
+func NewHoldNotActiveError(id int64, status string) *errorx.Error {
+	return ErrInvalidHold.New("hold %d is %s and can no longer be captured or voided", id, status)
+}
+
+func NewCaptureExceedsHoldError(amount string, held string) *errorx.Error {
+	return ErrInvalidHold.New("capture amount %s must be positive and at most the held amount %s", amount, held)
+}
+
+func NewInvalidHoldExpiryError(expiresAt time.Time) *errorx.Error {
+	return errorx.IllegalArgument.New("hold expiry must be in the future: %s", expiresAt.Format(time.RFC3339))
+}
+
+func NewScheduledTransferNotFoundError(id int64) *errorx.Error {
+	return ErrScheduledTransferNotFound.New("scheduled transfer not found: %d", id)
+}
+
+func NewInvalidScheduleError(reason string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid schedule: %s", reason)
+}
+
+// NewInvalidTransferError wraps the error of binding a transfer of a batch, which is bound on its own
+func NewInvalidTransferError(err error) *errorx.Error {
+	return errorx.IllegalArgument.Wrap(err, "invalid transfer")
+}
+
+func NewMissingTransferError() *errorx.Error {
+	return errorx.IllegalArgument.New("invalid transfer: null")
+}
+
+// NewBatchTransferError tells which transfer of a batch failed, keeping the type of err so it maps to the same status
+func NewBatchTransferError(index int, err error) *errorx.Error {
+	return errorx.Decorate(err, "transfer %d of batch", index)
+}
+
+func NewInvalidLabelError(key string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid label %q: keys are up to 63 letters, digits, '_', '.' or '-', values up to %d characters", key, maxLabelValueLength)
+}
+
+func NewTooManyLabelsError() *errorx.Error {
+	return errorx.IllegalArgument.New("an account can have at most %d labels", MaxLabels)
+}
+
+func NewInvalidLabelSelectorError(selector string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid label selector %q, expected key:value", selector)
+}
+
+func NewMetadataTooLargeError(size int) *errorx.Error {
+	return errorx.IllegalArgument.New("metadata is %d bytes, at most %d are allowed", size, MaxMetadataSize)
+}
+
+func NewInvalidMetadataError() *errorx.Error {
+	return errorx.IllegalArgument.New("metadata must be a JSON object")
+}
+
+func NewNotAcceptableError(accept string) *errorx.Error {
+	return errorx.IllegalArgument.New("none of the accepted media types is supported: %s", accept)
+}
+
+func NewInvalidMessageIDError(id string, maxLength int) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid message id %q, expected 1 to %d characters", id, maxLength)
+}
+
+func NewTransactionNotOfAccountError(transactionID int64, accountID int64) *errorx.Error {
+	return ErrTransactionNotFound.New("transaction %d made no entries to account %d", transactionID, accountID)
+}
+
+func NewInvalidPaymentFileError(reason string) *errorx.Error {
+	return errorx.IllegalArgument.New("invalid payment file: %s", reason)
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/big"
+	"time"
+)
+
+var fxRatesHeader = []string{"base_currency", "quote_currency", "rate", "effective_from"}
+
+// FxRateRecord is a rate published for converting BaseCurrency into QuoteCurrency from EffectiveFrom onwards
+type FxRateRecord struct {
+	BaseCurrency  string
+	QuoteCurrency string
+	Rate          string
+	EffectiveFrom time.Time
+}
+
+/*
+ReadFxRatesCSV reads rates from CSV with the header base_currency,quote_currency,rate,effective_from.
+Rates are quote currency units per base currency unit, and effective_from is an RFC 3339 timestamp, e.g.
+
+	base_currency,quote_currency,rate,effective_from
+	USD,JPY,150.25,2024-01-01T00:00:00Z
+*/
+func ReadFxRatesCSV(r io.Reader) ([]FxRateRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(fxRatesHeader)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, NewInvalidFxRateRecordError(1, err)
+	}
+	for i, field := range fxRatesHeader {
+		if header[i] != field {
+			return nil, NewInvalidFxRateRecordError(1, errors.New("expected header "+field+", got "+header[i]))
+		}
+	}
+
+	var records []FxRateRecord
+	for line := 2; ; line++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, NewInvalidFxRateRecordError(line, err)
+		}
+		record, err := parseFxRateRecord(fields)
+		if err != nil {
+			return nil, NewInvalidFxRateRecordError(line, err)
+		}
+		records = append(records, record)
+	}
+}
+
+func parseFxRateRecord(fields []string) (FxRateRecord, error) {
+	base, err := LookupCurrency(fields[0])
+	if err != nil {
+		return FxRateRecord{}, err
+	}
+	quote, err := LookupCurrency(fields[1])
+	if err != nil {
+		return FxRateRecord{}, err
+	}
+	if base == quote {
+		return FxRateRecord{}, NewUnexpectedFxRateError(base.Code)
+	}
+	rate, err := ParseFxRate(fields[2])
+	if err != nil {
+		return FxRateRecord{}, err
+	}
+	effectiveFrom, err := time.Parse(time.RFC3339, fields[3])
+	if err != nil {
+		return FxRateRecord{}, err
+	}
+	return FxRateRecord{
+		BaseCurrency:  base.Code,
+		QuoteCurrency: quote.Code,
+		Rate:          FxRateToString(rate),
+		EffectiveFrom: effectiveFrom,
+	}, nil
+}
+
+// InvertFxRate returns the rate for converting in the opposite direction, rounded half to even to FxRateScale
+func InvertFxRate(rate big.Rat) big.Rat {
+	return round(*new(big.Rat).Inv(&rate), FxRateScale, RoundHalfEven)
+}
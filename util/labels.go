@@ -0,0 +1,46 @@
+package util
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Label keys start with a letter or digit, and are followed by letters, digits, '_', '.' or '-'
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+
+const maxLabelValueLength = 255
+
+// MaxLabels is the most labels an account can have, which the requests that set labels are also bound to
+const MaxLabels = 64
+
+// Labels are the key/value pairs attached to an account, stored as a JSON object
+type Labels map[string]string
+
+// MarshalJSON stores no labels as an empty object rather than null, so that they still match an empty selector
+func (l Labels) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]string(l))
+}
+
+// ValidateLabel checks that key can be used as a label key, and that value is not too long
+func ValidateLabel(key string, value string) error {
+	if !labelKeyPattern.MatchString(key) || len(value) > maxLabelValueLength {
+		return NewInvalidLabelError(key)
+	}
+	return nil
+}
+
+// ParseLabelSelector returns the key and value of a selector such as "team:payments". Values may contain ':'.
+func ParseLabelSelector(selector string) (string, string, error) {
+	key, value, found := strings.Cut(selector, ":")
+	if !found {
+		return "", "", NewInvalidLabelSelectorError(selector)
+	}
+	if err := ValidateLabel(key, value); err != nil {
+		return "", "", NewInvalidLabelSelectorError(selector)
+	}
+	return key, value, nil
+}
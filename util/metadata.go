@@ -0,0 +1,43 @@
+package util
+
+import (
+	"bytes"
+)
+
+// MaxMetadataSize is the most bytes of JSON that a client can attach to a transaction
+const MaxMetadataSize = 4096
+
+// Metadata is a JSON object given by the client, which is stored and returned as it is
+type Metadata []byte
+
+// MarshalJSON stores no metadata as an empty object rather than null
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	if len(m) == 0 {
+		return []byte("{}"), nil
+	}
+	return m, nil
+}
+
+// UnmarshalJSON keeps a copy of the JSON, and treats null as no metadata
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*m = nil
+		return nil
+	}
+	*m = append((*m)[0:0], data...)
+	return nil
+}
+
+// Validate checks that the metadata, if any, is a JSON object of at most MaxMetadataSize bytes
+func (m Metadata) Validate() error {
+	if len(m) == 0 {
+		return nil
+	}
+	if len(m) > MaxMetadataSize {
+		return NewMetadataTooLargeError(len(m))
+	}
+	if trimmed := bytes.TrimSpace(m); len(trimmed) == 0 || trimmed[0] != '{' {
+		return NewInvalidMetadataError()
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// MoneyScale is the most decimal places an amount can have, matching the numeric(20,5) columns
+	MoneyScale = 5
+	// MoneyPrecision is the most digits an amount can have, matching the numeric(20,5) columns
+	MoneyPrecision = 20
+)
+
+var (
+	decimalPattern  = regexp.MustCompile(`^([+-]?)([0-9]+)(?:\.([0-9]+))?$`)
+	fractionPattern = regexp.MustCompile(`^[+-]?[0-9]+/[0-9]+$`)
+
+	// moneyLimit is the smallest magnitude that does not fit, in units of 10^-MoneyScale
+	moneyLimit = pow10(MoneyPrecision)
+
+	// MaxMoney is the largest amount that fits in the numeric(20,5) columns
+	MaxMoney = Money{units: new(big.Int).Sub(moneyLimit, big.NewInt(1)), scale: MoneyScale}
+)
+
+/*
+Money is an exact decimal amount: units * 10^-scale, with a scale of at most MoneyScale and at most MoneyPrecision
+digits once scaled to MoneyScale. The scale is kept, so "1.50" stays "1.50", and operations that could lose
+precision take an explicit RoundingMode. Money values are immutable, and the zero value is 0.
+*/
+type Money struct {
+	units *big.Int // nil for zero, so that equal values are deeply equal
+	scale int
+}
+
+// ParseMoney strictly parses a decimal such as "-12.345", or a fraction such as "10/4" with an exact decimal value.
+// Exponents, NaN, infinities and surrounding spaces are rejected, as are values that do not fit in Money.
+func ParseMoney(val string) (Money, error) {
+	if match := decimalPattern.FindStringSubmatch(val); match != nil {
+		units, ok := new(big.Int).SetString(match[1]+match[2]+match[3], 10)
+		if !ok {
+			return Money{}, NewInvalidAmountError(val)
+		}
+		// Drop trailing zeros beyond MoneyScale, which do not change the value
+		scale := len(match[3])
+		for scale > MoneyScale && strings.HasSuffix(match[3][:scale], "0") {
+			units.Quo(units, big.NewInt(10))
+			scale--
+		}
+		if scale > MoneyScale {
+			return Money{}, NewInvalidAmountError(val)
+		}
+		return newMoney(units, scale, val)
+	}
+	if fractionPattern.MatchString(val) {
+		r, ok := parseRat(val)
+		if !ok {
+			return Money{}, NewInvalidAmountError(val)
+		}
+		for scale := 0; scale <= MoneyScale; scale++ {
+			if hasScale(r, scale) {
+				return MoneyFromRat(&r, scale, RoundDown)
+			}
+		}
+	}
+	return Money{}, NewInvalidAmountError(val)
+}
+
+// MustParseMoney is ParseMoney for amounts known to be valid, and panics otherwise
+func MustParseMoney(val string) Money {
+	m, err := ParseMoney(val)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// MoneyFromRat rounds r to scale decimal places with mode
+func MoneyFromRat(r *big.Rat, scale int, mode RoundingMode) (Money, error) {
+	if scale < 0 || scale > MoneyScale {
+		return Money{}, NewInvalidAmountError(r.RatString())
+	}
+	rounded := round(*r, scale, mode)
+	units := new(big.Int).Mul(rounded.Num(), pow10(scale))
+	units.Quo(units, rounded.Denom())
+	return newMoney(units, scale, r.RatString())
+}
+
+func newMoney(units *big.Int, scale int, val string) (Money, error) {
+	if units.Sign() == 0 {
+		return Money{scale: scale}, nil
+	}
+	m := Money{units: units, scale: scale}
+	if new(big.Int).Abs(m.scaledUnits(MoneyScale)).Cmp(moneyLimit) >= 0 {
+		return Money{}, NewAmountOverflowError(val)
+	}
+	return m, nil
+}
+
+// scaledUnits returns the value in units of 10^-scale, for scale >= m.scale
+func (m Money) scaledUnits(scale int) *big.Int {
+	if m.units == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Mul(m.units, pow10(scale-m.scale))
+}
+
+func (m Money) Scale() int {
+	return m.scale
+}
+
+func (m Money) Sign() int {
+	if m.units == nil {
+		return 0
+	}
+	return m.units.Sign()
+}
+
+func (m Money) IsZero() bool {
+	return m.units == nil
+}
+
+func (m Money) Cmp(other Money) int {
+	return m.scaledUnits(MoneyScale).Cmp(other.scaledUnits(MoneyScale))
+}
+
+func (m Money) Neg() Money {
+	if m.units == nil {
+		return m
+	}
+	return Money{units: new(big.Int).Neg(m.units), scale: m.scale}
+}
+
+// Add returns m + other at the larger of their scales, or an error if the sum does not fit
+func (m Money) Add(other Money) (Money, error) {
+	scale := m.scale
+	if other.scale > scale {
+		scale = other.scale
+	}
+	units := new(big.Int).Add(m.scaledUnits(scale), other.scaledUnits(scale))
+	return newMoney(units, scale, m.String()+" + "+other.String())
+}
+
+// Sub returns m - other at the larger of their scales, or an error if the difference does not fit
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Neg())
+}
+
+// Mul returns m * factor rounded to scale decimal places with mode
+func (m Money) Mul(factor *big.Rat, scale int, mode RoundingMode) (Money, error) {
+	return MoneyFromRat(new(big.Rat).Mul(m.Rat(), factor), scale, mode)
+}
+
+// Rescale returns m with scale decimal places, rounding with mode if that drops digits
+func (m Money) Rescale(scale int, mode RoundingMode) Money {
+	if scale >= m.scale {
+		units := m.scaledUnits(scale)
+		if units.Sign() == 0 {
+			units = nil
+		}
+		return Money{units: units, scale: scale}
+	}
+	rescaled, _ := MoneyFromRat(m.Rat(), scale, mode) // cannot overflow when dropping digits
+	return rescaled
+}
+
+func (m Money) Rat() *big.Rat {
+	if m.units == nil {
+		return new(big.Rat)
+	}
+	return new(big.Rat).SetFrac(m.units, pow10(m.scale))
+}
+
+// String renders m with exactly its scale decimal places
+func (m Money) String() string {
+	return m.Rat().FloatString(m.scale)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts amounts as JSON strings, or as JSON numbers without exponents
+func (m *Money) UnmarshalJSON(data []byte) error {
+	val := string(data)
+	if val == "null" {
+		return nil
+	}
+	if strings.HasPrefix(val, `"`) {
+		if err := json.Unmarshal(data, &val); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseMoney(val)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner, so that numeric columns can be scanned into Money
+func (m *Money) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid || v.NaN || v.InfinityModifier != pgtype.Finite {
+		return NewInvalidAmountError("non-finite numeric")
+	}
+	units := new(big.Int).Set(v.Int)
+	scale := -int(v.Exp)
+	if scale < 0 {
+		units.Mul(units, pow10(-scale))
+		scale = 0
+	}
+	for scale > MoneyScale && new(big.Int).Rem(units, big.NewInt(10)).Sign() == 0 {
+		units.Quo(units, big.NewInt(10))
+		scale--
+	}
+	if scale > MoneyScale {
+		return NewInvalidAmountError(fmt.Sprintf("%se%d", v.Int, v.Exp))
+	}
+	parsed, err := newMoney(units, scale, units.String())
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer, so that Money can be written to numeric columns
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: m.scaledUnits(m.scale), Exp: int32(-m.scale), Valid: true}, nil
+}
+
+// parseRat strictly parses a decimal or a fraction, unlike big.Rat.SetString, which also takes exponents
+func parseRat(val string) (big.Rat, bool) {
+	var r big.Rat
+	if !decimalPattern.MatchString(val) && !fractionPattern.MatchString(val) {
+		return r, false
+	}
+	_, ok := r.SetString(val)
+	return r, ok
+}
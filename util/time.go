@@ -0,0 +1,13 @@
+package util
+
+import "time"
+
+// AddMonths adds months to t, clamping to the end of the month when it has fewer days, so Jan 31 + 1 month is Feb 28 (or 29)
+func AddMonths(t time.Time, months int) time.Time {
+	next := t.AddDate(0, months, 0)
+	if next.Day() != t.Day() {
+		// AddDate normalized an overflow into the following month, go back to the last day of the month before
+		next = next.AddDate(0, 0, -next.Day())
+	}
+	return next
+}
@@ -1,52 +1,465 @@
 package util
 
 import (
+	"encoding/json"
+	"math"
 	"math/big"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
-func TestStringToAmount(t *testing.T) {
+func TestParseMoney(t *testing.T) {
 	tests := []struct {
 		name    string
 		val     string
 		wantErr bool
-		want    *big.Rat
+		want    string
 	}{
-		{name: "Valid amount", val: "123.45", want: big.NewRat(12345, 100)},
+		{name: "Valid amount", val: "123.45", want: "123.45"},
+		{name: "Negative amount", val: "-0.5", want: "-0.5"},
+		{name: "Trailing zeros beyond scale", val: "1.2300000", want: "1.23000"},
+		{name: "Exact fraction", val: "10/1", want: "10"},
+		{name: "Decimal fraction", val: "10/4", want: "2.5"},
+		{name: "Largest amount", val: "999999999999999.99999", want: "999999999999999.99999"},
 		{name: "Invalid amount", val: "invalid", wantErr: true},
-		{name: "Valid Rat, Invalid amount", val: "10/1", wantErr: true},
+		{name: "Exponent", val: "1e3", wantErr: true},
+		{name: "Too many decimal places", val: "0.000001", wantErr: true},
+		{name: "Inexact fraction", val: "10/3", wantErr: true},
+		{name: "Zero denominator", val: "1/0", wantErr: true},
+		{name: "Overflow", val: "1000000000000000", wantErr: true},
+		{name: "Missing integer part", val: ".5", wantErr: true},
+		{name: "Surrounding spaces", val: " 1", wantErr: true},
 		{name: "NaN amount", val: "NaN", wantErr: true},
 		{name: "Inf amount", val: "Inf", wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := StringToAmount(tt.val)
+			got, err := ParseMoney(tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMoney() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseMoney() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	a, b := MustParseMoney("10.5"), MustParseMoney("0.25")
+	if sum, err := a.Add(b); err != nil || sum.String() != "10.75" {
+		t.Errorf("Add() = %v, %v", sum, err)
+	}
+	if diff, err := b.Sub(a); err != nil || diff.String() != "-10.25" || diff.Sign() >= 0 {
+		t.Errorf("Sub() = %v, %v", diff, err)
+	}
+	if _, err := MaxMoney.Add(MustParseMoney("0.00001")); err == nil {
+		t.Errorf("Add() expected overflow error")
+	}
+	if product, err := a.Mul(big.NewRat(1, 3), 2, RoundHalfEven); err != nil || product.String() != "3.50" {
+		t.Errorf("Mul() = %v, %v", product, err)
+	}
+	if MustParseMoney("1.50").Cmp(MustParseMoney("1.5")) != 0 || a.Cmp(b) <= 0 {
+		t.Errorf("Cmp() compares values regardless of scale")
+	}
+	if zero, _ := a.Sub(a); !zero.IsZero() || !reflect.DeepEqual(zero, Money{scale: 1}) {
+		t.Errorf("Sub() = %#v, want a zero Money", zero)
+	}
+	if got := b.Rescale(MoneyScale, RoundDown).String(); got != "0.25000" {
+		t.Errorf("Rescale() = %v", got)
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var got struct{ Amount *Money }
+	for _, body := range []string{`{"Amount":"1.50"}`, `{"Amount":1.50}`} {
+		if err := json.Unmarshal([]byte(body), &got); err != nil || got.Amount.String() != "1.50" {
+			t.Errorf("Unmarshal(%s) = %v, %v", body, got.Amount, err)
+		}
+	}
+	for _, body := range []string{`{"Amount":1e3}`, `{"Amount":"abc"}`, `{"Amount":true}`} {
+		if err := json.Unmarshal([]byte(body), &got); err == nil {
+			t.Errorf("Unmarshal(%s) expected error", body)
+		}
+	}
+	data, err := json.Marshal(MustParseMoney("-2.000"))
+	if err != nil || string(data) != `"-2.000"` {
+		t.Errorf("Marshal() = %s, %v", data, err)
+	}
+}
+
+func TestMoney_Numeric(t *testing.T) {
+	want := MustParseMoney("-123.45000")
+	numeric, err := want.NumericValue()
+	if err != nil {
+		t.Fatalf("NumericValue() error = %v", err)
+	}
+	var got Money
+	if err = got.ScanNumeric(numeric); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanNumeric() = %v, %v, want %v", got, err, want)
+	}
+	if err = got.ScanNumeric(pgtype.Numeric{Int: big.NewInt(15), Exp: 2, Valid: true}); err != nil || got.String() != "1500" {
+		t.Errorf("ScanNumeric() = %v, %v, want 1500", got, err)
+	}
+	for _, invalid := range []pgtype.Numeric{{}, {NaN: true, Valid: true}, {Int: big.NewInt(1), Exp: -6, Valid: true}} {
+		if err = got.ScanNumeric(invalid); err == nil {
+			t.Errorf("ScanNumeric(%v) expected error", invalid)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	for _, id := range []int64{1, 42, math.MaxInt64} {
+		got, err := DecodeCursor(EncodeCursor(id))
+		if err != nil || got != id {
+			t.Errorf("DecodeCursor(EncodeCursor(%d)) = %d, %v", id, got, err)
+		}
+	}
+	for _, cursor := range []string{"", "not base64!", EncodeCursor(0), "YWJj"} {
+		if _, err := DecodeCursor(cursor); err == nil {
+			t.Errorf("DecodeCursor(%q) expected error", cursor)
+		}
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	tests := []struct {
+		code    string
+		val     string
+		wantErr bool
+		want    string
+	}{
+		{code: "USD", val: "1.5", want: "1.50"},
+		{code: "USD", val: "1.505", wantErr: true},
+		{code: "JPY", val: "100", want: "100"},
+		{code: "JPY", val: "100.1", wantErr: true},
+		{code: "BHD", val: "0.125", want: "0.125"},
+		{code: "BHD", val: "0.1255", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code+" "+tt.val, func(t *testing.T) {
+			currency, err := LookupCurrency(tt.code)
+			if err != nil {
+				t.Fatalf("LookupCurrency() error = %v", err)
+			}
+			amount, err := ParseMoney(tt.val)
+			if err != nil {
+				t.Fatalf("ParseMoney() error = %v", err)
+			}
+			err = currency.ValidateAmount(amount)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("StringToAmount() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ValidateAmount() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if err == nil && got.Cmp(tt.want) != 0 {
-				t.Errorf("StringToAmount() = %v, expected integer value", got)
+			if got := currency.Round(amount).String(); err == nil && got != tt.want {
+				t.Errorf("Round() = %v, want %v", got, tt.want)
 			}
 		})
 	}
+	if _, err := LookupCurrency("XYZ"); err == nil {
+		t.Errorf("LookupCurrency() expected error for unknown currency")
+	}
+}
+
+func TestCurrency_Round(t *testing.T) {
+	usd, _ := LookupCurrency("USD")
+	tests := []struct {
+		val  string
+		want string
+	}{
+		{"1.005", "1.00"},
+		{"1.015", "1.02"},
+		{"1.0051", "1.01"},
+		{"-1.015", "-1.02"},
+		{"3.33333", "3.33"},
+	}
+	for _, tt := range tests {
+		if got := usd.Round(MustParseMoney(tt.val)).String(); got != tt.want {
+			t.Errorf("Round(%v) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
 }
 
-func TestAmountToString(t *testing.T) {
+func TestCurrency_RoundWith(t *testing.T) {
+	usd, _ := LookupCurrency("USD")
 	tests := []struct {
-		name string
-		val  big.Rat
+		mode RoundingMode
+		val  *big.Rat
 		want string
 	}{
-		{"Whole number", *big.NewRat(10, 1), "10.00000"},
-		{"Decimal number", *big.NewRat(10, 3), "3.33333"},
+		{RoundHalfEven, big.NewRat(1025, 1000), "1.02"},
+		{RoundHalfUp, big.NewRat(1025, 1000), "1.03"},
+		{RoundHalfUp, big.NewRat(-1025, 1000), "-1.03"},
+		{RoundDown, big.NewRat(1029, 1000), "1.02"},
+		{RoundDown, big.NewRat(-1029, 1000), "-1.02"},
+		{RoundUp, big.NewRat(1021, 1000), "1.03"},
+		{RoundUp, big.NewRat(1020, 1000), "1.02"},
+	}
+	for _, tt := range tests {
+		got, err := usd.RoundWith(*tt.val, tt.mode)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("RoundWith(%v, %s) = %v, %v, want %v", tt.val, tt.mode, got, err, tt.want)
+		}
+	}
+	if _, err := ParseRoundingMode("sideways"); err == nil {
+		t.Errorf("ParseRoundingMode() expected error for unknown mode")
+	}
+}
+
+func TestBalanceRounding(t *testing.T) {
+	rounding, err := NewBalanceRounding("USD", MustParseMoney("10.00400"))
+	if err != nil {
+		t.Fatalf("NewBalanceRounding() error = %v", err)
+	}
+	if got := rounding.Balance().String(); got != "10.00" {
+		t.Errorf("Balance() = %v, want 10.00", got)
+	}
+	// Each movement is the change of the rounded balance, so three movements of 0.004 round to 0.01, 0.00 and 0.01
+	for i, want := range []string{"0.01", "0.00", "0.01", "-2.50"} {
+		amount := "0.004"
+		if i == 3 {
+			amount = "-2.5"
+		}
+		got, err := rounding.Add(MustParseMoney(amount))
+		if err != nil || got.String() != want {
+			t.Errorf("Add(%v) = %v, %v, want %v", amount, got, err, want)
+		}
+	}
+	if got := rounding.Balance().String(); got != "7.52" {
+		t.Errorf("Balance() = %v, want 7.52", got)
+	}
+	if got := rounding.Residual().String(); got != "-0.00400" {
+		t.Errorf("Residual() = %v, want -0.00400", got)
+	}
+	if _, err := NewBalanceRounding("XYZ", Money{}); err == nil {
+		t.Errorf("NewBalanceRounding() expected error for unknown currency")
+	}
+}
+
+func TestReadFxRatesCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr bool
+		want    []FxRateRecord
+	}{
+		{
+			name: "Valid rates",
+			csv:  "base_currency,quote_currency,rate,effective_from\nUSD,JPY,150.25,2024-01-01T00:00:00Z\nEUR, USD, 1.0875,2024-01-02T00:00:00Z\n",
+			want: []FxRateRecord{
+				{BaseCurrency: "USD", QuoteCurrency: "JPY", Rate: "150.2500000000", EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: "1.0875000000", EffectiveFrom: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{name: "Missing header", csv: "USD,JPY,150.25,2024-01-01T00:00:00Z\n", wantErr: true},
+		{name: "Unknown currency", csv: "base_currency,quote_currency,rate,effective_from\nUSD,XYZ,1,2024-01-01T00:00:00Z\n", wantErr: true},
+		{name: "Same currency", csv: "base_currency,quote_currency,rate,effective_from\nUSD,USD,1,2024-01-01T00:00:00Z\n", wantErr: true},
+		{name: "Negative rate", csv: "base_currency,quote_currency,rate,effective_from\nUSD,JPY,-1,2024-01-01T00:00:00Z\n", wantErr: true},
+		{name: "Invalid time", csv: "base_currency,quote_currency,rate,effective_from\nUSD,JPY,150,yesterday\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadFxRatesCSV(strings.NewReader(tt.csv))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFxRatesCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ReadFxRatesCSV() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ReadFxRatesCSV()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
 	}
+}
 
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		name   string
+		t      time.Time
+		months int
+		want   time.Time
+	}{
+		{name: "Same day", t: time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC), months: 1, want: time.Date(2024, 2, 15, 9, 0, 0, 0, time.UTC)},
+		{name: "Across year", t: time.Date(2024, 11, 30, 9, 0, 0, 0, time.UTC), months: 2, want: time.Date(2025, 1, 30, 9, 0, 0, 0, time.UTC)},
+		{name: "Clamped to leap day", t: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC), months: 1, want: time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)},
+		{name: "Clamped to end of February", t: time.Date(2025, 1, 31, 9, 0, 0, 0, time.UTC), months: 1, want: time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC)},
+		{name: "Clamped to 30th", t: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC), months: 3, want: time.Date(2024, 4, 30, 9, 0, 0, 0, time.UTC)},
+		{name: "Not clamped after a short month", t: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC), months: 2, want: time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC)},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := AmountToString(tt.val); got != tt.want {
-				t.Errorf("AmountToString() = %v, want %v", got, tt.want)
+			if got := AddMonths(tt.t, tt.months); !got.Equal(tt.want) {
+				t.Errorf("AddMonths() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, InitialBackoff: time.Minute, RandomBackoff: time.Second}
+	for retry, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		got := policy.Backoff(retry)
+		if got < want || got >= want+policy.RandomBackoff {
+			t.Errorf("Backoff(%d) = %v, want %v plus up to %v", retry, got, want, policy.RandomBackoff)
+		}
+	}
+	if got := (RetryPolicy{InitialBackoff: time.Minute}).Backoff(1); got != 2*time.Minute {
+		t.Errorf("Backoff(1) without RandomBackoff = %v, want %v", got, 2*time.Minute)
+	}
+
+	capped := RetryPolicy{InitialBackoff: time.Minute, MaxBackoff: 10 * time.Minute}
+	for retry, want := range map[int]time.Duration{3: 8 * time.Minute, 4: 10 * time.Minute, 100: 10 * time.Minute} {
+		if got := capped.Backoff(retry); got != want {
+			t.Errorf("Backoff(%d) with MaxBackoff = %v, want %v", retry, got, want)
+		}
+	}
+
+	// Without MaxBackoff, the wait stops doubling before it overflows
+	unbounded := RetryPolicy{InitialBackoff: time.Minute}
+	for _, retry := range []int{40, 63, 64, 1000} {
+		if got := unbounded.Backoff(retry); got < unbounded.Backoff(retry-1) {
+			t.Errorf("Backoff(%d) = %v, want at least Backoff(%d)", retry, got, retry-1)
+		}
+	}
+	unbounded.RandomBackoff = time.Second
+	if got, below := unbounded.Backoff(1000), unbounded.Backoff(20); got < below {
+		t.Errorf("Backoff(1000) with RandomBackoff = %v, want at least Backoff(20) = %v", got, below)
+	}
+}
+
+func TestAccountNumber(t *testing.T) {
+	// 7992739871 is the usual Luhn example, with check digit 3
+	for id, want := range map[int64]string{7992739871: "79927398713", 1: "00000000018"} {
+		if got := AccountNumber(id); got != want {
+			t.Errorf("AccountNumber(%d) = %s, want %s", id, got, want)
+		}
+	}
+
+	for _, id := range []int64{1, 42, 9999999999, 10000000000, math.MaxInt64} {
+		got, err := ParseAccountNumber(AccountNumber(id))
+		if err != nil || got != id {
+			t.Errorf("ParseAccountNumber(AccountNumber(%d)) = %d, %v", id, got, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"00000000017",          // wrong check digit
+		"00000000081",          // transposed digits
+		"0000000001",           // too short
+		"0000000000018",        // extra leading zeros
+		"00000000000",          // zero ID
+		"0000000001a8",         // not a digit
+		"-0000000018",          // sign
+		"99999999999999999999", // beyond int64
+	}
+	for _, number := range invalid {
+		if id, err := ParseAccountNumber(number); err == nil {
+			t.Errorf("ParseAccountNumber(%q) = %d, want error", number, id)
+		}
+	}
+}
+
+func TestResolveAccountID(t *testing.T) {
+	number := AccountNumber(42)
+	for _, tc := range []struct {
+		id     int64
+		number string
+		want   int64
+	}{
+		{id: 42, want: 42},
+		{number: number, want: 42},
+		{id: 42, number: number, want: 42},
+	} {
+		got, err := ResolveAccountID("source_account", tc.id, tc.number)
+		if err != nil || got != tc.want {
+			t.Errorf("ResolveAccountID(%d, %q) = %d, %v", tc.id, tc.number, got, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		id     int64
+		number string
+	}{
+		{},
+		{id: 43, number: number},
+		{number: "00000000017"},
+	} {
+		if id, err := ResolveAccountID("source_account", tc.id, tc.number); err == nil {
+			t.Errorf("ResolveAccountID(%d, %q) = %d, want error", tc.id, tc.number, id)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	if data, err := json.Marshal(Labels(nil)); err != nil || string(data) != "{}" {
+		t.Errorf("json.Marshal(Labels(nil)) = %s, %v, want {}", data, err)
+	}
+
+	valid := map[string][2]string{
+		"team:payments":           {"team", "payments"},
+		"url:https://example.com": {"url", "https://example.com"},
+		"cost-centre.v2:":         {"cost-centre.v2", ""},
+	}
+	for selector, want := range valid {
+		key, value, err := ParseLabelSelector(selector)
+		if err != nil || key != want[0] || value != want[1] {
+			t.Errorf("ParseLabelSelector(%q) = %q, %q, %v, want %q, %q", selector, key, value, err, want[0], want[1])
+		}
+	}
+
+	invalid := []string{
+		"team",                         // no value
+		":payments",                    // no key
+		"-team:payments",               // key starting with a symbol
+		"team name:payments",           // space in key
+		strings.Repeat("k", 64) + ":v", // key too long
+		"team:" + strings.Repeat("v", 256),
+	}
+	for _, selector := range invalid {
+		if _, _, err := ParseLabelSelector(selector); err == nil {
+			t.Errorf("ParseLabelSelector(%q) succeeded, want error", selector)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	var request struct {
+		Metadata Metadata `json:"metadata"`
+	}
+	for body, want := range map[string]string{
+		`{"metadata": {"invoice": 123456789012345678}}`: `{"invoice":123456789012345678}`,
+		`{"metadata": null}`:                            `{}`,
+		`{}`:                                            `{}`,
+	} {
+		request.Metadata = nil
+		if err := json.Unmarshal([]byte(body), &request); err != nil {
+			t.Fatalf("json.Unmarshal(%s) error = %v", body, err)
+		}
+		if err := request.Metadata.Validate(); err != nil {
+			t.Errorf("Validate() of %s error = %v", body, err)
+		}
+		if data, err := json.Marshal(request.Metadata); err != nil || string(data) != want {
+			t.Errorf("json.Marshal() of %s = %s, %v, want %s", body, data, err, want)
+		}
+	}
+
+	invalid := []Metadata{
+		Metadata(`["invoice"]`),
+		Metadata(`"invoice"`),
+		Metadata(`{"note": "` + strings.Repeat("x", MaxMetadataSize) + `"}`),
+	}
+	for _, metadata := range invalid {
+		if err := metadata.Validate(); err == nil {
+			t.Errorf("Validate() of %.20s succeeded, want error", metadata)
+		}
+	}
+}